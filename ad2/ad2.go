@@ -5,6 +5,7 @@ package ad2
 // #include "stdlib.h"
 import "C"
 import (
+	"context"
 	"fmt"
 	"math"
 	"strings"
@@ -44,6 +45,7 @@ type Ad2 struct {
 	DriverVersion     string
 	devNo             int
 	isOpen            bool
+	name              string // Name and serial number, set by Open
 	sampleIntervalSec float64
 	sampleCount       int
 	Offset            [2]float64
@@ -85,7 +87,7 @@ func New(sno string) (a *Ad2, err error) {
 // QueryIdn will read the ID from the instrument.
 func (a *Ad2) QueryIdn() (string, error) {
 	if a.isOpen {
-		return DeviceInfo[a.devNo].Name + " " + DeviceInfo[a.devNo].SerialNumber, nil
+		return a.name, nil
 	}
 	return "", fmt.Errorf("not open")
 }
@@ -144,6 +146,8 @@ func (a *Ad2) Open(sno string) error {
 	C.FDwfAnalogInBufferSizeInfo(a.hdwf, &min, &max)
 	a.MinBuffer = int(min)
 	a.MaxBuffer = int(max)
+	a.devNo = n
+	a.name = DeviceInfo[n].Name + " " + DeviceInfo[n].SerialNumber
 	a.isOpen = true
 	return nil
 }
@@ -180,6 +184,37 @@ func (a *Ad2) GetOutput(ch instr.Chan) (float64, float64, error) {
 	return float64(voltage), 0.0, nil
 }
 
+// GetOutputContext is GetOutput, but returns at once if ctx is done
+func (a *Ad2) GetOutputContext(ctx context.Context, ch instr.Chan) (float64, float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0.0, 0.0, err
+	}
+	return a.GetOutput(ch)
+}
+
+// GetOutputReading will return the output voltage and current as readings
+func (a *Ad2) GetOutputReading(ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	return a.GetOutputReadingContext(context.Background(), ch)
+}
+
+// GetOutputReadingContext is GetOutputReading that can be cancelled by ctx
+func (a *Ad2) GetOutputReadingContext(ctx context.Context, ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	voltage, current, err := a.GetOutputContext(ctx, ch)
+	if err != nil {
+		return instr.Reading{}, instr.Reading{}, err
+	}
+	v, i := instr.OutputReadings(a.name, ch, voltage, current)
+	return v, i, nil
+}
+
+// SetOutputContext is SetOutput, but returns at once if ctx is done
+func (a *Ad2) SetOutputContext(ctx context.Context, ch instr.Chan, voltage float64, current float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.SetOutput(ch, voltage, current)
+}
+
 // SetOutput will set voltages on V+ and V-
 // Channel 0 = V+ (positive power slupply) (Node 0 = Enable, Node 1 = Voltage)
 // Channel 1 = V- (negative power slupply) (Node 0 = Enable, Node 1 = Voltage)
@@ -224,6 +259,11 @@ func (a *Ad2) DisableChannel(ch instr.Chan) {
 
 // Measure (ch int, typ string) (float64, error)
 func (a *Ad2) Measure(ch instr.Chan, typ string) (result float64, err error) {
+	return a.MeasureContext(context.Background(), ch, typ)
+}
+
+// MeasureContext is Measure that can be cancelled by ctx
+func (a *Ad2) MeasureContext(ctx context.Context, ch instr.Chan, typ string) (result float64, err error) {
 	const avgCnt = 10
 	if typ != "VOLT" {
 		return 0.0, fmt.Errorf("only voltage measurements possible")
@@ -239,7 +279,10 @@ func (a *Ad2) Measure(ch instr.Chan, typ string) (result float64, err error) {
 		if sts == C.DwfStateDone {
 			break
 		}
-		time.Sleep(100 * time.Millisecond)
+		if err = instr.Sleep(ctx, 100*time.Millisecond); err != nil {
+			C.FDwfAnalogInConfigure(a.hdwf, C.int(0), C.int(0))
+			return 0.0, err
+		}
 	}
 	var rgdAnalog [avgCnt]C.double
 	e &= C.FDwfAnalogInStatusData(a.hdwf, C.int(0), &rgdAnalog[0], C.int(avgCnt)) // get channel 1 data
@@ -250,6 +293,22 @@ func (a *Ad2) Measure(ch instr.Chan, typ string) (result float64, err error) {
 	return result, nil
 }
 
+// MeasureReading is Measure returning the value with unit, time and status
+func (a *Ad2) MeasureReading(ch instr.Chan, typ string) (instr.Reading, error) {
+	return a.MeasureReadingContext(context.Background(), ch, typ)
+}
+
+// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+func (a *Ad2) MeasureReadingContext(ctx context.Context, ch instr.Chan, typ string) (instr.Reading, error) {
+	v, err := a.MeasureContext(ctx, ch, typ)
+	if err != nil {
+		return instr.Reading{}, err
+	}
+	r := instr.NewReading(v, instr.ScopeUnit(typ), 0)
+	r.Source, r.Chan = a.name, ch
+	return r, nil
+}
+
 // SetAnalogOut will set analog output. PhaseDelay for channel is 0-360.0 degrees.
 func (a *Ad2) SetAnalogOut(ch instr.Chan, freq float64, phaseDelay float64, waveform WaveForm, volt float64, offset float64) error {
 	channel := C.int(ch - instr.Ch1)
@@ -350,6 +409,15 @@ func (a *Ad2) SetupTrigger(sourceChan instr.Chan, coupling instr.Coupling, slope
 
 // GetSamples will return a dataset (points) of 2500 points scaled
 func (a *Ad2) GetSamples() (data [][]float64, err error) {
+	return a.GetSamplesContext(context.Background())
+}
+
+// GetSamplesContext is GetSamples that can be cancelled by ctx.
+// The acquisition is stopped if ctx is done before the scan is finished.
+func (a *Ad2) GetSamplesContext(ctx context.Context) (data [][]float64, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	C.FDwfAnalogInBufferSizeSet(a.hdwf, C.int(a.sampleCount))
 	// Set aquisition mode for a single scan.
 	C.FDwfAnalogInAcquisitionModeSet(a.hdwf, C.acqmodeSingle)
@@ -362,6 +430,10 @@ func (a *Ad2) GetSamples() (data [][]float64, err error) {
 		if sts == C.DwfStateDone || time.Since(tStart) > time.Second*10 {
 			break
 		}
+		if err = ctx.Err(); err != nil {
+			C.FDwfAnalogInConfigure(a.hdwf /*fReconfigure*/, 0 /*fStart*/, 0)
+			return nil, err
+		}
 	}
 	var timeData []float64
 	for i := 0; i < a.sampleCount; i++ {
@@ -1,6 +1,8 @@
 package bm25x
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -19,6 +21,7 @@ type Lcd struct {
 	CurrentValue float64
 	CurrentUnit  string
 	CurrentError string
+	received     time.Time // When the current value was received
 	buf          [16]byte
 	mutex        sync.Mutex
 }
@@ -33,29 +36,97 @@ func (dmm *Lcd) QueryIdn() (string, error) {
 	return "No data recieved", fmt.Errorf("No data recieved")
 }
 
-// Configure implements interface
+// Configure checks that the meter can measure the setup. The function and range are
+// selected by the knob on the meter, so only the default range and resolution are accepted.
 func (dmm *Lcd) Configure(s instr.Setup) error {
+	switch s.Unit {
+	case instr.VoltDc, instr.VoltAcRms, instr.CurrentDc, instr.CurrentAcRms, instr.Hz, instr.Ohm,
+		instr.Farad, instr.DBm, instr.Diode, instr.Continuity:
+		if s.Sensor != instr.DefaultSensor {
+			return fmt.Errorf("%s is only used for temperature", s.Sensor)
+		}
+	case instr.Celcius:
+		if s.Sensor != instr.DefaultSensor && s.Sensor != instr.ThermocoupleK {
+			return fmt.Errorf("%s is not supported, only type K thermocouple", s.Sensor)
+		}
+	default:
+		return fmt.Errorf("%s is not supported", s.Unit)
+	}
+	if s.Chan > 1 {
+		return fmt.Errorf("%d is illegal channel", s.Chan)
+	}
+	if s.Range != "" || s.Max > 0 || s.Resolution > 0 || s.Rate > 0 {
+		return fmt.Errorf("range, resolution and rate are set on the meter")
+	}
 	return nil
 }
 
+// MeasureContext returns the last value received. The display is sent continuously,
+// so it does not wait for the instrument.
+func (dmm *Lcd) MeasureContext(ctx context.Context) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0.0, err
+	}
+	return dmm.Measure()
+}
+
 // Measure returns measured value
 func (dmm *Lcd) Measure() (float64, error) {
 	dmm.mutex.Lock()
 	defer dmm.mutex.Unlock()
 	if !dmm.Ok {
-		return 0.0, fmt.Errorf(dmm.CurrentError)
+		return 0.0, errors.New(dmm.CurrentError)
 	}
 	return dmm.CurrentValue, nil
 }
 
-func (dmm *Lcd) update(buf []byte, n int) {
+// MeasureReading returns the last value received, scaled to the unit shown on the display.
+// Temperatures shown in Fahrenheit are converted to Celcius.
+func (dmm *Lcd) MeasureReading() (instr.Reading, error) {
 	dmm.mutex.Lock()
 	defer dmm.mutex.Unlock()
-	if n == 15 {
-		dmm.Ok = true
-		dmm.CurrentValue = dmm.decode(buf)
+	if !dmm.Ok {
+		return instr.Reading{}, errors.New(dmm.CurrentError)
+	}
+	unit, scale := engUnit(dmm.CurrentUnit)
+	v := dmm.CurrentValue * scale
+	if dmm.CurrentUnit == "°F" {
+		// Readings are always in Celcius
+		unit, v = instr.Celcius, (dmm.CurrentValue-32)*5/9
+	}
+	if dmm.CurrentValue == instr.Overload {
+		// Not scaled, so that the reading is flagged as overload
+		v = instr.Overload
+	}
+	r := instr.NewReading(v, unit, 0)
+	r.Time, r.Source, r.Chan = dmm.received, "BM25x", instr.Ch1
+	return r, nil
+}
+
+// MeasureReadingContext is MeasureReading, but returns at once if ctx is done
+func (dmm *Lcd) MeasureReadingContext(ctx context.Context) (instr.Reading, error) {
+	if err := ctx.Err(); err != nil {
+		return instr.Reading{}, err
+	}
+	return dmm.MeasureReading()
+}
+
+func (dmm *Lcd) update(buf []byte, n int, err error) {
+	dmm.mutex.Lock()
+	defer dmm.mutex.Unlock()
+	if err != nil {
+		dmm.Ok = false
+		dmm.CurrentError = err.Error()
+	} else if n == 15 {
+		v, err := decode(buf)
+		dmm.Ok = err == nil
+		if err != nil {
+			dmm.CurrentError = err.Error()
+			return
+		}
+		dmm.CurrentValue = v
 		dmm.CurrentUnit = unit(buf)
-		//fmt.Printf("%0.3f%s\n", dmm.CurrentValue, dmm.CurrentUnit)
+		dmm.received = time.Now()
 	} else {
 		dmm.Ok = false
 		dmm.CurrentError = "no data received"
@@ -65,8 +136,11 @@ func (dmm *Lcd) update(buf []byte, n int) {
 func (dmm *Lcd) background() {
 	for dmm.terminated == false {
 		buf := make([]byte, 16)
-		n := dmm.Read(buf)
-		dmm.update(buf, n)
+		n, err := dmm.Read(buf)
+		dmm.update(buf, n, err)
+		if errors.Is(err, instr.ErrClosed) {
+			return
+		}
 	}
 }
 
@@ -135,6 +209,11 @@ func toDigt(b1, b2 byte) int {
 	return -1
 }
 
+// isL returns true if the segments show an L, used in the overload display "OL"
+func isL(b1, b2 byte) bool {
+	return b1&0x0E == 0x06 && b2&0x0F == 0x01
+}
+
 func exp(buf []byte) float64 {
 	e := 1.0
 	if buf[9]&1 != 0 {
@@ -197,37 +276,69 @@ func unit(buf []byte) string {
 	if buf[11]&0x02 != 0 {
 		u = "M" + u
 	}
-	if buf[9] == 0x0E && buf[10] == 0x01 {
-		u = "C"
+	if buf[9]&0x0F == 0x0E && buf[10]&0x0F == 0x01 {
+		u = "°C"
 	}
-	if buf[9] == 0x0E && buf[10] == 0x04 {
-		u = "F"
+	if buf[9]&0x0F == 0x0E && buf[10]&0x0F == 0x04 {
+		u = "°F"
 	}
 	return u
 }
 
-func (dmm *Lcd) decode(buf []byte) float64 {
+// engUnit returns the unit shown on the display, like "mVdc", and the scale
+// giving the value in the base unit. Units without an EngUnit gives Illegal.
+func engUnit(u string) (instr.EngUnit, float64) {
+	scale, symbol := instr.SplitPrefix(u)
+	switch symbol {
+	case "Vdc":
+		return instr.VoltDc, scale
+	case "Vac":
+		return instr.VoltAcRms, scale
+	case "Adc":
+		return instr.CurrentDc, scale
+	case "Aac":
+		return instr.CurrentAcRms, scale
+	case "Hz":
+		return instr.Hz, scale
+	case "ohm":
+		return instr.Ohm, scale
+	case "F":
+		return instr.Farad, scale
+	case "dBm":
+		return instr.DBm, scale
+	case "°C":
+		return instr.Celcius, scale
+	}
+	return instr.Illegal, scale
+}
+
+// decode returns the value on the display, or an error if it is not a valid measurement.
+// instr.Overload is returned when the display shows "OL".
+func decode(buf []byte) (float64, error) {
 	if buf[0] != 0x02 {
-		dmm.CurrentError = "message format error"
-		return 99999.9
+		return 0, errors.New("message format error")
 	}
 	if buf[11]&0x08 != 0 || buf[12]&0x08 != 0 || buf[13]&0x08 != 0 || buf[14]&0x08 != 0 || buf[1]&0x01 != 0 {
 		// Hold, Crest, Min or Max - invalid
-		dmm.CurrentError = "hold/crest/min/max not allowed"
-		return 99999.9
+		return 0, errors.New("hold/crest/min/max not allowed")
 	}
 	d1 := toDigt(buf[3], buf[4])
 	d2 := toDigt(buf[5], buf[6])
 	d3 := toDigt(buf[7], buf[8])
 	d4 := toDigt(buf[9], buf[10])
-	if d4 < 0 {
-		if d1 < 0 {
-			dmm.CurrentError = "could not decode display"
-			return 99999.9
+	for k := 3; k <= 7; k += 2 {
+		if toDigt(buf[k], buf[k+1]) == 0 && isL(buf[k+2], buf[k+3]) {
+			// "OL" is shown when the input is outside the range
+			return instr.Overload, nil
 		}
+	}
+	if d1 < 0 || d2 < 0 || d3 < 0 {
+		return 0, errors.New("could not decode display")
+	}
+	if d4 < 0 {
 		// Special case for temperature where d4 is C or F
-		return float64(d1*100 + d2*10 + d3)
+		return float64(d1*100 + d2*10 + d3), nil
 	}
 	v := float64(d1*1000+d2*100+d3*10+d4) / exp(buf)
-	return v
+	return v, nil
 }
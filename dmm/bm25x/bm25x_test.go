@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/jkvatne/go-measure/dmm/bm25x"
+	"github.com/jkvatne/go-measure/instr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,3 +28,16 @@ func TestDmm(t *testing.T) {
 	assert.NoError(t, err, "Failed measure()")
 	fmt.Printf("Measured voltage is %0.6f\n", volt)
 }
+
+// TestConfigure checks the setups accepted, which needs no meter
+func TestConfigure(t *testing.T) {
+	d := &bm25x.Lcd{}
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc}))
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.Celcius, Sensor: instr.ThermocoupleK}))
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.Diode}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.Celcius, Sensor: instr.Pt100}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.OhmFourWire}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Sensor: instr.ThermocoupleK}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Max: 10}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Chan: 2}))
+}
@@ -0,0 +1,58 @@
+package bm25x
+
+import (
+	"testing"
+
+	"github.com/jkvatne/go-measure/instr"
+	"github.com/stretchr/testify/assert"
+)
+
+// frame returns a message with the byte number in the high nibble of each byte, and the
+// segments and flags in the low nibble
+func frame(nibbles ...byte) []byte {
+	buf := make([]byte, 16)
+	for k, b := range nibbles {
+		buf[k] = byte(k)<<4 | b
+	}
+	return buf
+}
+
+// TestDecode feeds messages to the meter, which needs no port. The frames are made from the
+// segment patterns of the digits, with the Vdc flags set.
+func TestDecode(t *testing.T) {
+	dmm := &Lcd{}
+	// "1.234" Vdc
+	dmm.update(frame(0x2, 0x4, 0x0, 0x0, 0xA, 0xB, 0xD, 0x8, 0xF, 0x4, 0xE, 0x0, 0x0, 0x0, 0x4), 15, nil)
+	r, err := dmm.MeasureReading()
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.234, r.Value, 1e-9)
+	assert.Equal(t, instr.VoltDc, r.Unit)
+	assert.False(t, r.Overload)
+
+	// " OL " Vdc, shown when the input is outside the range
+	dmm.update(frame(0x2, 0x4, 0x0, 0x0, 0x0, 0xE, 0xB, 0x6, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4), 15, nil)
+	r, err = dmm.MeasureReading()
+	assert.NoError(t, err)
+	assert.True(t, r.Overload)
+	assert.Equal(t, instr.VoltDc, r.Unit)
+	assert.False(t, r.Valid())
+
+	// "100°C", where the last digit shows the unit
+	dmm.update(frame(0x2, 0x0, 0x0, 0x0, 0xA, 0xE, 0xB, 0xE, 0xB, 0xE, 0x1, 0x0, 0x0, 0x0, 0x0), 15, nil)
+	r, err = dmm.MeasureReading()
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, r.Value)
+	assert.Equal(t, instr.Celcius, r.Unit)
+
+	// "212°F" is converted to Celcius
+	dmm.update(frame(0x2, 0x0, 0x0, 0xA, 0xD, 0x0, 0xA, 0xA, 0xD, 0xE, 0x4, 0x0, 0x0, 0x0, 0x0), 15, nil)
+	r, err = dmm.MeasureReading()
+	assert.NoError(t, err)
+	assert.InDelta(t, 100.0, r.Value, 1e-9)
+	assert.Equal(t, instr.Celcius, r.Unit)
+
+	// An unknown segment pattern is still an error
+	dmm.update(frame(0x2, 0x4, 0x0, 0x0, 0x0, 0x6, 0x1, 0xE, 0xB, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4), 15, nil)
+	_, err = dmm.MeasureReading()
+	assert.Error(t, err)
+}
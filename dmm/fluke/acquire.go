@@ -0,0 +1,212 @@
+package fluke
+
+// Buffered acquisition. The multimeter takes the readings into its memory on
+// each trigger, without a command for each reading, and they are fetched
+// afterwards with FETC?, or read from the data memory with R? while the
+// acquisition is running. The integration time set by Configure from Setup.Rate
+// and Setup.Resolution allows a few hundred readings per second.
+//
+//	err := dmm.Configure(instr.Setup{Unit: instr.VoltDc, Max: 10, Rate: 100})
+//	readings, err := dmm.Acquire(1000)
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Trigger is the source of the triggers starting the readings
+type Trigger string
+
+// Trigger sources
+const (
+	Immediate Trigger = "IMM" // Triggered at once by INIT
+	Bus       Trigger = "BUS" // Triggered by *TRG, sent by Trigger()
+	External  Trigger = "EXT" // Triggered by the trigger input
+)
+
+// Acquisition is the trigger setup of a buffered acquisition
+type Acquisition struct {
+	Samples  int           // Readings taken for each trigger. Default 1
+	Triggers int           // Triggers accepted before the acquisition is finished. Default 1
+	Source   Trigger       // Default Immediate
+	Delay    time.Duration // Delay from each trigger to the first reading
+}
+
+// maxReadings is the size of the data memory
+const maxReadings = 5000
+
+// Arm sends the trigger setup and starts an acquisition with the configuration set by Configure
+func (f *Fluke) Arm(a Acquisition) error {
+	return f.ArmContext(context.Background(), a)
+}
+
+// ArmContext is Arm that can be cancelled by ctx
+func (f *Fluke) ArmContext(ctx context.Context, a Acquisition) error {
+	if f.setup.Unit == instr.Illegal {
+		return fmt.Errorf("undefined setup")
+	}
+	if a.Samples <= 0 {
+		a.Samples = 1
+	}
+	if a.Triggers <= 0 {
+		a.Triggers = 1
+	}
+	if a.Source == "" {
+		a.Source = Immediate
+	}
+	if a.Samples*a.Triggers > maxReadings {
+		return fmt.Errorf("%d readings is more than the maximum %d", a.Samples*a.Triggers, maxReadings)
+	}
+	ctx = f.Lock(ctx)
+	defer f.Unlock(ctx)
+	cmds := []string{
+		fmt.Sprintf("TRIG:SOUR %s", a.Source),
+		fmt.Sprintf("TRIG:DEL %g", a.Delay.Seconds()),
+		fmt.Sprintf("TRIG:COUN %d", a.Triggers),
+		fmt.Sprintf("SAMP:COUN %d", a.Samples),
+	}
+	for _, c := range cmds {
+		if err := f.WriteContext(ctx, c); err != nil {
+			return err
+		}
+	}
+	f.acq, f.triggers, f.fetched = a, nil, 0
+	if a.Source == Immediate {
+		f.triggers = []time.Time{time.Now()}
+	}
+	return f.WriteContext(ctx, "INIT")
+}
+
+// Trigger sends a bus trigger, taking the samples for one trigger when the source is Bus
+func (f *Fluke) Trigger() error {
+	return f.TriggerContext(context.Background())
+}
+
+// TriggerContext is Trigger that can be cancelled by ctx
+func (f *Fluke) TriggerContext(ctx context.Context) error {
+	ctx = f.Lock(ctx)
+	defer f.Unlock(ctx)
+	if err := f.WriteContext(ctx, "*TRG"); err != nil {
+		return err
+	}
+	if f.acq.Source == Bus {
+		f.triggers = append(f.triggers, time.Now())
+	}
+	return nil
+}
+
+// Fetch waits for the acquisition started by Arm to finish, and returns all the readings.
+// The timeout is extended by the time taking the readings. With Bus or External triggers,
+// the wait for the triggers is limited by the ctx deadline given to FetchContext.
+func (f *Fluke) Fetch() ([]instr.Reading, error) {
+	return f.FetchContext(context.Background())
+}
+
+// FetchContext is Fetch that can be cancelled by ctx
+func (f *Fluke) FetchContext(ctx context.Context) ([]instr.Reading, error) {
+	ctx = f.Lock(ctx)
+	defer f.Unlock(ctx)
+	// The response comes when the acquisition is finished
+	timeout := f.Timeout
+	defer func() { f.Timeout = timeout }()
+	f.Timeout += time.Duration(f.acq.Triggers) * (f.acq.Delay + time.Duration(f.acq.Samples)*f.interval())
+	if d, ok := ctx.Deadline(); ok && f.acq.Source != Immediate {
+		// The triggers can come at any time
+		f.Timeout = max(f.Timeout, time.Until(d))
+	}
+	response, err := f.AskContext(ctx, "FETC?")
+	if err != nil {
+		return nil, err
+	}
+	return f.readings(response, 0)
+}
+
+// ReadMemory returns the readings taken since the previous call, removing them from the data
+// memory, so that a long acquisition can be logged while it is running
+func (f *Fluke) ReadMemory() ([]instr.Reading, error) {
+	return f.ReadMemoryContext(context.Background())
+}
+
+// ReadMemoryContext is ReadMemory that can be cancelled by ctx
+func (f *Fluke) ReadMemoryContext(ctx context.Context) ([]instr.Reading, error) {
+	ctx = f.Lock(ctx)
+	defer f.Unlock(ctx)
+	b, err := f.AskBlockContext(ctx, "R?")
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.readings(string(b), f.fetched)
+	f.fetched += len(r)
+	return r, err
+}
+
+// Acquire takes n readings as fast as the configuration set by Configure allows, and returns
+// them with the time each was taken. The trigger setup is restored afterwards, for Measure.
+func (f *Fluke) Acquire(n int) ([]instr.Reading, error) {
+	return f.AcquireContext(context.Background(), n)
+}
+
+// AcquireContext is Acquire that can be cancelled by ctx
+func (f *Fluke) AcquireContext(ctx context.Context, n int) ([]instr.Reading, error) {
+	ctx = f.Lock(ctx)
+	defer f.Unlock(ctx)
+	if err := f.ArmContext(ctx, Acquisition{Samples: n}); err != nil {
+		return nil, err
+	}
+	r, err := f.FetchContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Configure sets the trigger to a single reading again
+	return r, f.WriteContext(ctx, f.conf)
+}
+
+// readings parses a comma separated list of values. The readings are numbered from first,
+// counting from the start of the acquisition, to find the time they were taken.
+func (f *Fluke) readings(response string, first int) ([]instr.Reading, error) {
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return nil, nil
+	}
+	now := time.Now()
+	values := strings.Split(response, ",")
+	readings := make([]instr.Reading, len(values))
+	for k, s := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reading %q", s)
+		}
+		r := instr.NewReading(v, f.setup.Unit, f.rng)
+		r.Source, r.Chan = f.Name, f.setup.Chan
+		r.Time = f.taken(first+k, now)
+		readings[k] = r
+	}
+	return readings, nil
+}
+
+// taken returns the estimated time reading n was taken, from the trigger times and the
+// integration time. The time received is used when the trigger time is unknown.
+func (f *Fluke) taken(n int, received time.Time) time.Time {
+	samples := max(f.acq.Samples, 1)
+	trigger, sample := n/samples, n%samples
+	var t time.Time
+	switch {
+	case f.acq.Source == Immediate && len(f.triggers) > 0:
+		// The triggers follow each other at once
+		t = f.triggers[0].Add(time.Duration(trigger) * (f.acq.Delay + time.Duration(samples)*f.interval()))
+	case trigger < len(f.triggers):
+		t = f.triggers[trigger]
+	default:
+		return received
+	}
+	t = t.Add(f.acq.Delay + time.Duration(sample+1)*f.interval())
+	if t.After(received) {
+		return received
+	}
+	return t
+}
@@ -0,0 +1,279 @@
+package fluke
+
+// Configuration of the measurement function, range and integration time.
+// A fixed range is given by the largest value to measure, and the lowest
+// range covering it is used. Resolution in digits and Rate in readings per
+// second set the integration time in power line cycles (NPLC) of the dc
+// functions. An error is returned when the rate is above the fastest
+// integration time, or when both can not be satisfied. Capacitance
+// and temperature are only measured by the 8846A.
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// functions maps the units to the measurement functions
+var functions = map[instr.EngUnit]string{
+	instr.VoltDc:       "VOLT:DC",
+	instr.VoltAcRms:    "VOLT:AC",
+	instr.CurrentDc:    "CURR:DC",
+	instr.CurrentAcRms: "CURR:AC",
+	instr.Hz:           "FREQ",
+	instr.Ohm:          "RES",
+	instr.OhmFourWire:  "FRES",
+	instr.Farad:        "CAP",
+	instr.Second:       "PER",
+	instr.Diode:        "DIOD",
+	instr.Continuity:   "CONT",
+}
+
+// sensors maps the temperature sensors to the functions. There is no thermocouple input.
+var sensors = map[instr.Sensor]string{
+	instr.DefaultSensor: "TEMP:RTD",
+	instr.Pt100:         "TEMP:RTD",
+	instr.Pt100FourWire: "TEMP:FRTD",
+}
+
+// ranges are the ranges of the 8845A and 8846A, for the functions having a range
+var ranges = map[string][]float64{
+	"VOLT:DC": {0.1, 1, 10, 100, 1000},
+	"VOLT:AC": {0.1, 1, 10, 100, 750},
+	"CURR:DC": {100e-6, 1e-3, 10e-3, 100e-3, 400e-3, 1, 3, 10},
+	"CURR:AC": {100e-6, 1e-3, 10e-3, 100e-3, 400e-3, 1, 3, 10},
+	"RES":     {10, 100, 1e3, 10e3, 100e3, 1e6, 10e6, 100e6},
+	"FRES":    {10, 100, 1e3, 10e3, 100e3, 1e6, 10e6, 100e6},
+	"CAP":     {1e-9, 10e-9, 100e-9, 1e-6, 10e-6, 100e-6, 1e-3, 10e-3, 100e-3},
+}
+
+// defaultMains is the power line frequency used when Fluke.Mains is not set
+const defaultMains = 50.0
+
+// defaultNplc is the integration time used by the instrument when none is set
+const defaultNplc = 10.0
+
+// nplcDigits are the integration times supported in power line cycles, with the digits they give
+var nplcDigits = []struct {
+	nplc   float64
+	digits float64
+}{
+	{0.02, 4.5}, {0.2, 5.5}, {1, 6.5}, {10, 6.5}, {100, 6.5},
+}
+
+// integrated returns true if the function has an integration time set by NPLC
+func integrated(function string) bool {
+	return function == "VOLT:DC" || function == "CURR:DC" || function == "RES" || function == "FRES"
+}
+
+// selectFunction returns the function measuring the unit of s, checking that the model has it
+func selectFunction(s instr.Setup, model string) (string, error) {
+	if s.Unit != instr.Celcius {
+		if s.Sensor != instr.DefaultSensor {
+			return "", fmt.Errorf("%s is only used for temperature", s.Sensor)
+		}
+		function, ok := functions[s.Unit]
+		if !ok {
+			return "", fmt.Errorf("illegal unit")
+		}
+		if function == "CAP" && model == "8845A" {
+			return "", fmt.Errorf("%s is not supported by the %s", s.Unit, model)
+		}
+		return function, nil
+	}
+	function, ok := sensors[s.Sensor]
+	if !ok {
+		return "", fmt.Errorf("unsupported sensor %s", s.Sensor)
+	}
+	if model == "8845A" {
+		return "", fmt.Errorf("%s is not supported by the %s", s.Unit, model)
+	}
+	return function, nil
+}
+
+// mains returns the power line frequency
+func (f *Fluke) mains() float64 {
+	if f.Mains > 0 {
+		return f.Mains
+	}
+	return defaultMains
+}
+
+// interval returns the estimated time for each reading, or 0 if unknown
+func (f *Fluke) interval() time.Duration {
+	if !integrated(f.function) {
+		return 0
+	}
+	n := f.nplc
+	if n == 0 {
+		n = defaultNplc
+	}
+	return time.Duration(n / f.mains() * float64(time.Second))
+}
+
+// selectRange returns the range argument of CONF, and the range as a number, 0 for autorange.
+// The range is given by Setup.Max or Setup.Range, and must be covered by the ranges of the function.
+func selectRange(function string, s instr.Setup) (string, float64, error) {
+	table := ranges[function]
+	v := s.Max
+	switch r := strings.ToUpper(strings.TrimSpace(s.Range)); r {
+	case "", "AUTO", "DEF":
+		if r != "" && v > 0 {
+			return "", 0, fmt.Errorf("range %s and max %g both given", s.Range, v)
+		}
+	default:
+		if v > 0 {
+			return "", 0, fmt.Errorf("range %s and max %g both given", s.Range, v)
+		}
+		if len(table) > 0 && r == "MIN" {
+			v = table[0]
+		} else if len(table) > 0 && r == "MAX" {
+			v = table[len(table)-1]
+		} else if n, err := strconv.ParseFloat(r, 64); err == nil && n > 0 {
+			v = n
+		} else {
+			return "", 0, fmt.Errorf("illegal range %s", s.Range)
+		}
+	}
+	if v < 0 {
+		return "", 0, fmt.Errorf("illegal range %g", v)
+	}
+	if v > 0 && s.Autorange {
+		return "", 0, fmt.Errorf("autorange and a fixed range both given")
+	}
+	if len(table) == 0 {
+		if v > 0 {
+			return "", 0, fmt.Errorf("%s has no range", s.Unit)
+		}
+		return "", 0, nil
+	}
+	if v == 0 {
+		return "DEF", 0, nil
+	}
+	symbol := s.Unit.Symbol()
+	top := table[len(table)-1]
+	if v > top*1.001 {
+		return "", 0, fmt.Errorf("range %s is above the largest range %s", instr.FormatSI(v, symbol, 3), instr.FormatSI(top, symbol, 3))
+	}
+	// The lowest range covering the value
+	rng := top
+	for k := len(table) - 1; k >= 0 && v <= table[k]*1.001; k-- {
+		rng = table[k]
+	}
+	return strconv.FormatFloat(rng, 'g', -1, 64), rng, nil
+}
+
+// integration returns the integration time in power line cycles giving Setup.Resolution
+// digits at Setup.Rate readings per second, or 0 if neither is given
+func integration(function string, s instr.Setup, mains float64) (float64, error) {
+	if s.Rate <= 0 && s.Resolution <= 0 {
+		return 0, nil
+	}
+	if !integrated(function) {
+		return 0, fmt.Errorf("resolution and rate are not supported for %s", s.Unit)
+	}
+	best := nplcDigits[len(nplcDigits)-1]
+	if s.Resolution > best.digits {
+		return 0, fmt.Errorf("%g digits is more than the maximum %g", s.Resolution, best.digits)
+	}
+	n := defaultNplc
+	if s.Resolution > 0 {
+		// The shortest integration time giving the resolution
+		for _, d := range nplcDigits {
+			if d.digits >= s.Resolution {
+				n = d.nplc
+				break
+			}
+		}
+	}
+	if s.Rate > 0 {
+		if fastest := mains / nplcDigits[0].nplc; s.Rate > fastest*1.001 {
+			return 0, fmt.Errorf("%g readings per second is more than the maximum %g", s.Rate, fastest)
+		}
+		// The longest integration time allowing the rate
+		limit := nplcDigits[0].nplc
+		for _, d := range nplcDigits {
+			if d.nplc/mains <= 1/s.Rate {
+				limit = d.nplc
+			}
+		}
+		if s.Resolution > 0 && digits(limit) < s.Resolution {
+			return 0, fmt.Errorf("%g digits can not be reached at %g readings per second", s.Resolution, s.Rate)
+		}
+		n = math.Min(n, limit)
+	}
+	return n, nil
+}
+
+// digits returns the resolution given by an integration time
+func digits(nplc float64) float64 {
+	for _, d := range nplcDigits {
+		if nplc <= d.nplc*1.001 {
+			return d.digits
+		}
+	}
+	return nplcDigits[len(nplcDigits)-1].digits
+}
+
+// Config queries the configuration used by the instrument. Max is the range used, also in
+// autorange, and Resolution and Rate are given by the integration time of the dc functions.
+func (f *Fluke) Config() (instr.Setup, error) {
+	return f.ConfigContext(context.Background())
+}
+
+// ConfigContext is Config that can be cancelled by ctx
+func (f *Fluke) ConfigContext(ctx context.Context) (instr.Setup, error) {
+	ctx = f.Lock(ctx)
+	defer f.Unlock(ctx)
+	response, err := f.AskContext(ctx, "CONF?")
+	if err != nil {
+		return instr.Setup{}, err
+	}
+	// The response is like "VOLT:DC +1.00000000E+01,+3.00000000E-06"
+	function, args, _ := strings.Cut(strings.Trim(strings.TrimSpace(response), "\""), " ")
+	if function == "VOLT" || function == "CURR" {
+		function += ":DC"
+	}
+	s := instr.Setup{Chan: instr.Ch1}
+	for u, fn := range functions {
+		if fn == function {
+			s.Unit = u
+		}
+	}
+	switch function {
+	case "TEMP:RTD":
+		s.Unit, s.Sensor = instr.Celcius, instr.Pt100
+	case "TEMP:FRTD":
+		s.Unit, s.Sensor = instr.Celcius, instr.Pt100FourWire
+	}
+	if s.Unit == instr.Illegal {
+		return instr.Setup{}, fmt.Errorf("unknown function %s", function)
+	}
+	if len(ranges[function]) > 0 {
+		r, _, _ := strings.Cut(args, ",")
+		if s.Max, err = strconv.ParseFloat(strings.TrimSpace(r), 64); err != nil {
+			return instr.Setup{}, fmt.Errorf("invalid range %q", r)
+		}
+		auto, err := f.AskContext(ctx, "%s:RANG:AUTO?", function)
+		if err != nil {
+			return instr.Setup{}, err
+		}
+		s.Autorange = strings.TrimSpace(auto) == "1"
+	}
+	if integrated(function) {
+		n, err := f.PollFloatContext(ctx, "%s:NPLC?", function)
+		if err != nil {
+			return instr.Setup{}, err
+		}
+		if n <= 0 {
+			return instr.Setup{}, fmt.Errorf("invalid integration time %g", n)
+		}
+		s.Resolution, s.Rate = digits(n), f.mains()/n
+	}
+	return s, nil
+}
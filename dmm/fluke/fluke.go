@@ -1,6 +1,7 @@
 package fluke
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -12,11 +13,34 @@ import (
 // Check if tti interface satisfies Psu interface
 var _ instr.Dmm = &Fluke{}
 
+// driver registers the supported models, so that instr.Open can find them
+var driver = instr.Driver{Name: "fluke", Models: []string{"FLUKE,884?A"}, Eol: instr.Lf}
+
+func init() {
+	driver.New = func(port string) (instr.Instrument, error) {
+		dmm, err := New(port)
+		if err != nil {
+			return nil, err
+		}
+		return dmm, nil
+	}
+	instr.Register(driver)
+}
+
 // Fluke stores setup for a Fluke multimeter
 type Fluke struct {
 	instr.Connection
-	setup   instr.Setup
-	request string // The request string is set by calling Configure()
+	setup    instr.Setup
+	request  string  // The request string is set by calling Configure()
+	conf     string  // The configuration command sent by Configure(), sent again after a reconnect
+	function string  // The function sent by Configure(), like VOLT:DC
+	rng      float64 // The range sent by Configure(), 0 for autorange
+	nplc     float64 // The integration time sent by Configure(), 0 for the default
+	Mains    float64 // The power line frequency in Hz, giving the integration time. Default 50
+
+	acq      Acquisition // The acquisition started by Arm()
+	triggers []time.Time // The times of the triggers sent
+	fetched  int         // The number of readings read from the data memory
 }
 
 // New will return an instrument instance
@@ -25,39 +49,55 @@ func New(port string) (*Fluke, error) {
 	dmm.Port = port
 	dmm.Timeout = 3000 * time.Millisecond
 	dmm.Eol = instr.Lf
+	// A wait of 50mS is needed to avoid error on the instrument
+	dmm.Pacing.Gap = 50 * time.Millisecond
+	dmm.Reconnect.Init = dmm.reinit
 	err := dmm.Open(port)
 	if err != nil {
 		return nil, fmt.Errorf("error opening port, %s", err)
 	}
 	_ = dmm.Write("SYST:REM")
 	_ = dmm.Write("*RST")
-	time.Sleep(time.Millisecond * 50)
-	dmm.Name, err = dmm.Ask("*IDN?")
-	time.Sleep(time.Millisecond * 50)
+	id, err := dmm.Identify()
 	if err != nil {
+		dmm.Connection.Close()
 		return nil, fmt.Errorf("no instrument found at %s", err)
 	}
-	if !strings.HasPrefix(dmm.Name, "FLUKE") {
+	if !driver.Match(id) {
+		dmm.Connection.Close()
 		return nil, fmt.Errorf("port %s has not a Fluke multimeter connected", port)
 	}
 	return dmm, nil
 }
 
+// reinit will set remote mode and restore the configuration after a reconnect
+func (f *Fluke) reinit(ctx context.Context) error {
+	if err := f.WriteContext(ctx, "SYST:REM"); err != nil {
+		return err
+	}
+	if f.conf == "" {
+		return nil
+	}
+	return f.WriteContext(ctx, f.conf)
+}
+
 // Close will set the instrument to local and close connection
 func (f *Fluke) Close() {
-	time.Sleep(time.Millisecond * 50)
 	_ = f.Write("SYST:LOC")
 }
 
 // Measure will do a measurement according to Configure(setup)
 func (f *Fluke) Measure() (float64, error) {
+	return f.MeasureContext(context.Background())
+}
+
+// MeasureContext will do a measurement that can be cancelled by ctx
+func (f *Fluke) MeasureContext(ctx context.Context) (float64, error) {
 	if f.setup.Unit == instr.Illegal {
 		return 0.0, fmt.Errorf("undefined setup")
 	}
-	// A wait of 50mS is needed to avoid error on the instrument
-	time.Sleep(time.Millisecond * 50)
 	// Do actual measurement
-	response, err := f.Ask(f.request)
+	response, err := f.AskContext(ctx, f.request)
 	if err != nil {
 		return 0.0, err
 	}
@@ -66,45 +106,58 @@ func (f *Fluke) Measure() (float64, error) {
 	return volt, err
 }
 
-// Configure will select unit to measure and range etc.
+// MeasureReading will do a measurement, returning the value with unit, range and time
+func (f *Fluke) MeasureReading() (instr.Reading, error) {
+	return f.MeasureReadingContext(context.Background())
+}
+
+// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+func (f *Fluke) MeasureReadingContext(ctx context.Context) (instr.Reading, error) {
+	v, err := f.MeasureContext(ctx)
+	if err != nil {
+		return instr.Reading{}, err
+	}
+	r := instr.NewReading(v, f.setup.Unit, f.rng)
+	r.Source, r.Chan = f.Name, f.setup.Chan
+	return r, nil
+}
+
+// Configure will select unit to measure, range and integration time. A fixed range is given
+// by Max, or by Range for compatibility, and autorange is used if none is given.
+// Temperature is measured with a 2- or 4-wire Pt100 given by Sensor, 2-wire by default.
+// The configuration is sent to the instrument, so that errors are reported in strict mode.
 func (f *Fluke) Configure(s instr.Setup) error {
 	if s.Chan == 0 {
 		s.Chan = 1
 	}
 	if s.Chan > 1 || s.Chan < 1 {
-		return fmt.Errorf("%d is illegal channel", f.setup.Chan)
+		return fmt.Errorf("%d is illegal channel", s.Chan)
 	}
-	r := s.Range
-	if s.Unit == instr.VoltDc {
-		if r == "" {
-			r = "100.0"
-		}
-		f.request = fmt.Sprintf("MEAS:VOLT:DC? %s", r)
-	} else if s.Unit == instr.VoltAcRms {
-		if r == "" {
-			r = "10.0"
-		}
-		f.request = fmt.Sprintf("MEAS:VOLT:AC? %s", r)
-	} else if s.Unit == instr.CurrentDc {
-		if r == "" {
-			r = "10.0"
-		}
-		f.request = fmt.Sprintf("MEAS:CURR:DC? %s", r)
-	} else if s.Unit == instr.CurrentAcRms {
-		if r == "" {
-			r = "10.0"
-		}
-		f.request = fmt.Sprintf("MEAS:CURR:AC? %s", r)
-	} else if s.Unit == instr.Hz {
-		f.request = "MEAS:FREQ?"
-	} else if s.Unit == instr.Ohm {
-		if r == "" {
-			r = "10000000.0"
-		}
-		f.request = fmt.Sprintf("MEAS:RES? %s", r)
-	} else {
-		return fmt.Errorf("illegal unit")
+	function, err := selectFunction(s, instr.ParseIdentity(f.Name).Model)
+	if err != nil {
+		return err
+	}
+	r, rng, err := selectRange(function, s)
+	if err != nil {
+		return err
+	}
+	nplc, err := integration(function, s, f.mains())
+	if err != nil {
+		return err
+	}
+	conf := "CONF:" + function
+	if r != "" {
+		conf += " " + r
+	}
+	if nplc > 0 {
+		conf += fmt.Sprintf(";:%s:NPLC %g", function, nplc)
+	}
+	if err := f.Write(conf); err != nil {
+		return err
 	}
+	f.conf = conf
+	f.request = "READ?"
 	f.setup = s
+	f.function, f.rng, f.nplc = function, rng, nplc
 	return nil
 }
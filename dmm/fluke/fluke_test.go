@@ -1,11 +1,20 @@
 package fluke_test
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jkvatne/go-measure/dmm/fluke"
+	"github.com/jkvatne/go-measure/fault"
 	"github.com/jkvatne/go-measure/instr"
+	"github.com/jkvatne/go-measure/sim"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -49,3 +58,417 @@ func TestFluke(t *testing.T) {
 
 	d.Close()
 }
+
+// TestFlukeReplay runs the driver against a transcript recorded from the simulator, so no instrument is needed
+func TestFlukeReplay(t *testing.T) {
+	d, err := fluke.New("replay://testdata/fluke.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "FLUKE,8845A,2359004,08/02/10-11:53", d.Name)
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc}))
+	volt, err := d.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 1.23456789e-3, volt)
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.Ohm, Range: "1000"}))
+	ohm, err := d.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 999.876543, ohm)
+	d.Close()
+}
+
+// TestFlukeSim runs the driver against the simulated multimeter
+func TestFlukeSim(t *testing.T) {
+	m := sim.NewFluke8845()
+	srv, err := sim.Listen(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	m.Set("VOLT:DC", 1.5)
+	m.Set("RES", 10000)
+	d, err := fluke.New(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, m.Remote(), "SYST:REM not sent")
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc}))
+	volt, err := d.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, volt)
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.Ohm, Range: "10000"}))
+	ohm, err := d.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 10000.0, ohm)
+	// The value is above the range
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.Ohm, Range: "1000"}))
+	ohm, err = d.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 9.9e37, ohm)
+	r, err := d.MeasureReading()
+	assert.NoError(t, err)
+	assert.True(t, r.Overload)
+	assert.Equal(t, instr.Ohm, r.Unit)
+	assert.Equal(t, 1000.0, r.Range)
+	assert.Equal(t, "FLUKE,8845A,2359004,08/02/10-11:53", r.Source)
+	// A fixed range of 100V
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Max: 100}))
+	r, err = d.MeasureReading()
+	assert.NoError(t, err)
+	assert.Equal(t, instr.Reading{Value: 1.5, Unit: instr.VoltDc, Time: r.Time, Range: 100, Underrange: true, Source: r.Source, Chan: instr.Ch1}, r)
+	// Autorange is the default
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc}))
+	r, err = d.MeasureReading()
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, r.Range)
+	assert.False(t, r.Underrange)
+	d.Close()
+	assert.Eventually(t, func() bool { return !m.Remote() }, time.Second, time.Millisecond, "SYST:LOC not sent")
+}
+
+// TestFlukeSimReconnect checks that the multimeter is set up again after a lost connection
+func TestFlukeSimReconnect(t *testing.T) {
+	m := sim.NewFluke8845()
+	srv, err := sim.Listen(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	m.Set("VOLT:DC", 1.5)
+	d, err := fluke.New("tcp://" + srv.Addr() + "?reconnect=2")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var events []instr.ReconnectEvent
+	d.Reconnect.Delay = time.Millisecond
+	d.Reconnect.Notify = func(e instr.ReconnectEvent) { events = append(events, e) }
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc}))
+	assert.NoError(t, d.Write("SYST:LOC"))
+	s := fault.NewSchedule(1)
+	fault.Inject(&d.Connection, s)
+	s.At(1, fault.Disconnect)
+	volt, err := d.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, volt)
+	assert.True(t, m.Remote(), "SYST:REM not sent after reconnect")
+	if assert.Len(t, events, 1) {
+		assert.NoError(t, events[0].Err)
+	}
+}
+
+// TestFlukeSimOpen checks that the multimeter is found by instr.Open
+// TestFlukeNewReleases checks that the connection is closed when New finds another instrument
+func TestFlukeNewReleases(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	closed := make(chan bool, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			closed <- false
+			return
+		}
+		defer c.Close()
+		_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(c)
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				// Closed by the driver, or the deadline passed
+				closed <- errors.Is(err, io.EOF)
+				return
+			}
+			if strings.TrimSpace(s) == "*IDN?" {
+				_, _ = c.Write([]byte("ACME,X1,1234,1.0\n"))
+			}
+		}
+	}()
+	_, err = fluke.New(l.Addr().String())
+	assert.Error(t, err)
+	assert.True(t, <-closed, "connection not closed by the failed New")
+}
+
+func TestFlukeSimOpen(t *testing.T) {
+	srv, err := sim.Listen(sim.NewFluke8845())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	inst, err := instr.Open("tcp://" + srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer inst.Close()
+	assert.IsType(t, &fluke.Fluke{}, inst)
+	_, ok := inst.(instr.Dmm)
+	assert.True(t, ok)
+}
+
+// TestFlukeSimConfig checks the range, resolution and rate against the simulated multimeter
+func TestFlukeSimConfig(t *testing.T) {
+	m := sim.NewFluke8845()
+	srv, err := sim.Listen(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	m.Set("VOLT:DC", 1.5)
+	m.Set("CURR:DC", 0.25)
+	d, err := fluke.New(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d.Close()
+	// Autorange selects the 10V range
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Autorange: true}))
+	s, err := d.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, instr.Setup{Chan: instr.Ch1, Unit: instr.VoltDc, Max: 10, Autorange: true, Resolution: 6.5, Rate: 5}, s)
+	// The lowest range covering 0.25A is 400mA, and 6.5 digits gives 1 NPLC
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.CurrentDc, Max: 0.25, Resolution: 6.5}))
+	s, err = d.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, instr.Setup{Chan: instr.Ch1, Unit: instr.CurrentDc, Max: 0.4, Resolution: 6.5, Rate: 50}, s)
+	r, err := d.MeasureReading()
+	assert.NoError(t, err)
+	assert.Equal(t, 0.4, r.Range)
+	// The highest rate is given by 0.02 NPLC, 2500 readings per second at 50Hz
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Rate: 2500}))
+	s, err = d.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, 2500.0, s.Rate)
+	assert.ErrorContains(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Rate: 2600}), "more than the maximum 2500")
+	// The resolution at the highest rate allowing it, and MIN gives the lowest range
+	d.Mains = 60
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.Ohm, Range: "MIN", Resolution: 5.5, Rate: 300}))
+	s, err = d.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, instr.Setup{Chan: instr.Ch1, Unit: instr.Ohm, Max: 10, Resolution: 5.5, Rate: 300}, s)
+	assert.Equal(t, 0.2, m.Nplc("RES"))
+
+	for _, bad := range []instr.Setup{
+		{Unit: instr.VoltDc, Max: 1001},
+		{Unit: instr.VoltDc, Max: -1},
+		{Unit: instr.VoltDc, Max: 10, Autorange: true},
+		{Unit: instr.VoltDc, Range: "10", Max: 10},
+		{Unit: instr.VoltDc, Range: "ten"},
+		{Unit: instr.VoltDc, Resolution: 7.5},
+		{Unit: instr.Ohm, Resolution: 6.5, Rate: 300},
+		{Unit: instr.VoltDc, Rate: 5000},
+		{Unit: instr.VoltAcRms, Rate: 10},
+		{Unit: instr.Hz, Max: 10},
+		{Unit: instr.Watt},
+		{Unit: instr.VoltDc, Chan: 2},
+	} {
+		assert.Error(t, d.Configure(bad), "%+v", bad)
+	}
+	// The configuration is not changed by an error
+	s, err = d.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, instr.Ohm, s.Unit)
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.Hz}))
+	s, err = d.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, instr.Setup{Chan: instr.Ch1, Unit: instr.Hz}, s)
+}
+
+// TestFlukeSimFunctions checks four-wire resistance, capacitance, temperature, period,
+// diode and continuity against the simulated 8846A, and that the 8845A rejects some of them
+func TestFlukeSimFunctions(t *testing.T) {
+	m := sim.NewFluke8846()
+	srv, err := sim.Listen(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	m.Set("FRES", 99.5)
+	m.Set("CAP", 4.7e-6)
+	m.Set("TEMP", 21.5)
+	m.Set("PER", 0.02)
+	m.Set("DIOD", 0.62)
+	m.Set("CONT", 3.5)
+	d, err := fluke.New(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d.Close()
+	for _, test := range []struct {
+		setup instr.Setup
+		value float64
+		rng   float64
+	}{
+		{instr.Setup{Unit: instr.OhmFourWire, Max: 100, Resolution: 6.5}, 99.5, 100},
+		{instr.Setup{Unit: instr.Farad, Max: 5e-6}, 4.7e-6, 10e-6},
+		{instr.Setup{Unit: instr.Celcius}, 21.5, 0},
+		{instr.Setup{Unit: instr.Celcius, Sensor: instr.Pt100FourWire}, 21.5, 0},
+		{instr.Setup{Unit: instr.Second}, 0.02, 0},
+		{instr.Setup{Unit: instr.Diode}, 0.62, 0},
+		{instr.Setup{Unit: instr.Continuity}, 3.5, 0},
+	} {
+		if !assert.NoError(t, d.Configure(test.setup), "%+v", test.setup) {
+			continue
+		}
+		r, err := d.MeasureReading()
+		assert.NoError(t, err)
+		assert.Equal(t, test.value, r.Value, "%+v", test.setup)
+		assert.Equal(t, test.setup.Unit, r.Unit)
+		assert.Equal(t, test.rng, r.Range)
+		s, err := d.Config()
+		assert.NoError(t, err)
+		assert.Equal(t, test.setup.Unit, s.Unit)
+		if test.setup.Unit == instr.Celcius && test.setup.Sensor != instr.DefaultSensor {
+			assert.Equal(t, test.setup.Sensor, s.Sensor)
+		}
+	}
+	assert.Equal(t, 1.0, m.Nplc("FRES"))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.Celcius, Max: 100}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.Diode, Rate: 10}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Sensor: instr.Pt100}))
+	assert.Error(t, d.Configure(instr.Setup{Unit: instr.Celcius, Sensor: instr.Sensor(99)}))
+	// There is no thermocouple input
+	for _, tc := range []instr.Sensor{instr.ThermocoupleJ, instr.ThermocoupleK, instr.ThermocoupleT, instr.ThermocoupleE} {
+		assert.ErrorContains(t, d.Configure(instr.Setup{Unit: instr.Celcius, Sensor: tc}), "unsupported sensor")
+	}
+
+	// The 8845A has no capacitance or temperature
+	m45 := sim.NewFluke8845()
+	srv45, err := sim.Listen(m45)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv45.Close()
+	d45, err := fluke.New(srv45.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d45.Close()
+	assert.Error(t, d45.Configure(instr.Setup{Unit: instr.Farad}))
+	assert.Error(t, d45.Configure(instr.Setup{Unit: instr.Celcius}))
+	assert.NoError(t, d45.Configure(instr.Setup{Unit: instr.OhmFourWire}))
+}
+
+// TestFlukeSimAcquire checks buffered and triggered acquisition against the simulated multimeter
+func TestFlukeSimAcquire(t *testing.T) {
+	m := sim.NewFluke8845()
+	srv, err := sim.Listen(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	m.Set("VOLT:DC", 1.5)
+	d, err := fluke.New(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d.Close()
+	_, err = d.Acquire(10)
+	assert.Error(t, err, "Acquire before Configure")
+	// 100 readings per second gives 0.2 NPLC at 50Hz
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Range: "10", Rate: 100}))
+	start := time.Now()
+	r, err := d.Acquire(10)
+	assert.NoError(t, err)
+	if assert.Len(t, r, 10) {
+		assert.Equal(t, 1.5, r[0].Value)
+		assert.Equal(t, instr.VoltDc, r[9].Unit)
+		assert.Equal(t, 10.0, r[9].Range)
+		assert.Equal(t, 4*time.Millisecond, r[1].Time.Sub(r[0].Time))
+		assert.False(t, r[0].Time.Before(start))
+	}
+	// Measure gives a single reading after Acquire
+	volt, err := d.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, volt)
+	// The resolution gives the integration time when no rate is given
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Range: "10", Resolution: 5.5}))
+	assert.NoError(t, d.Arm(fluke.Acquisition{Samples: 2}))
+	assert.Equal(t, 0.2, m.Nplc("VOLT:DC"))
+	r, err = d.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, r, 2)
+
+	// Two bus triggers with 3 samples each, read from the data memory
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Range: "10"}))
+	assert.NoError(t, d.Arm(fluke.Acquisition{Samples: 3, Triggers: 2, Source: fluke.Bus}))
+	r, err = d.ReadMemory()
+	assert.NoError(t, err)
+	assert.Empty(t, r, "readings before trigger")
+	assert.NoError(t, d.Trigger())
+	first, err := d.ReadMemory()
+	assert.NoError(t, err)
+	m.Set("VOLT:DC", 2.5)
+	assert.NoError(t, d.Trigger())
+	r, err = d.ReadMemory()
+	assert.NoError(t, err)
+	if assert.Len(t, first, 3) && assert.Len(t, r, 3) {
+		assert.Equal(t, 1.5, first[2].Value)
+		assert.Equal(t, 2.5, r[0].Value)
+		assert.True(t, r[0].Time.After(first[2].Time))
+	}
+	r, err = d.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, r, 6)
+	r, err = d.ReadMemory()
+	assert.NoError(t, err)
+	assert.Empty(t, r, "memory not emptied by R?")
+	assert.Error(t, d.Arm(fluke.Acquisition{Samples: 100, Triggers: 100}))
+}
+
+// slowFetch is a simulated multimeter answering FETC? after a delay, like a meter still measuring
+type slowFetch struct {
+	*sim.Fluke8845
+	delay time.Duration
+}
+
+func (s slowFetch) Receive(data []byte) []byte {
+	if strings.Contains(strings.ToUpper(string(data)), "FETC?") {
+		time.Sleep(s.delay)
+	}
+	return s.Fluke8845.Receive(data)
+}
+
+// TestFlukeSimFetchTimeout checks that Fetch waits for the readings with every trigger source
+func TestFlukeSimFetchTimeout(t *testing.T) {
+	m := slowFetch{Fluke8845: sim.NewFluke8845(), delay: 600 * time.Millisecond}
+	srv, err := sim.Listen(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	d, err := fluke.New(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d.Close()
+	d.Timeout = 200 * time.Millisecond
+	// 10 NPLC at 50Hz gives 200ms for each reading
+	assert.NoError(t, d.Configure(instr.Setup{Unit: instr.VoltDc, Max: 10}))
+	assert.NoError(t, d.Arm(fluke.Acquisition{Samples: 5, Source: fluke.Bus}))
+	assert.NoError(t, d.Trigger())
+	r, err := d.Fetch()
+	assert.NoError(t, err)
+	assert.Len(t, r, 5)
+	assert.Equal(t, 200*time.Millisecond, d.Timeout)
+
+	// Waiting for an external trigger is limited by the ctx deadline
+	srv2, err := sim.Listen(slowFetch{Fluke8845: sim.NewFluke8845(), delay: time.Second})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv2.Close()
+	d2, err := fluke.New(srv2.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer d2.Close()
+	d2.Timeout = 200 * time.Millisecond
+	assert.NoError(t, d2.Configure(instr.Setup{Unit: instr.VoltDc, Max: 10}))
+	assert.NoError(t, d2.Arm(fluke.Acquisition{Source: fluke.External}))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = d2.FetchContext(ctx)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,120 @@
+package fault
+
+import (
+	"context"
+	"io"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Conn wraps the connection to an instrument, injecting faults in each Read and Write.
+// A timeout loses the data received, and garbled or dropped characters are changed in
+// the data read or written.
+type Conn struct {
+	injector
+	conn io.ReadWriteCloser
+}
+
+// NewConn returns a connection injecting faults from the schedule in the traffic on conn
+func NewConn(conn io.ReadWriteCloser, schedule *Schedule) *Conn {
+	return &Conn{injector: injector{schedule: schedule}, conn: conn}
+}
+
+// Inject will wrap the connection of c, so that faults are injected. The instrument must
+// be opened first, and faults are also injected after it is reopened by instr.Reconnect.
+// It is normally used with the Connection embedded in a driver:
+//
+//	fault.Inject(&fluke.Connection, schedule)
+func Inject(c *instr.Connection, schedule *Schedule) {
+	c.Wrap(func(conn io.ReadWriteCloser) io.ReadWriteCloser {
+		return NewConn(conn, schedule)
+	})
+}
+
+// Unwrap returns the connection to the instrument
+func (c *Conn) Unwrap() io.ReadWriteCloser {
+	return c.conn
+}
+
+// close closes the underlying connection
+func (c *Conn) close() {
+	_ = c.conn.Close()
+}
+
+// Write sends b to the instrument, unless there is a fault
+func (c *Conn) Write(b []byte) (int, error) {
+	kind, err := c.fault(context.Background(), "Write", c.close)
+	if err != nil {
+		return 0, err
+	}
+	switch kind {
+	case Garble:
+		b = c.garble(b)
+	case Drop:
+		b = c.drop(b)
+	}
+	n, err := c.conn.Write(b)
+	if kind == Drop && err == nil {
+		// The caller should not see that a character was lost
+		n++
+	}
+	return n, err
+}
+
+// Read reads from the instrument, and then injects the fault
+func (c *Conn) Read(b []byte) (int, error) {
+	kind, err := c.fault(context.Background(), "Read", c.close)
+	if kind == Timeout {
+		// The data is lost, so that the caller sees the timeout
+		_, _ = c.conn.Read(b)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.conn.Read(b)
+	if n > 0 {
+		switch kind {
+		case Garble:
+			copy(b, c.garble(b[:n]))
+		case Drop:
+			n = copy(b, c.drop(b[:n]))
+		}
+	}
+	return n, err
+}
+
+// Close closes the connection to the instrument
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	closed := c.closed
+	c.closed = true
+	c.mutex.Unlock()
+	if closed {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// garble returns a copy of b with one character replaced by another printable character
+func (c *Conn) garble(b []byte) []byte {
+	g := append([]byte(nil), b...)
+	if len(g) == 0 {
+		return g
+	}
+	k := c.schedule.intn(len(g))
+	ch := byte('!' + c.schedule.intn('~'-'!'))
+	if ch >= g[k] {
+		ch++
+	}
+	g[k] = ch
+	return g
+}
+
+// drop returns a copy of b with one character removed
+func (c *Conn) drop(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	k := c.schedule.intn(len(b))
+	return append(append([]byte(nil), b[:k]...), b[k+1:]...)
+}
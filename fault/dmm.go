@@ -0,0 +1,71 @@
+package fault
+
+import (
+	"context"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Check if Dmm satisfies the Dmm interface
+var _ instr.Dmm = &Dmm{}
+
+// Dmm is a multimeter decorator injecting faults
+type Dmm struct {
+	injector
+	dmm instr.Dmm
+}
+
+// NewDmm returns dmm with faults injected from the schedule
+func NewDmm(dmm instr.Dmm, schedule *Schedule) *Dmm {
+	return &Dmm{injector: injector{schedule: schedule}, dmm: dmm}
+}
+
+// Configure will configure the multimeter, unless the command is lost
+func (d *Dmm) Configure(setup instr.Setup) error {
+	lost, err := d.command(context.Background(), "Configure", d.dmm.Close)
+	if lost || err != nil {
+		return err
+	}
+	return d.dmm.Configure(setup)
+}
+
+// Measure will do a measurement, unless there is a fault
+func (d *Dmm) Measure() (float64, error) {
+	return d.MeasureContext(context.Background())
+}
+
+// MeasureContext is Measure that can be cancelled by ctx
+func (d *Dmm) MeasureContext(ctx context.Context) (float64, error) {
+	if err := d.query(ctx, "Measure", d.dmm.Close); err != nil {
+		return 0.0, err
+	}
+	return d.dmm.MeasureContext(ctx)
+}
+
+// MeasureReading will do a measurement, unless there is a fault
+func (d *Dmm) MeasureReading() (instr.Reading, error) {
+	return d.MeasureReadingContext(context.Background())
+}
+
+// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+func (d *Dmm) MeasureReadingContext(ctx context.Context) (instr.Reading, error) {
+	if err := d.query(ctx, "MeasureReading", d.dmm.Close); err != nil {
+		return instr.Reading{}, err
+	}
+	return d.dmm.MeasureReadingContext(ctx)
+}
+
+// QueryIdn returns the name of the multimeter, unless there is a fault
+func (d *Dmm) QueryIdn() (string, error) {
+	if err := d.query(context.Background(), "QueryIdn", d.dmm.Close); err != nil {
+		return "", err
+	}
+	return d.dmm.QueryIdn()
+}
+
+// Close will close the multimeter, unless it is disconnected
+func (d *Dmm) Close() {
+	if !d.disconnected() {
+		d.dmm.Close()
+	}
+}
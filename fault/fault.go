@@ -0,0 +1,200 @@
+// Package fault injects faults in the communication with instruments, to test that
+// test sequences recover from timeouts, garbled responses, lost bytes, disconnects and
+// latency, like those seen with flaky USB-serial adapters.
+//
+// The faults are decided by a Schedule, which draws them at random with a given seed,
+// or at given operation numbers, so that a test gives the same faults each time it runs.
+// The schedule is used by a decorator for a instr.Dmm, instr.Psu or instr.Scope, or by
+// a Conn wrapping the connection of an instr.Connection:
+//
+//	s := fault.NewSchedule(1)
+//	s.Timeout = 0.05
+//	s.At(3, fault.Disconnect)
+//	dmm := fault.NewDmm(fluke, s)
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Kind is a type of fault
+type Kind int
+
+const (
+	// None is no fault
+	None Kind = iota
+	// Timeout makes the operation fail with instr.ErrTimeout after the Delay.
+	// The response is lost.
+	Timeout
+	// Garble changes a character in the data
+	Garble
+	// Drop removes a character from the data
+	Drop
+	// Disconnect closes the connection, and the following operations fail with instr.ErrClosed
+	Disconnect
+	// Latency delays the operation by the Delay
+	Latency
+)
+
+var kindNames = [...]string{"none", "timeout", "garble", "drop", "disconnect", "latency"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("fault(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// ErrGarbled is returned by the decorators when a response is garbled
+var ErrGarbled = errors.New("garbled response")
+
+// Event is a fault injected
+type Event struct {
+	Op   int    // Operation number, starting at 1
+	Name string // The operation, like Measure or Read
+	Kind Kind
+}
+
+// Schedule decides the fault for each operation. The probabilities and delay
+// should be set before use. Explicit faults set by At are used before the
+// random ones. A schedule can be shared by several decorators.
+type Schedule struct {
+	Timeout    float64       // Probability of a timeout
+	Garble     float64       // Probability of a garbled response or command
+	Drop       float64       // Probability of a lost character
+	Disconnect float64       // Probability of a disconnect
+	Latency    float64       // Probability of a delay
+	Delay      time.Duration // Delay for latency and timeout faults
+	mutex      sync.Mutex
+	rand       *rand.Rand
+	at         map[int]Kind
+	count      int
+	events     []Event
+}
+
+// NewSchedule returns a schedule without faults, using the given seed for random faults
+func NewSchedule(seed int64) *Schedule {
+	return &Schedule{rand: rand.New(rand.NewSource(seed)), at: map[int]Kind{}, Delay: 100 * time.Millisecond}
+}
+
+// At sets the fault for operation number op, where 1 is the first operation
+func (s *Schedule) At(op int, kind Kind) *Schedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.at[op] = kind
+	return s
+}
+
+// Events returns the faults injected so far
+func (s *Schedule) Events() []Event {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// Count returns the number of operations so far
+func (s *Schedule) Count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// next returns the fault for the next operation
+func (s *Schedule) next(name string) Kind {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	kind, ok := s.at[s.count]
+	if !ok {
+		u := s.rand.Float64()
+		for k, p := range []float64{s.Timeout, s.Garble, s.Drop, s.Disconnect, s.Latency} {
+			if u < p {
+				kind = Kind(k + 1)
+				break
+			}
+			u -= p
+		}
+	}
+	if kind != None {
+		s.events = append(s.events, Event{Op: s.count, Name: name, Kind: kind})
+	}
+	return kind
+}
+
+// intn returns a random number from 0 to n-1
+func (s *Schedule) intn(n int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rand.Intn(n)
+}
+
+// injector is the fault state of a decorator
+type injector struct {
+	schedule *Schedule
+	mutex    sync.Mutex
+	closed   bool
+}
+
+// disconnected returns true after a disconnect fault
+func (in *injector) disconnected() bool {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	return in.closed
+}
+
+// fault returns the fault for an operation, after waiting for latency and timeouts.
+// Disconnect calls close the first time. The error is set for faults that always
+// fail, while garbled and dropped data is left to the caller.
+func (in *injector) fault(ctx context.Context, name string, close func()) (Kind, error) {
+	if in.disconnected() {
+		return Disconnect, fmt.Errorf("%s, %w", name, instr.ErrClosed)
+	}
+	kind := in.schedule.next(name)
+	switch kind {
+	case Latency:
+		return kind, instr.Sleep(ctx, in.schedule.Delay)
+	case Timeout:
+		if err := instr.Sleep(ctx, in.schedule.Delay); err != nil {
+			return kind, err
+		}
+		return kind, fmt.Errorf("%s, %w (injected)", name, instr.ErrTimeout)
+	case Disconnect:
+		in.mutex.Lock()
+		in.closed = true
+		in.mutex.Unlock()
+		close()
+		return kind, fmt.Errorf("%s, %w (injected)", name, instr.ErrClosed)
+	}
+	return kind, nil
+}
+
+// query returns the error for an operation reading from the instrument.
+// Garbled and dropped data gives errors, as they would not be parsed.
+func (in *injector) query(ctx context.Context, name string, close func()) error {
+	kind, err := in.fault(ctx, name, close)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case Garble:
+		return fmt.Errorf("%s, %w (injected)", name, ErrGarbled)
+	case Drop:
+		return fmt.Errorf("%s, %w (injected)", name, instr.ErrShortRead)
+	}
+	return nil
+}
+
+// command returns the error for an operation only sending to the instrument. A garbled
+// or dropped character makes the instrument ignore the command, so lost is set, but no
+// error is returned.
+func (in *injector) command(ctx context.Context, name string, close func()) (lost bool, err error) {
+	kind, err := in.fault(ctx, name, close)
+	return kind == Garble || kind == Drop, err
+}
@@ -0,0 +1,130 @@
+package fault_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jkvatne/go-measure/fault"
+	"github.com/jkvatne/go-measure/instr"
+	"github.com/jkvatne/go-measure/sim"
+	"github.com/jkvatne/go-measure/virtual"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// connect returns a connection to a simulated multimeter with faults from s
+func connect(t *testing.T, s *fault.Schedule) *instr.Connection {
+	srv, err := sim.Listen(sim.NewFluke8845())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(srv.Close)
+	c := &instr.Connection{Timeout: 200 * time.Millisecond, Eol: instr.Lf}
+	if !assert.NoError(t, c.Open(srv.Addr())) {
+		t.FailNow()
+	}
+	t.Cleanup(c.Close)
+	fault.Inject(c, s)
+	return c
+}
+
+func TestConn(t *testing.T) {
+	s := fault.NewSchedule(1)
+	s.Delay = time.Millisecond
+	c := connect(t, s)
+	idn, err := c.Ask("*IDN?")
+	assert.NoError(t, err)
+	assert.Contains(t, idn, "FLUKE")
+	n := s.Count()
+	assert.Equal(t, 2, n, "one write and one read")
+	// The response to the write is lost
+	s.At(n+2, fault.Timeout)
+	_, err = c.Ask("*IDN?")
+	assert.True(t, errors.Is(err, instr.ErrTimeout), "got %v", err)
+	// A garbled response
+	s.At(s.Count()+2, fault.Garble)
+	garbled, err := c.Ask("*IDN?")
+	if err == nil {
+		assert.NotEqual(t, idn, garbled)
+	}
+	// A lost character
+	s.At(s.Count()+2, fault.Drop)
+	dropped, err := c.Ask("*IDN?")
+	assert.NoError(t, err)
+	assert.Len(t, dropped, len(idn)-1)
+	// Disconnect
+	s.At(s.Count()+1, fault.Disconnect)
+	_, err = c.Ask("*IDN?")
+	assert.True(t, errors.Is(err, instr.ErrClosed), "got %v", err)
+	_, err = c.Ask("*IDN?")
+	assert.True(t, errors.Is(err, instr.ErrClosed), "got %v", err)
+	kinds := []fault.Kind{}
+	for _, e := range s.Events() {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []fault.Kind{fault.Timeout, fault.Garble, fault.Drop, fault.Disconnect}, kinds)
+}
+
+// run measures n times on a virtual bench with random faults, returning the faults
+func run(seed int64, n int) ([]fault.Event, []error) {
+	b := virtual.NewBench(1)
+	_ = b.Connect(instr.Ch1, virtual.Resistor(100))
+	s := fault.NewSchedule(seed)
+	s.Delay = time.Microsecond
+	s.Timeout, s.Garble, s.Drop, s.Latency = 0.1, 0.1, 0.1, 0.1
+	psu := fault.NewPsu(b.Psu(), s)
+	dmm := fault.NewDmm(b.Dmm(instr.Ch1, virtual.Load), s)
+	_ = dmm.Configure(instr.Setup{Unit: instr.VoltDc})
+	var errs []error
+	for k := 0; k < n; k++ {
+		_ = psu.SetOutput(instr.Ch1, float64(k), 1.0)
+		if _, err := dmm.Measure(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return s.Events(), errs
+}
+
+func TestSeed(t *testing.T) {
+	events1, errs1 := run(5, 100)
+	events2, errs2 := run(5, 100)
+	events3, _ := run(6, 100)
+	assert.Equal(t, events1, events2)
+	assert.Equal(t, errs1, errs2)
+	assert.NotEqual(t, events1, events3)
+	// About 40% of the 201 operations should have faults
+	assert.InDelta(t, 80, len(events1), 30)
+	for _, err := range errs1 {
+		ok := errors.Is(err, instr.ErrTimeout) || errors.Is(err, instr.ErrShortRead) || errors.Is(err, fault.ErrGarbled)
+		assert.True(t, ok, "unexpected error %v", err)
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	b := virtual.NewBench(1)
+	assert.NoError(t, b.Connect(instr.Ch1, virtual.Resistor(100)))
+	s := fault.NewSchedule(1)
+	s.Delay = time.Millisecond
+	s.At(1, fault.Garble).At(3, fault.Timeout).At(5, fault.Disconnect)
+	psu := fault.NewPsu(b.Psu(), s)
+	scope := fault.NewScope(b.Scope(), s)
+	// The first command is lost
+	assert.NoError(t, psu.SetOutput(instr.Ch1, 5.0, 1.0))
+	volt, _, err := psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, volt)
+	_, err = scope.Measure(instr.Ch1, "MEAN")
+	assert.True(t, errors.Is(err, instr.ErrTimeout), "got %v", err)
+	assert.NoError(t, psu.SetOutput(instr.Ch1, 5.0, 1.0))
+	// The disconnect is seen by the supply only
+	_, _, err = psu.GetOutput(instr.Ch1)
+	assert.True(t, errors.Is(err, instr.ErrClosed), "got %v", err)
+	_, _, err = psu.GetOutput(instr.Ch1)
+	assert.True(t, errors.Is(err, instr.ErrClosed), "got %v", err)
+	_, err = scope.QueryIdn()
+	assert.NoError(t, err)
+	// Operations on a disconnected instrument are not counted
+	assert.Equal(t, 6, s.Count())
+	assert.Equal(t, fault.Event{Op: 5, Name: "GetOutput", Kind: fault.Disconnect}, s.Events()[2])
+}
@@ -0,0 +1,97 @@
+package fault
+
+import (
+	"context"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Check if Psu satisfies the Psu interface
+var _ instr.Psu = &Psu{}
+
+// Psu is a power supply decorator injecting faults
+type Psu struct {
+	injector
+	psu instr.Psu
+}
+
+// NewPsu returns psu with faults injected from the schedule
+func NewPsu(psu instr.Psu, schedule *Schedule) *Psu {
+	return &Psu{injector: injector{schedule: schedule}, psu: psu}
+}
+
+// SetOutput will set output voltage and current limit, unless the command is lost
+func (p *Psu) SetOutput(ch instr.Chan, voltage float64, current float64) error {
+	return p.SetOutputContext(context.Background(), ch, voltage, current)
+}
+
+// SetOutputContext is SetOutput that can be cancelled by ctx
+func (p *Psu) SetOutputContext(ctx context.Context, ch instr.Chan, voltage float64, current float64) error {
+	lost, err := p.command(ctx, "SetOutput", p.psu.Close)
+	if lost || err != nil {
+		return err
+	}
+	return p.psu.SetOutputContext(ctx, ch, voltage, current)
+}
+
+// GetOutput will return the output voltage and current, unless there is a fault
+func (p *Psu) GetOutput(ch instr.Chan) (float64, float64, error) {
+	return p.GetOutputContext(context.Background(), ch)
+}
+
+// GetOutputContext is GetOutput that can be cancelled by ctx
+func (p *Psu) GetOutputContext(ctx context.Context, ch instr.Chan) (float64, float64, error) {
+	if err := p.query(ctx, "GetOutput", p.psu.Close); err != nil {
+		return 0, 0, err
+	}
+	return p.psu.GetOutputContext(ctx, ch)
+}
+
+// GetOutputReading will return the output voltage and current as readings, unless there is a fault
+func (p *Psu) GetOutputReading(ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	return p.GetOutputReadingContext(context.Background(), ch)
+}
+
+// GetOutputReadingContext is GetOutputReading that can be cancelled by ctx
+func (p *Psu) GetOutputReadingContext(ctx context.Context, ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	if err := p.query(ctx, "GetOutputReading", p.psu.Close); err != nil {
+		return instr.Reading{}, instr.Reading{}, err
+	}
+	return p.psu.GetOutputReadingContext(ctx, ch)
+}
+
+// GetSetpoint will return the voltage and current setpoints, unless there is a fault
+func (p *Psu) GetSetpoint(ch instr.Chan) (float64, float64, error) {
+	if err := p.query(context.Background(), "GetSetpoint", p.psu.Close); err != nil {
+		return 0, 0, err
+	}
+	return p.psu.GetSetpoint(ch)
+}
+
+// Disable will turn off the output, unless the command is lost
+func (p *Psu) Disable(ch instr.Chan) {
+	lost, err := p.command(context.Background(), "Disable", p.psu.Close)
+	if !lost && err == nil {
+		p.psu.Disable(ch)
+	}
+}
+
+// QueryIdn returns the name of the supply, unless there is a fault
+func (p *Psu) QueryIdn() (string, error) {
+	if err := p.query(context.Background(), "QueryIdn", p.psu.Close); err != nil {
+		return "", err
+	}
+	return p.psu.QueryIdn()
+}
+
+// ChannelCount returns the number of channels
+func (p *Psu) ChannelCount() int {
+	return p.psu.ChannelCount()
+}
+
+// Close will close the supply, unless it is disconnected
+func (p *Psu) Close() {
+	if !p.disconnected() {
+		p.psu.Close()
+	}
+}
@@ -0,0 +1,123 @@
+package fault
+
+import (
+	"context"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Check if Scope satisfies the Scope interface
+var _ instr.Scope = &Scope{}
+
+// Scope is an oscilloscope decorator injecting faults. The functions only
+// changing local settings have no faults.
+type Scope struct {
+	injector
+	scope instr.Scope
+}
+
+// NewScope returns scope with faults injected from the schedule
+func NewScope(scope instr.Scope, schedule *Schedule) *Scope {
+	return &Scope{injector: injector{schedule: schedule}, scope: scope}
+}
+
+// QueryIdn returns the name of the scope, unless there is a fault
+func (s *Scope) QueryIdn() (string, error) {
+	if err := s.query(context.Background(), "QueryIdn", s.scope.Close); err != nil {
+		return "", err
+	}
+	return s.scope.QueryIdn()
+}
+
+// DisableChannel turns the channel off
+func (s *Scope) DisableChannel(ch instr.Chan) {
+	s.scope.DisableChannel(ch)
+}
+
+// SetupChannel will set up a channel, unless the command is lost
+func (s *Scope) SetupChannel(ch instr.Chan, rng float64, offset float64, coupling instr.Coupling) error {
+	lost, err := s.command(context.Background(), "SetupChannel", s.scope.Close)
+	if lost || err != nil {
+		return err
+	}
+	return s.scope.SetupChannel(ch, rng, offset, coupling)
+}
+
+// GetChanInfo returns the channel settings
+func (s *Scope) GetChanInfo() []string {
+	return s.scope.GetChanInfo()
+}
+
+// SetupTime will set the horizontal settings, unless the command is lost
+func (s *Scope) SetupTime(sampleTime float64, offs float64, sampleMode instr.SampleMode, sampleCount int) error {
+	lost, err := s.command(context.Background(), "SetupTime", s.scope.Close)
+	if lost || err != nil {
+		return err
+	}
+	return s.scope.SetupTime(sampleTime, offs, sampleMode, sampleCount)
+}
+
+// SetupTrigger will set the trigger, unless the command is lost
+func (s *Scope) SetupTrigger(sourceChan instr.Chan, coupling instr.Coupling, slope instr.Slope, trigLevel float64, auto bool, xPos float64) error {
+	lost, err := s.command(context.Background(), "SetupTrigger", s.scope.Close)
+	if lost || err != nil {
+		return err
+	}
+	return s.scope.SetupTrigger(sourceChan, coupling, slope, trigLevel, auto, xPos)
+}
+
+// Measure returns a measurement on the channel, unless there is a fault
+func (s *Scope) Measure(ch instr.Chan, typ string) (float64, error) {
+	return s.MeasureContext(context.Background(), ch, typ)
+}
+
+// MeasureContext is Measure that can be cancelled by ctx
+func (s *Scope) MeasureContext(ctx context.Context, ch instr.Chan, typ string) (float64, error) {
+	if err := s.query(ctx, "Measure", s.scope.Close); err != nil {
+		return 0.0, err
+	}
+	return s.scope.MeasureContext(ctx, ch, typ)
+}
+
+// MeasureReading will do a measurement, unless there is a fault
+func (s *Scope) MeasureReading(ch instr.Chan, typ string) (instr.Reading, error) {
+	return s.MeasureReadingContext(context.Background(), ch, typ)
+}
+
+// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+func (s *Scope) MeasureReadingContext(ctx context.Context, ch instr.Chan, typ string) (instr.Reading, error) {
+	if err := s.query(ctx, "MeasureReading", s.scope.Close); err != nil {
+		return instr.Reading{}, err
+	}
+	return s.scope.MeasureReadingContext(ctx, ch, typ)
+}
+
+// GetSamples returns the samples, unless there is a fault
+func (s *Scope) GetSamples() ([][]float64, error) {
+	return s.GetSamplesContext(context.Background())
+}
+
+// GetSamplesContext is GetSamples that can be cancelled by ctx
+func (s *Scope) GetSamplesContext(ctx context.Context) ([][]float64, error) {
+	if err := s.query(ctx, "GetSamples", s.scope.Close); err != nil {
+		return nil, err
+	}
+	return s.scope.GetSamplesContext(ctx)
+}
+
+// GetTime will return horizontal settings
+func (s *Scope) GetTime() (sampleIntervalSec float64, xPosSec float64) {
+	return s.scope.GetTime()
+}
+
+// Close will close the scope, unless it is disconnected
+func (s *Scope) Close() {
+	if !s.disconnected() {
+		s.scope.Close()
+	}
+}
+
+// ChannelCount is the number of channels
+func (s *Scope) ChannelCount() int {
+	return s.scope.ChannelCount()
+}
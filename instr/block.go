@@ -0,0 +1,161 @@
+package instr
+
+// IEEE 488.2 arbitrary block data, used for waveforms and other binary data.
+// A definite length block is "#<n><length><data>", where n is the number of digits in length.
+// An indefinite length block is "#0<data>" terminated by a line feed with EOI.
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// maxBlockSize is the largest block accepted, to avoid allocating huge buffers on garbage
+const maxBlockSize = 1 << 28
+
+// readFull reads exactly len(b) bytes before the deadline. It works like io.ReadFull,
+// but serial ports returning zero bytes on timeout are also stopped by the deadline.
+// ErrShortRead is returned if some, but not all bytes are received.
+func (i *Connection) readFull(b []byte, deadline time.Time) error {
+	if conn, ok := i.transport().(deadliner); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	n := 0
+	for n < len(b) {
+		if err := i.cancelled(); err != nil {
+			return err
+		}
+		m, err := i.read(b[n:])
+		n += m
+		if m > 0 || (err == nil && time.Now().Before(deadline)) {
+			continue
+		}
+		err = i.ioError(err, m)
+		if n > 0 {
+			return fmt.Errorf("%w, got %d of %d bytes, %s", ErrShortRead, n, len(b), err)
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadBlock reads an IEEE 488.2 definite or indefinite length block.
+// The whole block must arrive within the connection timeout.
+// A line terminator following a definite length block is not read,
+// but will be flushed by the next Ask.
+func (i *Connection) ReadBlock() ([]byte, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.readBlock()
+}
+
+// readBlock is ReadBlock without locking
+func (i *Connection) readBlock() ([]byte, error) {
+	if i.conn == nil {
+		return nil, ErrClosed
+	}
+	deadline := i.deadline()
+	hdr := make([]byte, 2)
+	if err := i.readFull(hdr[:1], deadline); err != nil {
+		return nil, err
+	}
+	// Skip leading white space left from a previous response
+	for hdr[0] == '\n' || hdr[0] == '\r' || hdr[0] == ' ' {
+		if err := i.readFull(hdr[:1], deadline); err != nil {
+			return nil, err
+		}
+	}
+	if hdr[0] != '#' {
+		return nil, fmt.Errorf("block should start with #, got 0x%02x", hdr[0])
+	}
+	if err := i.readFull(hdr[1:], deadline); err != nil {
+		return nil, err
+	}
+	if hdr[1] < '0' || hdr[1] > '9' {
+		return nil, fmt.Errorf("block header has invalid digit count 0x%02x", hdr[1])
+	}
+	if hdr[1] == '0' {
+		return i.readIndefinite(deadline)
+	}
+	digits := make([]byte, hdr[1]-'0')
+	if err := i.readFull(digits, deadline); err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, d := range digits {
+		if d < '0' || d > '9' {
+			return nil, fmt.Errorf("block header has invalid length \"%s\"", string(digits))
+		}
+		n = n*10 + int(d-'0')
+	}
+	if n > maxBlockSize {
+		return nil, fmt.Errorf("block length %d is too large", n)
+	}
+	data := make([]byte, n)
+	if err := i.readFull(data, deadline); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readIndefinite reads an indefinite length block. The data may contain line feeds, so the block
+// ends at the end of the message on connections that can tell, and otherwise when nothing more
+// is received before the deadline. The line feed terminating the block is removed.
+func (i *Connection) readIndefinite(deadline time.Time) ([]byte, error) {
+	if conn, ok := i.transport().(deadliner); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	msg, isMessage := i.transport().(messageReader)
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		if err := i.cancelled(); err != nil {
+			return nil, err
+		}
+		n, err := i.read(buf)
+		data = append(data, buf[:n]...)
+		if len(data) > maxBlockSize {
+			return nil, fmt.Errorf("indefinite block is too large")
+		}
+		if n > 0 && isMessage && len(i.input) == 0 && msg.EndOfMessage() {
+			return bytes.TrimSuffix(data, []byte("\n")), nil
+		}
+		if n > 0 || (err == nil && time.Now().Before(deadline)) {
+			continue
+		}
+		// Only the last line feed of a stream ends the block
+		if isMessage || !bytes.HasSuffix(data, []byte("\n")) {
+			return nil, fmt.Errorf("%w, indefinite block not terminated", ErrShortRead)
+		}
+		return data[:len(data)-1], nil
+	}
+}
+
+// AskBlock sends a query and reads the block response
+func (i *Connection) AskBlock(query string, args ...interface{}) ([]byte, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.queryBlock(format(query, args))
+}
+
+// queryBlock sends the query and reads the block, reconnecting if needed
+func (i *Connection) queryBlock(query string) ([]byte, error) {
+	b, err := i.askBlock(query)
+	if i.recover(err) {
+		b, err = i.askBlock(query)
+	}
+	return b, err
+}
+
+// askBlock sends the query and reads the block without reconnecting
+func (i *Connection) askBlock(query string) ([]byte, error) {
+	if err := i.pace(query); err != nil {
+		return nil, err
+	}
+	i.flush()
+	err := i.write(query)
+	if err != nil {
+		return nil, err
+	}
+	return i.readBlock()
+}
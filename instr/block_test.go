@@ -0,0 +1,94 @@
+package instr
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chunkConn returns the given chunks one by one from Read, like a slow serial link
+type chunkConn struct {
+	chunks  []string
+	written string
+}
+
+func (c *chunkConn) Read(b []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.chunks[0])
+	c.chunks[0] = c.chunks[0][n:]
+	if len(c.chunks[0]) == 0 {
+		c.chunks = c.chunks[1:]
+	}
+	return n, nil
+}
+
+func (c *chunkConn) Write(b []byte) (int, error) {
+	c.written += string(b)
+	return len(b), nil
+}
+
+func (c *chunkConn) Close() error {
+	return nil
+}
+
+// endConn is a chunkConn where the message ends when rest chunks are left
+type endConn struct {
+	chunkConn
+	rest int
+}
+
+func (c *endConn) EndOfMessage() bool {
+	return len(c.chunks) == c.rest
+}
+
+func TestReadBlock(t *testing.T) {
+	c := &Connection{Timeout: 100 * time.Millisecond}
+	c.conn = &chunkConn{chunks: []string{"#", "21", "1abc", "de\nfgh", "ij\n"}}
+	b, err := c.ReadBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, "abcde\nfghij", string(b))
+
+	c.conn = &chunkConn{chunks: []string{"#0ab", "c\x00d\n"}}
+	b, err = c.ReadBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc\x00d", string(b))
+
+	// A line feed at the end of a chunk does not end the block on a stream
+	c.conn = &chunkConn{chunks: []string{"#0ab\n", "c\n", "\x0ad\n"}}
+	b, err = c.ReadBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, "ab\nc\n\nd", string(b))
+
+	// On connections telling where the message ends, the block ends there
+	end := &endConn{chunkConn: chunkConn{chunks: []string{"#0ab\n", "c\n", "d\n", "X?\n"}}, rest: 1}
+	c.conn = end
+	b, err = c.ReadBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, "ab\nc\nd", string(b))
+	end.chunks, end.rest = []string{"#0ab\n", "c"}, -1
+	_, err = c.ReadBlock()
+	assert.ErrorIs(t, err, ErrShortRead)
+
+	c.conn = &chunkConn{chunks: []string{"#3100", "abc"}}
+	_, err = c.ReadBlock()
+	assert.Error(t, err, "short read")
+
+	c.conn = &chunkConn{chunks: []string{"#a10"}}
+	_, err = c.ReadBlock()
+	assert.Error(t, err, "invalid digit count")
+
+	c.conn = &chunkConn{chunks: []string{"1.23\n"}}
+	_, err = c.ReadBlock()
+	assert.Error(t, err, "not a block")
+
+	conn := &chunkConn{chunks: []string{"#14", "\x01\x02\x03\x04"}}
+	c.conn = conn
+	b, err = c.AskBlock("CURVE?")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4}, b)
+	assert.Equal(t, "CURVE?\n", conn.written)
+}
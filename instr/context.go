@@ -0,0 +1,160 @@
+package instr
+
+// Context support, making it possible to abort an operation from a
+// Stop button or a test sequence timeout. Raw tcp sockets are interrupted
+// at once. Other connections finish the transfer in progress, which is
+// limited by the timeout, since aborting in the middle of a VXI-11 or
+// HiSLIP message would leave the protocol out of sync.
+// After a cancellation the input is flushed and a device clear is sent
+// if the connection supports it, so that the instrument is left ready
+// for the next command.
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// deadline returns the time limit for the next transfer. It is the
+// timeout, or the context deadline if that comes first.
+func (i *Connection) deadline() time.Time {
+	t := time.Now().Add(i.Timeout)
+	if i.ctx == nil {
+		return t
+	}
+	if i.ctx.Err() != nil {
+		return time.Now()
+	}
+	if d, ok := i.ctx.Deadline(); ok && d.Before(t) {
+		return d
+	}
+	return t
+}
+
+// cancelled returns the context error if the operation in progress is cancelled
+func (i *Connection) cancelled() error {
+	if i.ctx == nil {
+		return nil
+	}
+	return i.ctx.Err()
+}
+
+// begin makes ctx apply to the following transfers. The returned function must be
+// called when the operation is finished.
+func (i *Connection) begin(ctx context.Context) (stop func() bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The previous context is restored, for operations done by Reconnect.Init
+	prev := i.ctx
+	i.ctx = ctx
+	conn, ok := i.transport().(net.Conn)
+	if !ok {
+		return func() bool { i.ctx = prev; return true }, nil
+	}
+	after := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	return func() bool { i.ctx = prev; return after() }, nil
+}
+
+// end stops the context from applying, and returns the context error if it was cancelled.
+// The connection is then flushed and cleared, to discard a late response.
+func (i *Connection) end(ctx context.Context, stop func() bool, err error) error {
+	stop()
+	cause := ctx.Err()
+	if d, ok := ctx.Deadline(); ok && cause == nil && errors.Is(err, ErrTimeout) && !time.Now().Before(d) {
+		// The read deadline was the context deadline, and expired just before the context
+		cause = context.DeadlineExceeded
+	}
+	if cause == nil {
+		return err
+	}
+	_ = i.clear()
+	return cause
+}
+
+// WriteContext is Write that can be cancelled by ctx
+func (i *Connection) WriteContext(ctx context.Context, s string, args ...interface{}) error {
+	release, err := i.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	stop, err := i.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return i.end(ctx, stop, i.command(format(s, args)))
+}
+
+// AskContext is Ask that can be cancelled by ctx
+func (i *Connection) AskContext(ctx context.Context, query string, args ...interface{}) (string, error) {
+	release, err := i.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	stop, err := i.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	s, err := i.query(format(query, args))
+	err = i.end(ctx, stop, err)
+	if err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// PollFloatContext is PollFloat that can be cancelled by ctx
+func (i *Connection) PollFloatContext(ctx context.Context, query string, args ...interface{}) (float64, error) {
+	release, err := i.acquire(ctx)
+	if err != nil {
+		return 0.0, err
+	}
+	defer release()
+	stop, err := i.begin(ctx)
+	if err != nil {
+		return 0.0, err
+	}
+	f, err := i.pollFloat(format(query, args))
+	err = i.end(ctx, stop, err)
+	if err != nil {
+		return 0.0, err
+	}
+	return f, nil
+}
+
+// AskBlockContext is AskBlock that can be cancelled by ctx
+func (i *Connection) AskBlockContext(ctx context.Context, query string, args ...interface{}) ([]byte, error) {
+	release, err := i.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	stop, err := i.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := i.queryBlock(format(query, args))
+	err = i.end(ctx, stop, err)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Sleep waits for the given duration, or until ctx is done.
+// It is used by drivers for delays needed by the instruments.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,75 @@
+package instr
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowServer answers "SLOW?" after 300mS, and echoes other queries at once
+func slowServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			s = strings.TrimSpace(s)
+			if s == "SLOW?" {
+				time.Sleep(300 * time.Millisecond)
+			}
+			_, _ = c.Write([]byte(s + "\n"))
+		}
+	}()
+	return l
+}
+
+func TestAskContext(t *testing.T) {
+	l := slowServer(t)
+	defer l.Close()
+	c := &Connection{Timeout: 5 * time.Second}
+	assert.NoError(t, c.Open(l.Addr().String()))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	t0 := time.Now()
+	_, err := c.AskContext(ctx, "SLOW?")
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+	assert.Less(t, time.Since(t0), 200*time.Millisecond)
+
+	_, err = c.AskContext(ctx, "FAST?")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = c.AskContext(ctx, "SLOW?")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Wait for the late response, which is discarded by the next Ask
+	time.Sleep(time.Second)
+	s, err := c.AskContext(context.Background(), "FAST?")
+	assert.NoError(t, err)
+	assert.Equal(t, "FAST?", s)
+}
+
+func TestSleep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, Sleep(ctx, time.Millisecond))
+	cancel()
+	assert.ErrorIs(t, Sleep(ctx, time.Hour), context.Canceled)
+}
@@ -0,0 +1,223 @@
+package instr
+
+// Discovery of the instruments on a test bench. The serial ports, usbtmc devices
+// and hosts on the given subnets are probed concurrently with *IDN?, and each
+// instrument responding is returned with a resource string for Open or the driver.
+// Serial ports are probed with the baudrate and terminator of each registered
+// driver, one setting at a time, and the resource string gives the setting that
+// got a response.
+//
+//	found, err := instr.Discover(ctx, instr.Scan{Serial: true, Subnets: []string{"192.168.2.0/24"}})
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Discover and Find when no instrument responds
+var ErrNotFound = errors.New("no instrument found")
+
+// Default discovery settings
+const (
+	discoverTimeout = 300 * time.Millisecond
+	discoverWorkers = 64
+	scpiPort        = 5025
+	maxSubnetBits   = 16
+)
+
+// Scan selects the ports and hosts probed by Discover. The zero value probes nothing.
+type Scan struct {
+	Serial  bool          // Probe the serial ports, except Bluetooth ports and ports in use
+	Usbtmc  bool          // Probe the usbtmc devices (linux only)
+	Subnets []string      // Subnets with LXI instruments, like "192.168.2.0/24", or single hosts
+	Ports   []int         // Tcp ports probed on each host. Default 5025, the SCPI raw socket
+	Timeout time.Duration // Timeout for each probe. Default 300mS
+	Workers int           // Maximum number of tcp ports probed at the same time. Default 64
+}
+
+// Local returns a scan of the serial ports and usbtmc devices
+func Local() Scan {
+	return Scan{Serial: true, Usbtmc: true}
+}
+
+// Found is an instrument found by Discover
+type Found struct {
+	Resource string // Resource string for Open or the driver
+	Identity Identity
+	Driver   string // Name of the driver, or "" if no driver supports the instrument
+}
+
+func (f Found) String() string {
+	if f.Driver == "" {
+		return fmt.Sprintf("%s at %s (no driver)", f.Identity, f.Resource)
+	}
+	return fmt.Sprintf("%s at %s (%s)", f.Identity, f.Resource, f.Driver)
+}
+
+// Discover probes the ports and hosts given by scan concurrently, and returns the instruments
+// responding to *IDN?, sorted by resource string. ErrNotFound is returned if no instrument
+// responds. When ctx is cancelled, the instruments found so far are returned with ctx.Err().
+func Discover(ctx context.Context, scan Scan) ([]Found, error) {
+	hosts, err := subnetHosts(scan.Subnets)
+	if err != nil {
+		return nil, err
+	}
+	timeout := scan.Timeout
+	if timeout <= 0 {
+		timeout = discoverTimeout
+	}
+	workers := scan.Workers
+	if workers <= 0 {
+		workers = discoverWorkers
+	}
+	ports := scan.Ports
+	if len(ports) == 0 {
+		ports = []int{scpiPort}
+	}
+	var (
+		mutex sync.Mutex
+		found []Found
+		wg    sync.WaitGroup
+		count int
+	)
+	// probe identifies the instrument at address, using resource to make the resource string
+	probe := func(address string, resource func(setting) string) {
+		defer wg.Done()
+		id, d, s, _ := identify(ctx, address, timeout)
+		if id.Manufacturer == "" {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		found = append(found, Found{Resource: resource(s), Identity: id, Driver: d.Name})
+	}
+	if scan.Serial {
+		list, desc, _ := EnumerateSerialPorts()
+		for k, port := range list {
+			if strings.Contains(desc[k], "Bluetooth") || CheckSerialPort(port) != nil {
+				continue
+			}
+			count++
+			wg.Add(1)
+			go probe(port, func(s setting) string {
+				baudrate := s.baudrate
+				if baudrate == 0 {
+					baudrate = 115200
+				}
+				return fmt.Sprintf("%s://%s?baud=%d&eol=%s", Serial, port, baudrate, s.eol)
+			})
+		}
+	}
+	if scan.Usbtmc {
+		devices, _ := EnumerateUsbtmc()
+		for _, d := range devices {
+			count++
+			wg.Add(1)
+			go probe(d.Name, func(setting) string { return d.Name })
+		}
+	}
+	// A worker is reserved before each goroutine is started, so that workers also limits the goroutines
+	limit := make(chan struct{}, workers)
+hosts:
+	for _, host := range hosts {
+		for _, port := range ports {
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				break hosts
+			}
+			address := net.JoinHostPort(host, strconv.Itoa(port))
+			count++
+			wg.Add(1)
+			go func() {
+				defer func() { <-limit }()
+				if !listening(ctx, address, timeout) {
+					wg.Done()
+					return
+				}
+				probe(TCP+"://"+address, func(setting) string { return TCP + "://" + address })
+			}()
+		}
+	}
+	wg.Wait()
+	sort.Slice(found, func(i, j int) bool { return found[i].Resource < found[j].Resource })
+	if err = ctx.Err(); err != nil {
+		return found, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%w, %d ports probed", ErrNotFound, count)
+	}
+	return found, nil
+}
+
+// Find returns the resource string of the first instrument on the serial ports or usbtmc
+// devices supported by the named driver. Unlike FindSerialPort, an error is returned
+// instead of a guess when the instrument is not found.
+func Find(driver string) (string, error) {
+	found, err := Discover(context.Background(), Local())
+	for _, f := range found {
+		if f.Driver == driver {
+			return f.Resource, nil
+		}
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+	return "", fmt.Errorf("%w for driver %s, %d other instruments found", ErrNotFound, driver, len(found))
+}
+
+// listening returns true if a tcp connection to address can be made
+func listening(ctx context.Context, address string, timeout time.Duration) bool {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// subnetHosts returns the host addresses in the subnets, without the network and
+// broadcast addresses. Subnets larger than /16 are not accepted.
+func subnetHosts(subnets []string) ([]string, error) {
+	var hosts []string
+	for _, subnet := range subnets {
+		if !strings.Contains(subnet, "/") {
+			if net.ParseIP(subnet) == nil {
+				return nil, fmt.Errorf("invalid host address %s", subnet)
+			}
+			hosts = append(hosts, subnet)
+			continue
+		}
+		_, network, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+		ones, bits := network.Mask.Size()
+		if bits != 32 {
+			return nil, fmt.Errorf("subnet %s is not IPv4", subnet)
+		}
+		if bits-ones > maxSubnetBits {
+			return nil, fmt.Errorf("subnet %s is larger than /%d", subnet, bits-maxSubnetBits)
+		}
+		base := network.IP.To4()
+		first := uint32(base[0])<<24 | uint32(base[1])<<16 | uint32(base[2])<<8 | uint32(base[3])
+		size := uint32(1) << (bits - ones)
+		start, end := first, first+size
+		if size > 2 {
+			// Skip the network and broadcast addresses
+			start, end = first+1, first+size-1
+		}
+		for a := start; a < end; a++ {
+			hosts = append(hosts, net.IPv4(byte(a>>24), byte(a>>16), byte(a>>8), byte(a)).String())
+		}
+	}
+	return hosts, nil
+}
@@ -0,0 +1,70 @@
+package instr
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// port returns the port number of a host:port address
+func port(t *testing.T, address string) int {
+	_, p, err := net.SplitHostPort(address)
+	assert.NoError(t, err)
+	n, err := strconv.Atoi(p)
+	assert.NoError(t, err)
+	return n
+}
+
+func TestDiscover(t *testing.T) {
+	register(t, testDriver("discover-test", "ACME,X?"))
+	a := idnServer(t, "ACME,X1,1234,1.0")
+	b := idnServer(t, "OTHER,Y1,5678,2.0")
+	silent := idnServer(t, "")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	closed := l.Addr().String()
+	_ = l.Close()
+
+	scan := Scan{Subnets: []string{"127.0.0.1"}, Ports: []int{port(t, a), port(t, b), port(t, silent), port(t, closed)}}
+	found, err := Discover(context.Background(), scan)
+	assert.NoError(t, err)
+	if assert.Len(t, found, 2) {
+		byResource := map[string]Found{found[0].Resource: found[0], found[1].Resource: found[1]}
+		assert.Equal(t, Found{Resource: "tcp://" + a, Identity: Identity{"ACME", "X1", "1234", "1.0"}, Driver: "discover-test"}, byResource["tcp://"+a])
+		assert.Equal(t, "", byResource["tcp://"+b].Driver)
+		assert.Equal(t, "Y1", byResource["tcp://"+b].Identity.Model)
+		assert.Less(t, found[0].Resource, found[1].Resource)
+	}
+
+	// An explicit error when nothing responds
+	scan.Ports = []int{port(t, silent), port(t, closed)}
+	found, err = Discover(context.Background(), scan)
+	assert.True(t, errors.Is(err, ErrNotFound), "got %v", err)
+	assert.Empty(t, found)
+
+	// Cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Discover(ctx, Scan{Subnets: []string{"127.0.0.1"}, Ports: []int{port(t, a)}, Timeout: time.Second})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSubnetHosts(t *testing.T) {
+	hosts, err := subnetHosts([]string{"192.168.2.0/30", "10.0.0.7", "172.16.0.8/31"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.168.2.1", "192.168.2.2", "10.0.0.7", "172.16.0.8", "172.16.0.9"}, hosts)
+	hosts, err = subnetHosts([]string{"192.168.2.0/24"})
+	assert.NoError(t, err)
+	assert.Len(t, hosts, 254)
+	_, err = subnetHosts([]string{"10.0.0.0/8"})
+	assert.Error(t, err)
+	_, err = subnetHosts([]string{"192.168.2.300"})
+	assert.Error(t, err)
+	_, err = subnetHosts([]string{"fe80::/120"})
+	assert.Error(t, err)
+}
@@ -1,5 +1,7 @@
 package instr
 
+import "context"
+
 // EngUnit defines the engineering unit of a measurement
 type EngUnit int
 
@@ -14,14 +16,38 @@ const (
 	Hz
 	Ohm
 	Celcius
+	Second
+	Farad
+	Watt
+	DBm
+	Diode
+	Continuity
+	OhmFourWire
+)
+
+// Sensor is the temperature sensor used when measuring Celcius
+type Sensor int
+
+const (
+	DefaultSensor Sensor = iota
+	Pt100                // Platinum RTD, 100Ω at 0°C, 2-wire
+	Pt100FourWire        // Platinum RTD, 100Ω at 0°C, 4-wire
+	ThermocoupleJ
+	ThermocoupleK
+	ThermocoupleT
+	ThermocoupleE
 )
 
+// Setup is the configuration of a measurement. The zero values give the defaults of the instrument.
 type Setup struct {
 	Chan       Chan
 	Unit       EngUnit
-	Range      string
-	Resolution float64
-	Rate       float64
+	Range      string  // The range as a string, like "10" or "AUTO". Use Max or Autorange instead
+	Max        float64 // The largest value measured, selecting the lowest range covering it
+	Autorange  bool    // Select the range automatically. It is the default when no range is given
+	Resolution float64 // The number of digits, like 5.5 or 6.5
+	Rate       float64 // The readings per second, selecting the integration time
+	Sensor     Sensor  // The temperature sensor
 }
 
 // Dmm is the interface for a digital multilmeter
@@ -29,5 +55,11 @@ type Dmm interface {
 	Close()
 	Configure(setup Setup) error
 	Measure() (float64, error)
+	// MeasureContext is Measure that can be cancelled by ctx
+	MeasureContext(ctx context.Context) (float64, error)
+	// MeasureReading returns the measurement with unit, time and status
+	MeasureReading() (Reading, error)
+	// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+	MeasureReadingContext(ctx context.Context) (Reading, error)
 	QueryIdn() (string, error)
 }
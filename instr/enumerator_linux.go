@@ -0,0 +1,121 @@
+package instr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Locations used for enumeration. They are variables to make testing possible.
+var (
+	sysClassTty    = "/sys/class/tty"
+	devSerialByID  = "/dev/serial/by-id"
+	devFolder      = "/dev"
+	sysDevicesRoot = "/sys/devices"
+)
+
+// readSysFile returns the trimmed content of a sysfs attribute, or "" if it does not exist
+func readSysFile(dir string, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// linkBase returns the last element of the path a symlink points to, or "" if not a link
+func linkBase(path string) string {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// findUsbDevice walks up from a tty device directory until it finds
+// the usb device directory containing idVendor and idProduct
+func findUsbDevice(dir string) string {
+	for strings.HasPrefix(dir, sysDevicesRoot) && len(dir) > len(sysDevicesRoot) {
+		if readSysFile(dir, "idVendor") != "" {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+	return ""
+}
+
+// readByID returns a map from device name (f.ex. ttyUSB0) to its persistent name in /dev/serial/by-id
+func readByID() map[string]string {
+	links := make(map[string]string)
+	files, err := os.ReadDir(devSerialByID)
+	if err != nil {
+		return links
+	}
+	for _, f := range files {
+		target, err := os.Readlink(filepath.Join(devSerialByID, f.Name()))
+		if err != nil {
+			continue
+		}
+		links[filepath.Base(target)] = filepath.Join(devSerialByID, f.Name())
+	}
+	return links
+}
+
+// serialFromByID extracts the serial number from a by-id name like
+// "usb-FTDI_FT232R_USB_UART_A12345-if00-port0"
+func serialFromByID(link string) string {
+	s := filepath.Base(link)
+	if pos := strings.Index(s, "-if"); pos > 0 {
+		s = s[:pos]
+	}
+	if pos := strings.LastIndex(s, "_"); pos > 0 {
+		return s[pos+1:]
+	}
+	return ""
+}
+
+// EnumeratePorts will return information about all serial ports present.
+// It walks /sys/class/tty and skips virtual terminals and
+// platform ports that are not backed by real hardware.
+func EnumeratePorts() ([]PortInfo, error) {
+	files, err := os.ReadDir(sysClassTty)
+	if err != nil {
+		return nil, err
+	}
+	byID := readByID()
+	var ports []PortInfo
+	for _, f := range files {
+		ttyDir := filepath.Join(sysClassTty, f.Name())
+		devDir, err := filepath.EvalSymlinks(filepath.Join(ttyDir, "device"))
+		if err != nil {
+			// Virtual terminals and pseudo terminals have no device
+			continue
+		}
+		if linkBase(filepath.Join(devDir, "subsystem")) == "platform" {
+			// Legacy ttyS ports that does not exist
+			continue
+		}
+		p := PortInfo{Name: filepath.Join(devFolder, f.Name())}
+		if usbDir := findUsbDevice(devDir); usbDir != "" {
+			p.Vid = parseHex16(readSysFile(usbDir, "idVendor"))
+			p.Pid = parseHex16(readSysFile(usbDir, "idProduct"))
+			p.SerialNumber = readSysFile(usbDir, "serial")
+			p.Description = strings.TrimSpace(readSysFile(usbDir, "manufacturer") + " " + readSysFile(usbDir, "product"))
+		}
+		if link, ok := byID[f.Name()]; ok {
+			p.Link = link
+			if p.SerialNumber == "" {
+				p.SerialNumber = serialFromByID(link)
+			}
+		}
+		if p.Description == "" {
+			p.Description = linkBase(filepath.Join(devDir, "driver"))
+		}
+		if p.Description == "" {
+			p.Description = f.Name()
+		}
+		ports = append(ports, p)
+	}
+	sortPorts(ports)
+	return ports, nil
+}
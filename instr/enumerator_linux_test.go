@@ -0,0 +1,83 @@
+package instr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTree builds a fake sysfs with one FTDI adapter, one ACM device, a platform ttyS and a virtual tty
+func makeTree(t *testing.T) string {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	mk := func(path string) string {
+		p := filepath.Join(root, path)
+		assert.NoError(t, os.MkdirAll(p, 0755))
+		return p
+	}
+	write := func(path, s string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(s+"\n"), 0644))
+	}
+	link := func(target, path string) {
+		assert.NoError(t, os.Symlink(filepath.Join(root, target), filepath.Join(root, path)))
+	}
+	mk("sys/bus/usb")
+	mk("sys/bus/platform")
+	mk("sys/bus/usb-serial/drivers/ftdi_sio")
+	// USB FTDI adapter
+	mk("sys/devices/pci0/usb1/1-1/1-1:1.0/ttyUSB0")
+	write("sys/devices/pci0/usb1/1-1/idVendor", "0403")
+	write("sys/devices/pci0/usb1/1-1/idProduct", "6001")
+	write("sys/devices/pci0/usb1/1-1/serial", "A12345")
+	write("sys/devices/pci0/usb1/1-1/manufacturer", "FTDI")
+	write("sys/devices/pci0/usb1/1-1/product", "FT232R USB UART")
+	link("sys/bus/usb-serial", "sys/devices/pci0/usb1/1-1/1-1:1.0/ttyUSB0/subsystem")
+	// USB ACM device without serial number attribute
+	mk("sys/devices/pci0/usb1/1-2/1-2:1.0")
+	write("sys/devices/pci0/usb1/1-2/idVendor", "0699")
+	write("sys/devices/pci0/usb1/1-2/idProduct", "03a4")
+	link("sys/bus/usb", "sys/devices/pci0/usb1/1-2/1-2:1.0/subsystem")
+	// Platform port that does not exist
+	mk("sys/devices/platform/serial8250")
+	link("sys/bus/platform", "sys/devices/platform/serial8250/subsystem")
+	// Class entries
+	mk("sys/class/tty/ttyUSB0")
+	mk("sys/class/tty/ttyACM10")
+	mk("sys/class/tty/ttyS1")
+	mk("sys/class/tty/tty0")
+	link("sys/devices/pci0/usb1/1-1/1-1:1.0/ttyUSB0", "sys/class/tty/ttyUSB0/device")
+	link("sys/devices/pci0/usb1/1-2/1-2:1.0", "sys/class/tty/ttyACM10/device")
+	link("sys/devices/platform/serial8250", "sys/class/tty/ttyS1/device")
+	// by-id links
+	mk("dev/serial/by-id")
+	link("dev/ttyACM10", "dev/serial/by-id/usb-Tektronix_TPS2024_C012345-if00")
+	sysClassTty = filepath.Join(root, "sys/class/tty")
+	sysDevicesRoot = filepath.Join(root, "sys/devices")
+	devSerialByID = filepath.Join(root, "dev/serial/by-id")
+	return root
+}
+
+func TestEnumeratePortsLinux(t *testing.T) {
+	defer func(a, b, c string) { sysClassTty, sysDevicesRoot, devSerialByID = a, b, c }(sysClassTty, sysDevicesRoot, devSerialByID)
+	makeTree(t)
+	ports, err := EnumeratePorts()
+	assert.NoError(t, err)
+	if !assert.Equal(t, 2, len(ports)) {
+		return
+	}
+	assert.Equal(t, "/dev/ttyACM10", ports[0].Name)
+	assert.Equal(t, uint16(0x0699), ports[0].Vid)
+	assert.Equal(t, uint16(0x03a4), ports[0].Pid)
+	assert.Equal(t, "C012345", ports[0].SerialNumber)
+	assert.Contains(t, ports[0].Link, "usb-Tektronix_TPS2024_C012345-if00")
+	assert.Equal(t, "/dev/ttyUSB0", ports[1].Name)
+	assert.Equal(t, "FTDI FT232R USB UART", ports[1].Description)
+	assert.Equal(t, uint16(0x0403), ports[1].Vid)
+	assert.Equal(t, "A12345", ports[1].SerialNumber)
+
+	names, desc, err := EnumerateSerialPorts()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dev/ttyACM10", "/dev/ttyUSB0"}, names)
+	assert.Equal(t, 2, len(desc))
+}
@@ -19,6 +19,7 @@ var (
 	procSetupDiDestroyDeviceInfoList      = modsetupapi.NewProc("SetupDiDestroyDeviceInfoList")
 	procSetupDiEnumDeviceInfo             = modsetupapi.NewProc("SetupDiEnumDeviceInfo")
 	procSetupDiGetDeviceRegistryPropertyW = modsetupapi.NewProc("SetupDiGetDeviceRegistryPropertyW")
+	procSetupDiGetDeviceInstanceIdW       = modsetupapi.NewProc("SetupDiGetDeviceInstanceIdW")
 )
 
 var deviceClassPortsGUID = windows.GUID{0x4d36e978, 0xe325, 0x11ce, [8]byte{0xbf, 0xc1, 0x08, 0x00, 0x2b, 0xe1, 0x03, 0x18}}
@@ -36,7 +37,10 @@ const (
 
 type SPDRP uint32
 
-const SPDRP_FRIENDLYNAME SPDRP = 0x0000000C // FriendlyName (R/W)
+const (
+	SPDRP_HARDWAREID   SPDRP = 0x00000001 // HardwareID (R/W)
+	SPDRP_FRIENDLYNAME SPDRP = 0x0000000C // FriendlyName (R/W)
+)
 
 // DevInfo holds reference to device information set
 type DevInfo windows.Handle
@@ -216,14 +220,60 @@ func bufToUTF16(buf []byte) []uint16 {
 	return *(*[]uint16)(unsafe.Pointer(&sl))
 }
 
-// EnumerateSerialPorts will return a list of port names and a list of descriptions
-func EnumerateSerialPorts() ([]string, []string, error) {
+// SetupDiGetDeviceInstanceId function retrieves the device instance ID, f.ex. "USB\VID_0403&PID_6001\A12345"
+func SetupDiGetDeviceInstanceId(deviceInfoSet DevInfo, deviceInfoData *DevInfoData) (string, error) {
+	reqSize := uint32(256)
+	for {
+		buf := make([]uint16, reqSize)
+		r1, _, e1 := syscall.Syscall6(procSetupDiGetDeviceInstanceIdW.Addr(), 5, uintptr(deviceInfoSet),
+			uintptr(unsafe.Pointer(deviceInfoData)), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)),
+			uintptr(unsafe.Pointer(&reqSize)), 0)
+		if r1 != 0 {
+			return windows.UTF16ToString(buf), nil
+		}
+		err := error(syscall.EINVAL)
+		if e1 != 0 {
+			err = errnoErr(e1)
+		}
+		if err == windows.ERROR_INSUFFICIENT_BUFFER {
+			continue
+		}
+		return "", err
+	}
+}
+
+// parseInstanceId will find vid, pid and serial number in a device instance id.
+// USB devices use "USB\VID_0403&PID_6001\A12345", FTDI uses "FTDIBUS\VID_0403+PID_6001+A12345A\0000"
+// Serial numbers generated by windows contains '&' and are ignored.
+func parseInstanceId(id string, p *PortInfo) {
+	segs := strings.Split(strings.ToUpper(id), `\`)
+	if len(segs) < 2 {
+		return
+	}
+	fields := strings.FieldsFunc(segs[1], func(r rune) bool { return r == '&' || r == '+' })
+	for _, f := range fields {
+		if strings.HasPrefix(f, "VID_") {
+			p.Vid = parseHex16(f[4:])
+		} else if strings.HasPrefix(f, "PID_") {
+			p.Pid = parseHex16(f[4:])
+		}
+	}
+	if segs[0] == "FTDIBUS" && len(fields) > 2 && len(fields[2]) > 1 {
+		// FTDI appends the port letter (A,B..) to the serial number
+		p.SerialNumber = fields[2][:len(fields[2])-1]
+	} else if segs[0] == "USB" && len(segs) > 2 && !strings.Contains(segs[2], "&") {
+		p.SerialNumber = segs[2]
+	}
+}
+
+// EnumeratePorts will return information about all serial ports present
+func EnumeratePorts() ([]PortInfo, error) {
 	devInfoList, err := SetupDiGetClassDevsEx(&deviceClassPortsGUID, "", 0, DIGCF_PRESENT, DevInfo(0), "")
 	if err != nil {
-		return nil, nil, fmt.Errorf("error calling SetupDiGetClassDevsEx: %s", err.Error())
+		return nil, fmt.Errorf("error calling SetupDiGetClassDevsEx: %s", err.Error())
 	}
-	var info []string
-	var ports []string
+	defer func() { _ = devInfoList.Close() }()
+	var ports []PortInfo
 	var data DevInfoData
 	for i := 0; true; i++ {
 		err := SetupDiEnumDeviceInfo(devInfoList, i, &data)
@@ -233,19 +283,25 @@ func EnumerateSerialPorts() ([]string, []string, error) {
 			}
 			continue
 		}
-		value, err := SetupDiGetDeviceRegistryProperty(devInfoList, &data, SPDRP_FRIENDLYNAME)
-		if s, ok := value.(string); ok {
-			if strings.Contains(s, "COM") {
-				pos := strings.Index(s, "COM")
-				info = append(info, s[0:pos-1])
-				ports = append(ports, s[pos:len(s)-1])
-				//alog.Info(s)
-			}
-		}
 		if data.ClassGUID != deviceClassPortsGUID {
-			return nil, nil, fmt.Errorf("SetupDiEnumDeviceInfo returned different class GUID")
+			return nil, fmt.Errorf("SetupDiEnumDeviceInfo returned different class GUID")
+		}
+		value, _ := SetupDiGetDeviceRegistryProperty(devInfoList, &data, SPDRP_FRIENDLYNAME)
+		s, ok := value.(string)
+		if !ok || !strings.Contains(s, "COM") {
+			continue
+		}
+		pos := strings.Index(s, "(COM")
+		if pos < 1 {
+			continue
+		}
+		p := PortInfo{Name: strings.TrimSuffix(s[pos+1:], ")"), Description: s[0 : pos-1]}
+		id, err := SetupDiGetDeviceInstanceId(devInfoList, &data)
+		if err == nil {
+			parseInstanceId(id, &p)
 		}
+		ports = append(ports, p)
 	}
-	_ = devInfoList.Close()
-	return ports, info, nil
+	sortPorts(ports)
+	return ports, nil
 }
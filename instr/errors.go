@@ -0,0 +1,59 @@
+package instr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/jkvatne/serial"
+)
+
+// Errors returned by the Connection read and write functions.
+// They are wrapped with more details, so use errors.Is() to test for them.
+var (
+	// ErrTimeout is returned when the instrument does not respond in time
+	ErrTimeout = errors.New("timeout")
+	// ErrClosed is returned when the connection is not open, or closed by the instrument
+	ErrClosed = errors.New("connection closed")
+	// ErrShortRead is returned when only a part of the expected data is received
+	ErrShortRead = errors.New("short read")
+)
+
+// ioError converts an error from the underlying connection to one of the typed errors.
+// Serial ports report a timeout as zero bytes with io.EOF (linux) or no error (windows),
+// while other connections returning io.EOF are closed by the instrument. A reset
+// connection or an unplugged device is also reported as ErrClosed.
+func (i *Connection) ioError(err error, n int) error {
+	var netErr net.Error
+	switch {
+	case err == nil && n > 0:
+		return nil
+	case errors.Is(err, ErrTimeout) || errors.Is(err, ErrClosed) || errors.Is(err, ErrShortRead):
+		return err
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w, %s", ErrTimeout, err)
+	case errors.Is(err, net.ErrClosed):
+		return ErrClosed
+	case lostErrno(err):
+		return fmt.Errorf("%w, %s", ErrClosed, err)
+	case err == nil || err == io.EOF:
+		if _, isSerial := i.transport().(*serial.Port); !isSerial && err == io.EOF {
+			return fmt.Errorf("%w by instrument", ErrClosed)
+		}
+		return ErrTimeout
+	}
+	return err
+}
+
+// lostErrno returns true for errors from a connection reset by the instrument,
+// or a device that is unplugged
+func lostErrno(err error) bool {
+	for _, e := range []syscall.Errno{syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE, syscall.EIO, syscall.ENXIO, syscall.ENODEV} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package instr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// silentConn never returns any data, like a serial port on windows after a timeout
+type silentConn struct {
+	chunkConn
+}
+
+func (c *silentConn) Read(b []byte) (int, error) {
+	return 0, nil
+}
+
+func TestReadErrors(t *testing.T) {
+	c := &Connection{Timeout: 10 * time.Millisecond}
+	_, err := c.Ask("*IDN?")
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, c.Write("*RST"), ErrClosed)
+
+	c.conn = &silentConn{}
+	_, err = c.Ask("*IDN?")
+	assert.ErrorIs(t, err, ErrTimeout)
+	_, err = c.PollFloat("MEAS?")
+	assert.ErrorIs(t, err, ErrTimeout)
+	_, err = c.QueryIdn()
+	assert.ErrorIs(t, err, ErrTimeout)
+	_, err = c.ReadBlock()
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// A tcp connection or similar returning EOF is closed by the instrument
+	c.conn = &chunkConn{chunks: []string{"1.5\n"}}
+	v, err := c.PollFloat("MEAS?")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, v)
+	_, err = c.Ask("MEAS?")
+	assert.ErrorIs(t, err, ErrClosed)
+
+	c.conn = &chunkConn{chunks: []string{"#3100", "abc"}}
+	_, err = c.ReadBlock()
+	assert.ErrorIs(t, err, ErrShortRead)
+	c.conn = &chunkConn{chunks: []string{"#0abc"}}
+	_, err = c.ReadBlock()
+	assert.ErrorIs(t, err, ErrShortRead)
+}
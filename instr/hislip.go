@@ -0,0 +1,380 @@
+package instr
+
+// HiSLIP client (IVI-6.1 High-Speed LAN Instrument Protocol).
+// A session uses two tcp connections to the same port, normally 4880.
+// The synchronous channel carries commands and responses, while the
+// asynchronous channel is used for device clear and status queries.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// HiSLIP message types
+const (
+	hsInitialize                      = 0
+	hsInitializeResponse              = 1
+	hsFatalError                      = 2
+	hsError                           = 3
+	hsData                            = 6
+	hsDataEnd                         = 7
+	hsDeviceClearComplete             = 8
+	hsDeviceClearAcknowledge          = 9
+	hsAsyncMaximumMessageSize         = 15
+	hsAsyncMaximumMessageSizeResponse = 16
+	hsAsyncInitialize                 = 17
+	hsAsyncInitializeResponse         = 18
+	hsAsyncDeviceClear                = 19
+	hsAsyncServiceRequest             = 20
+	hsAsyncStatusQuery                = 21
+	hsAsyncStatusResponse             = 22
+	hsAsyncDeviceClearAcknowledge     = 23
+)
+
+const (
+	hislipPort       = 4880
+	hislipVersion    = 0x0100 // Protocol version 1.0
+	hislipVendor     = 0x474D // "GM"
+	hislipFirstMsgID = 0xffffff00
+	hislipMaxMessage = 1 << 20
+	hislipHeaderSize = 16
+)
+
+// errMessageCut is returned with the error stopping a message that is partly transferred
+var errMessageCut = errors.New("hislip message cut")
+
+// errHislipLost is returned after a message is cut, since the following data can not be parsed
+var errHislipLost = fmt.Errorf("%w, hislip session out of sync", ErrClosed)
+
+// hislipMessage is one message on either channel
+type hislipMessage struct {
+	typ     byte
+	control byte
+	param   uint32
+	payload []byte
+}
+
+func writeHislip(w io.Writer, m hislipMessage) error {
+	b := make([]byte, hislipHeaderSize, hislipHeaderSize+len(m.payload))
+	b[0], b[1], b[2], b[3] = 'H', 'S', m.typ, m.control
+	binary.BigEndian.PutUint32(b[4:], m.param)
+	binary.BigEndian.PutUint64(b[8:], uint64(len(m.payload)))
+	n, err := w.Write(append(b, m.payload...))
+	if err != nil && n > 0 {
+		return fmt.Errorf("%w, %w", errMessageCut, err)
+	}
+	return err
+}
+
+func readHislip(r io.Reader) (hislipMessage, error) {
+	var hdr [hislipHeaderSize]byte
+	if k, err := io.ReadFull(r, hdr[:]); err != nil {
+		if k > 0 {
+			return hislipMessage{}, fmt.Errorf("%w, %w", errMessageCut, err)
+		}
+		return hislipMessage{}, err
+	}
+	if hdr[0] != 'H' || hdr[1] != 'S' {
+		return hislipMessage{}, fmt.Errorf("%w, hislip message has wrong prologue", errMessageCut)
+	}
+	m := hislipMessage{typ: hdr[2], control: hdr[3], param: binary.BigEndian.Uint32(hdr[4:])}
+	n := binary.BigEndian.Uint64(hdr[8:])
+	if n > hislipMaxMessage {
+		return hislipMessage{}, fmt.Errorf("%w, hislip message too long, %d bytes", errMessageCut, n)
+	}
+	m.payload = make([]byte, n)
+	if _, err := io.ReadFull(r, m.payload); err != nil {
+		return hislipMessage{}, fmt.Errorf("%w, %w", errMessageCut, err)
+	}
+	if m.typ == hsError || m.typ == hsFatalError {
+		return m, fmt.Errorf("hislip error %d, %s", m.control, string(m.payload))
+	}
+	return m, nil
+}
+
+// hislip is a io.ReadWriteCloser for a HiSLIP session
+type hislip struct {
+	sync          net.Conn
+	async         net.Conn
+	sessionID     uint16
+	msgID         uint32
+	maxMessage    uint64
+	rmtDelivered  bool
+	end           bool // The last message read was DataEnd
+	lost          bool // A message is cut, and the channels closed
+	timeout       time.Duration
+	readDeadline  time.Time
+	writeDeadline time.Time
+	pending       []byte
+}
+
+// dialHislip opens the sync and async channels to address and initializes a session
+// with the given sub-address, normally "hislip0"
+func dialHislip(address string, subAddress string, timeout time.Duration) (*hislip, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, fmt.Sprint(hislipPort))
+	}
+	deadline := time.Now().Add(timeout)
+	h := &hislip{timeout: timeout, msgID: hislipFirstMsgID, maxMessage: hislipMaxMessage}
+	var err error
+	h.sync, err = net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = h.sync.SetDeadline(deadline)
+	err = writeHislip(h.sync, hislipMessage{typ: hsInitialize, param: hislipVersion<<16 | hislipVendor, payload: []byte(subAddress)})
+	if err != nil {
+		_ = h.sync.Close()
+		return nil, err
+	}
+	m, err := readHislip(h.sync)
+	if err == nil && m.typ != hsInitializeResponse {
+		err = fmt.Errorf("hislip initialize failed, got message type %d", m.typ)
+	}
+	if err != nil {
+		_ = h.sync.Close()
+		return nil, err
+	}
+	h.sessionID = uint16(m.param)
+	h.async, err = net.DialTimeout("tcp", address, timeout)
+	if err == nil {
+		err = h.asyncInit(deadline)
+	}
+	if err != nil {
+		h.closeChannels()
+		return nil, err
+	}
+	return h, nil
+}
+
+// asyncInit binds the async channel to the session and negotiates the message size
+func (h *hislip) asyncInit(deadline time.Time) error {
+	_ = h.async.SetDeadline(deadline)
+	err := writeHislip(h.async, hislipMessage{typ: hsAsyncInitialize, param: uint32(h.sessionID)})
+	if err != nil {
+		return err
+	}
+	if _, err = h.asyncResponse(hsAsyncInitializeResponse); err != nil {
+		return err
+	}
+	size := binary.BigEndian.AppendUint64(nil, hislipMaxMessage)
+	err = writeHislip(h.async, hislipMessage{typ: hsAsyncMaximumMessageSize, payload: size})
+	if err != nil {
+		return err
+	}
+	m, err := h.asyncResponse(hsAsyncMaximumMessageSizeResponse)
+	if err != nil {
+		return err
+	}
+	if len(m.payload) == 8 {
+		if n := binary.BigEndian.Uint64(m.payload); n > hislipHeaderSize && n < h.maxMessage {
+			h.maxMessage = n
+		}
+	}
+	return nil
+}
+
+// asyncResponse reads from the async channel until a message of the given type arrives.
+// Service requests arriving in between are ignored.
+func (h *hislip) asyncResponse(typ byte) (hislipMessage, error) {
+	for {
+		m, err := readHislip(h.async)
+		if err != nil {
+			return m, err
+		}
+		if m.typ == typ {
+			return m, nil
+		}
+		if m.typ != hsAsyncServiceRequest {
+			return m, fmt.Errorf("unexpected hislip message type %d", m.typ)
+		}
+	}
+}
+
+// deadline returns the deadline to use, which is the timeout if t is zero.
+// A deadline that has passed gives ErrTimeout.
+func (h *hislip) deadline(t time.Time) (time.Time, error) {
+	if t.IsZero() {
+		return time.Now().Add(h.timeout), nil
+	}
+	if !time.Now().Before(t) {
+		return t, fmt.Errorf("%w, deadline passed", ErrTimeout)
+	}
+	return t, nil
+}
+
+// cut closes the channels if err stopped a message in the middle
+func (h *hislip) cut(err error) error {
+	if errors.Is(err, errMessageCut) {
+		h.lost = true
+		h.closeChannels()
+	}
+	return err
+}
+
+// Write sends b as one message, split into Data messages ending with DataEnd
+func (h *hislip) Write(b []byte) (int, error) {
+	if h.lost {
+		return 0, errHislipLost
+	}
+	deadline, err := h.deadline(h.writeDeadline)
+	if err != nil {
+		return 0, err
+	}
+	_ = h.sync.SetWriteDeadline(deadline)
+	maxPayload := int(h.maxMessage - hislipHeaderSize)
+	n := 0
+	for {
+		m := hislipMessage{typ: hsDataEnd, param: h.msgID, payload: b[n:]}
+		if len(m.payload) > maxPayload {
+			m.typ = hsData
+			m.payload = m.payload[:maxPayload]
+		}
+		if h.rmtDelivered {
+			m.control = 1
+			h.rmtDelivered = false
+		}
+		if err := writeHislip(h.sync, m); err != nil {
+			return n, h.cut(err)
+		}
+		n += len(m.payload)
+		if m.typ == hsDataEnd {
+			h.msgID += 2
+			return n, nil
+		}
+	}
+}
+
+// Read returns the payload of one Data or DataEnd message, buffering what does not fit in b
+func (h *hislip) Read(b []byte) (int, error) {
+	if len(h.pending) == 0 {
+		if h.lost {
+			return 0, errHislipLost
+		}
+		deadline, err := h.deadline(h.readDeadline)
+		if err != nil {
+			return 0, err
+		}
+		_ = h.sync.SetReadDeadline(deadline)
+		m, err := readHislip(h.sync)
+		if err != nil {
+			return 0, h.cut(err)
+		}
+		if m.typ != hsData && m.typ != hsDataEnd {
+			return 0, fmt.Errorf("unexpected hislip message type %d", m.typ)
+		}
+		h.end = m.typ == hsDataEnd
+		if h.end {
+			h.rmtDelivered = true
+		}
+		h.pending = m.payload
+	}
+	n := copy(b, h.pending)
+	h.pending = h.pending[n:]
+	return n, nil
+}
+
+// EndOfMessage returns true when all data up to the last DataEnd is read
+func (h *hislip) EndOfMessage() bool {
+	return h.end && len(h.pending) == 0
+}
+
+// Flush discards buffered response data
+func (h *hislip) Flush() error {
+	h.pending = nil
+	return nil
+}
+
+// Clear does the HiSLIP device clear transaction on both channels
+func (h *hislip) Clear() error {
+	h.pending = nil
+	if h.lost {
+		return errHislipLost
+	}
+	return h.cut(h.clear())
+}
+
+// clear is the device clear transaction, returning errors cutting a message
+func (h *hislip) clear() error {
+	deadline := time.Now().Add(h.timeout)
+	_ = h.async.SetDeadline(deadline)
+	_ = h.sync.SetDeadline(deadline)
+	if err := writeHislip(h.async, hislipMessage{typ: hsAsyncDeviceClear}); err != nil {
+		return err
+	}
+	m, err := h.asyncResponse(hsAsyncDeviceClearAcknowledge)
+	if err != nil {
+		return err
+	}
+	if err = writeHislip(h.sync, hislipMessage{typ: hsDeviceClearComplete, control: m.control}); err != nil {
+		return err
+	}
+	// Discard responses until the acknowledge arrives
+	for {
+		m, err = readHislip(h.sync)
+		if err != nil {
+			return err
+		}
+		if m.typ == hsDeviceClearAcknowledge {
+			break
+		}
+	}
+	h.msgID = hislipFirstMsgID
+	h.rmtDelivered = false
+	return nil
+}
+
+// StatusByte reads the status byte using the async channel
+func (h *hislip) StatusByte() (byte, error) {
+	if h.lost {
+		return 0, errHislipLost
+	}
+	b, err := h.statusByte()
+	return b, h.cut(err)
+}
+
+// statusByte is StatusByte, returning errors cutting a message
+func (h *hislip) statusByte() (byte, error) {
+	_ = h.async.SetDeadline(time.Now().Add(h.timeout))
+	var control byte
+	if h.rmtDelivered {
+		control = 1
+	}
+	if err := writeHislip(h.async, hislipMessage{typ: hsAsyncStatusQuery, control: control, param: h.msgID}); err != nil {
+		return 0, err
+	}
+	m, err := h.asyncResponse(hsAsyncStatusResponse)
+	if err != nil {
+		return 0, err
+	}
+	return m.control, nil
+}
+
+func (h *hislip) closeChannels() {
+	if h.async != nil {
+		_ = h.async.Close()
+	}
+	_ = h.sync.Close()
+}
+
+// Close will close both channels
+func (h *hislip) Close() error {
+	h.closeChannels()
+	return nil
+}
+
+// SetReadDeadline sets the time limit for the following Read calls
+func (h *hislip) SetReadDeadline(t time.Time) error {
+	h.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the time limit for the following Write calls
+func (h *hislip) SetWriteDeadline(t time.Time) error {
+	h.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,191 @@
+package instr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHislip is a HiSLIP server supporting one session at a time.
+// It answers *IDN? and echoes any other query.
+type fakeHislip struct {
+	l          net.Listener
+	maxMessage uint64
+	clears     int32
+	cut        atomic.Bool // Responses stop in the middle of the message
+}
+
+func newFakeHislip(t *testing.T, maxMessage uint64) *fakeHislip {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	f := &fakeHislip{l: l, maxMessage: maxMessage}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeHislip) serve(c net.Conn) {
+	defer c.Close()
+	m, err := readHislip(c)
+	if err != nil {
+		return
+	}
+	if m.typ == hsAsyncInitialize {
+		f.serveAsync(c)
+		return
+	}
+	if m.typ != hsInitialize || string(m.payload) != "hislip0" {
+		_ = writeHislip(c, hislipMessage{typ: hsFatalError, control: 3, payload: []byte("invalid sub-address")})
+		return
+	}
+	_ = writeHislip(c, hislipMessage{typ: hsInitializeResponse, param: hislipVersion<<16 | 42})
+	var input []byte
+	for {
+		m, err := readHislip(c)
+		if err != nil {
+			return
+		}
+		switch m.typ {
+		case hsData:
+			input = append(input, m.payload...)
+		case hsDataEnd:
+			cmd := strings.TrimSpace(string(append(input, m.payload...)))
+			input = nil
+			resp := ""
+			if cmd == "*IDN?" {
+				resp = "FAKE,HISLIP,0,1.0\n"
+			} else if strings.Contains(cmd, "?") {
+				resp = cmd + "\n"
+			}
+			if resp != "" && f.cut.Load() {
+				// A part of the response, like a session stopping in the middle of a message
+				var b bytes.Buffer
+				_ = writeHislip(&b, hislipMessage{typ: hsDataEnd, param: m.param, payload: []byte(resp)})
+				_, _ = c.Write(b.Bytes()[:b.Len()-len(resp)/2])
+			} else if resp != "" {
+				_ = writeHislip(c, hislipMessage{typ: hsDataEnd, param: m.param, payload: []byte(resp)})
+			}
+		case hsDeviceClearComplete:
+			input = nil
+			_ = writeHislip(c, hislipMessage{typ: hsDeviceClearAcknowledge, control: m.control})
+		}
+	}
+}
+
+func (f *fakeHislip) serveAsync(c net.Conn) {
+	_ = writeHislip(c, hislipMessage{typ: hsAsyncInitializeResponse, param: 0x5858})
+	// Send a service request to check that it is skipped
+	_ = writeHislip(c, hislipMessage{typ: hsAsyncServiceRequest, control: 0x40})
+	for {
+		m, err := readHislip(c)
+		if err != nil {
+			return
+		}
+		switch m.typ {
+		case hsAsyncMaximumMessageSize:
+			_ = writeHislip(c, hislipMessage{typ: hsAsyncMaximumMessageSizeResponse, payload: binary.BigEndian.AppendUint64(nil, f.maxMessage)})
+		case hsAsyncDeviceClear:
+			atomic.AddInt32(&f.clears, 1)
+			_ = writeHislip(c, hislipMessage{typ: hsAsyncDeviceClearAcknowledge})
+		case hsAsyncStatusQuery:
+			_ = writeHislip(c, hislipMessage{typ: hsAsyncStatusResponse, control: 0x10})
+		}
+	}
+}
+
+func TestHislip(t *testing.T) {
+	f := newFakeHislip(t, 24)
+	defer f.l.Close()
+	c := &Connection{Timeout: 500 * time.Millisecond}
+	err := c.Open("hislip://" + f.l.Addr().String() + "/hislip0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	name, err := c.QueryIdn()
+	assert.NoError(t, err)
+	assert.Equal(t, "FAKE,HISLIP,0,1.0", name)
+
+	// Longer than the maximum message size, so it is sent as several Data messages
+	s, err := c.Ask("MEAS:VOLT:DC? 100.0,0.001")
+	assert.NoError(t, err)
+	assert.Equal(t, "MEAS:VOLT:DC? 100.0,0.001", s)
+
+	stb, err := c.StatusByte()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x10), stb)
+
+	assert.NoError(t, c.Clear())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&f.clears))
+	s, err = c.Ask("X?")
+	assert.NoError(t, err)
+	assert.Equal(t, "X?", s)
+	c.Close()
+}
+
+func TestHislipDeadline(t *testing.T) {
+	f := newFakeHislip(t, 1024)
+	defer f.l.Close()
+	c := &Connection{Timeout: 200 * time.Millisecond}
+	err := c.Open("hislip://" + f.l.Addr().String() + "/hislip0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	// A deadline that has passed is a timeout, also when a response is ready
+	assert.NoError(t, c.Write("*IDN?"))
+	time.Sleep(10 * time.Millisecond)
+	h := c.transport().(*hislip)
+	_ = h.SetReadDeadline(time.Now().Add(-time.Millisecond))
+	_, err = h.Read(make([]byte, 64))
+	assert.ErrorIs(t, err, ErrTimeout)
+	_ = h.SetWriteDeadline(time.Now().Add(-time.Millisecond))
+	_, err = h.Write([]byte("*IDN?\n"))
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// A message cut by the timeout leaves the rest of it in the stream, so the session is lost
+	_ = h.SetReadDeadline(time.Time{})
+	_, err = h.Read(make([]byte, 64))
+	assert.NoError(t, err, "response not read by the timed out Read")
+	f.cut.Store(true)
+	_, err = c.Ask("*IDN?")
+	assert.ErrorIs(t, err, ErrTimeout)
+	f.cut.Store(false)
+	_, err = c.Ask("*IDN?")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestHislipInvalidSubAddress(t *testing.T) {
+	f := newFakeHislip(t, 1024)
+	defer f.l.Close()
+	c := &Connection{Timeout: 500 * time.Millisecond}
+	err := c.Open("hislip://" + f.l.Addr().String() + "/hislip7")
+	assert.Error(t, err)
+}
+
+func TestHislipResource(t *testing.T) {
+	r, err := ParseResource("TCPIP0::192.168.2.18::hislip0::INSTR")
+	assert.NoError(t, err)
+	assert.Equal(t, HiSLIP, r.Transport)
+	assert.Equal(t, "192.168.2.18", r.Address)
+	assert.Equal(t, "hislip0", r.Device)
+	r, err = ParseResource("TCPIP0::192.168.2.18::hislip1,4881::INSTR")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.2.18:4881", r.Address)
+	assert.Equal(t, "hislip1", r.Device)
+	r, err = ParseResource("192.168.2.18:4880")
+	assert.NoError(t, err)
+	assert.Equal(t, HiSLIP, r.Transport)
+}
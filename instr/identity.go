@@ -0,0 +1,71 @@
+package instr
+
+import (
+	"path"
+	"strings"
+)
+
+// Identity is the identification of an instrument, parsed from the *IDN? response
+type Identity struct {
+	Manufacturer string
+	Model        string
+	Serial       string
+	Firmware     string
+}
+
+// ParseIdentity splits a *IDN? response like "FLUKE,8845A,2359004,08/02/10-11:53"
+// into its fields. Responses without commas, like "KORAD KD3005P V6.8 SN:03379314",
+// are split at spaces, and the serial number is found by the SN: prefix.
+func ParseIdentity(s string) Identity {
+	var id Identity
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ",") {
+		fields := strings.SplitN(s, ",", 4)
+		for k := range fields {
+			fields[k] = strings.TrimSpace(fields[k])
+		}
+		fields = append(fields, "", "", "")
+		return Identity{Manufacturer: fields[0], Model: fields[1], Serial: fields[2], Firmware: fields[3]}
+	}
+	var firmware []string
+	for _, f := range strings.Fields(s) {
+		switch {
+		case strings.HasPrefix(strings.ToUpper(f), "SN:"):
+			id.Serial = f[3:]
+		case id.Manufacturer == "":
+			id.Manufacturer = f
+		case id.Model == "":
+			id.Model = f
+		default:
+			firmware = append(firmware, f)
+		}
+	}
+	id.Firmware = strings.Join(firmware, " ")
+	return id
+}
+
+// String returns the identity in the *IDN? format
+func (id Identity) String() string {
+	return id.Manufacturer + "," + id.Model + "," + id.Serial + "," + id.Firmware
+}
+
+// Match returns true if the manufacturer and model matches pattern, like "FLUKE,884?A".
+// The manufacturer and model patterns use the syntax of path.Match, and case is ignored.
+func (id Identity) Match(pattern string) bool {
+	manufacturer, model, _ := strings.Cut(strings.ToUpper(pattern), ",")
+	if model == "" {
+		model = "*"
+	}
+	ok1, _ := path.Match(manufacturer, strings.ToUpper(id.Manufacturer))
+	ok2, _ := path.Match(model, strings.ToUpper(id.Model))
+	return ok1 && ok2
+}
+
+// Identify reads the identification of the instrument by *IDN?
+func (i *Connection) Identify() (Identity, error) {
+	s, err := i.QueryIdn()
+	if err != nil {
+		return Identity{}, err
+	}
+	return ParseIdentity(s), nil
+}
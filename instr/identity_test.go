@@ -0,0 +1,38 @@
+package instr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIdentity(t *testing.T) {
+	tests := []struct {
+		idn string
+		id  Identity
+	}{
+		{"FLUKE,8845A,2359004,08/02/10-11:53", Identity{"FLUKE", "8845A", "2359004", "08/02/10-11:53"}},
+		{"THURLBY THANDAR, CPX400DP, 527193, 1.03-1.00-1.02\n", Identity{"THURLBY THANDAR", "CPX400DP", "527193", "1.03-1.00-1.02"}},
+		{"TEKTRONIX,TPS 2024,C010123,CF:91.1CT FV:v11.12", Identity{"TEKTRONIX", "TPS 2024", "C010123", "CF:91.1CT FV:v11.12"}},
+		{"Rigol,DS1054Z,DS1ZA1234,00.04.04,extra", Identity{"Rigol", "DS1054Z", "DS1ZA1234", "00.04.04,extra"}},
+		{"KORAD KD3005P V6.8 SN:03379314", Identity{"KORAD", "KD3005P", "03379314", "V6.8"}},
+		{"KORADKD3005PV2.0", Identity{Manufacturer: "KORADKD3005PV2.0"}},
+		{"ACME,X1", Identity{Manufacturer: "ACME", Model: "X1"}},
+		{"", Identity{}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.id, ParseIdentity(test.idn), test.idn)
+	}
+	assert.Equal(t, "KORAD,KD3005P,03379314,V6.8", ParseIdentity("KORAD KD3005P V6.8 SN:03379314").String())
+}
+
+func TestIdentityMatch(t *testing.T) {
+	id := Identity{"FLUKE", "8845A", "2359004", "08/02/10-11:53"}
+	assert.True(t, id.Match("FLUKE,884?A"))
+	assert.True(t, id.Match("fluke,8845a"))
+	assert.True(t, id.Match("FLUKE"))
+	assert.False(t, id.Match("FLUKE,8808A"))
+	assert.False(t, id.Match("KEYSIGHT,*"))
+	id = Identity{"TEKTRONIX", "TPS 2024", "", ""}
+	assert.True(t, id.Match("TEKTRONIX,TPS 20*"))
+}
@@ -6,11 +6,16 @@
 package instr
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/jkvatne/serial"
@@ -44,41 +49,188 @@ const (
 	None
 )
 
+// deadliner is implemented by connections with read and write timeouts
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// flusher is implemented by connections that can discard buffered input
+type flusher interface {
+	Flush() error
+}
+
+// clearer is implemented by connections with a device clear function
+type clearer interface {
+	Clear() error
+}
+
+// statusReader is implemented by connections that can read the status byte without a query
+type statusReader interface {
+	StatusByte() (byte, error)
+}
+
+// wrapper is implemented by connections wrapping another, like the Recorder
+type wrapper interface {
+	Unwrap() io.ReadWriteCloser
+}
+
 // Connection contains the local data for the connection to an instrument.
 type Connection struct {
-	Port     string
-	Eol      eol                // Command string terminator
-	Timeout  time.Duration      // Timeout on read operations
-	Baudrate int                // Baudrate for serial ports
-	Name     string             // Identifier read from the instrument by *IDN? or similar
-	conn     io.ReadWriteCloser // Can be a net connection or a serial port
+	Port         string
+	Eol          eol                       // Command string terminator
+	Timeout      time.Duration             // Timeout on read operations
+	Baudrate     int                       // Baudrate for serial ports
+	Name         string                    // Identifier read from the instrument by *IDN? or similar
+	Strict       bool                      // Check the error queue after each command, see CheckError
+	ErrorQuery   string                    // Query used in strict mode, SYST:ERR? if empty, or *ESR?
+	Reconnect    Reconnect                 // Reopening of lost connections, disabled by default
+	Pacing       Pacing                    // Minimum time between commands, see Pacing
+	mutex        mutex                     // Held during each transaction, or from Lock to Unlock
+	owner        atomic.Pointer[lockToken] // The token of the Lock holding mutex, nil when not locked by Lock
+	conn         io.ReadWriteCloser        // Can be a net connection, a serial port, a VXI-11 link, a HiSLIP session, a usbtmc device or a gpib adapter
+	ctx          context.Context           // Context for the operation in progress, set by the ...Context functions
+	input        []byte                    // Data received after the end of the last response
+	record       string                    // Transcript file name given in the resource string
+	resource     Resource                  // The resource opened, used when reconnecting
+	wraps        []func(conn io.ReadWriteCloser) io.ReadWriteCloser
+	serialNumber string    // USB serial number of the serial port opened
+	lost         bool      // The connection is lost, and not reopened yet
+	reconnecting bool      // Set while reconnecting, to avoid recursion from Reconnect.Init
+	last         time.Time // End of the last transfer, used for pacing
+	wrote        bool      // The last transfer was a command without response
 }
 
 // Open will open a connection defined by portName
-// The parameter is a TCP/IP address or a com port name
+// The parameter is a TCP/IP address, a com port name or a resource string
+// like "serial:///dev/ttyUSB0?baud=9600&eol=lf" (see Resource).
+// Settings given in the resource string override the Connection fields.
 func (i *Connection) Open(portName string) error {
-	var err error
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	r, err := ParseResource(portName)
+	if err != nil {
+		return err
+	}
+	err = i.apply(r)
+	if err != nil {
+		return err
+	}
 	if i.Timeout == 0 {
 		i.Timeout = time.Second
 	}
-	if strings.HasPrefix(portName, "COM") {
-		if i.Baudrate == 0 {
-			i.Baudrate = 115200
-		}
-		// Default to a interval timeout equal to one character length  (11 bits)
-		c := &serial.Config{Name: portName, Baud: i.Baudrate, ReadTimeout: i.Timeout, IntervalTimeout: time.Duration(1e12 / i.Baudrate)}
-		i.conn, err = serial.OpenPort(c)
-	} else {
-		i.conn, err = net.DialTimeout("tcp", portName, 1000*time.Millisecond)
+	if r.Transport == Serial && i.Baudrate == 0 {
+		i.Baudrate = 115200
 	}
+	i.resource, i.wraps, i.lost = r, nil, false
+	i.conn, err = i.dial(r)
 	if err != nil {
 		return fmt.Errorf("could not connect to %s, error=%s", portName, err)
 	}
+	if i.record != "" {
+		f, err := os.Create(i.record)
+		if err != nil {
+			i.close()
+			return fmt.Errorf("could not create transcript, %s", err)
+		}
+		i.startRecording(f)
+	}
+	i.serialNumber = ""
+	if r.Transport == Serial && i.Reconnect.Attempts > 0 {
+		// Used to find the port again if it is renamed. Enumerating the ports is slow,
+		// so it is only done when reconnecting is enabled.
+		i.serialNumber = usbSerialNumber(r.Address)
+	}
 	return nil
 }
 
+// dial opens the transport given by the resource
+func (i *Connection) dial(r Resource) (io.ReadWriteCloser, error) {
+	switch r.Transport {
+	case Serial:
+		// Default to a interval timeout equal to one character length  (11 bits)
+		c := &serial.Config{Name: r.Address, Baud: i.Baudrate, ReadTimeout: i.Timeout, IntervalTimeout: time.Duration(1e12 / i.Baudrate)}
+		p, err := serial.OpenPort(c)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case Prologix:
+		g, err := dialPrologix(r.Address, r.Device, i.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return g, nil
+	case USBTMC:
+		u, err := dialUsbtmc(r.Address, i.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	case HiSLIP:
+		h, err := dialHislip(r.Address, r.Device, i.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	case Replay:
+		p, err := dialReplay(r.Address)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case VXI11:
+		v, err := dialVxi11(r.Address, r.Device, i.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	c, err := net.DialTimeout("tcp", r.Address, 1000*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Wrap replaces the connection to the instrument by a wrapper, f.ex. for fault injection.
+// The wrapper is applied again when the connection is reopened by Reconnect. The wrapper should have an Unwrap() io.ReadWriteCloser function returning conn, so that
+// deadlines, device clear and the other functions of the connection are still used.
+func (i *Connection) Wrap(wrap func(conn io.ReadWriteCloser) io.ReadWriteCloser) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.wrap(wrap)
+}
+
+// wrap is Wrap without locking
+func (i *Connection) wrap(wrap func(conn io.ReadWriteCloser) io.ReadWriteCloser) {
+	if i.conn != nil {
+		i.conn = wrap(i.conn)
+		i.wraps = append(i.wraps, wrap)
+	}
+}
+
+// transport returns the connection to the instrument, looking through wrappers
+func (i *Connection) transport() io.ReadWriteCloser {
+	conn := i.conn
+	for {
+		w, ok := conn.(wrapper)
+		if !ok {
+			return conn
+		}
+		conn = w.Unwrap()
+	}
+}
+
 // Close will close a connection already opened
 func (i *Connection) Close() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.close()
+}
+
+// close is Close without locking
+func (i *Connection) close() {
 	if i.conn != nil {
 		_ = i.conn.Close()
 		i.conn = nil
@@ -87,90 +239,201 @@ func (i *Connection) Close() {
 
 // Write will send a commend to the instrument, adding end of line characters
 func (i *Connection) Write(s string, args ...interface{}) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.command(format(s, args))
+}
+
+// format formats s with the arguments, if any
+func format(s string, args []interface{}) string {
 	if args != nil {
-		s = fmt.Sprintf(s, args...)
+		return fmt.Sprintf(s, args...)
 	}
+	return s
+}
+
+// command sends s, reconnecting if needed
+func (i *Connection) command(s string) error {
+	err := i.write(s)
+	if i.recover(err) {
+		err = i.write(s)
+	}
+	return err
+}
+
+// write sends s without reconnecting
+func (i *Connection) write(s string) error {
 	if i.conn == nil {
-		return fmt.Errorf("writing to invalic port")
+		return fmt.Errorf("writing to closed port, %w", ErrClosed)
+	}
+	if err := i.pace(s); err != nil {
+		return err
 	}
 	b := []byte(i.addEol(s))
-	if conn, ok := i.conn.(net.Conn); ok {
-		_ = conn.SetWriteDeadline(time.Now().Add(i.Timeout))
+	if conn, ok := i.transport().(deadliner); ok {
+		_ = conn.SetWriteDeadline(i.deadline())
 	}
 	n, err := i.conn.Write(b)
+	i.transferred(!isQuery(s))
 	if err != nil {
-		return err
+		return i.ioError(err, 0)
 	}
 	if n != len(b) {
 		return fmt.Errorf("did not send all characters")
 	}
+	if i.Strict && !isQuery(s) {
+		return i.checkError(strings.TrimRight(s, "\r\n"))
+	}
 	return nil
 }
 
 // ReadByte will return a single byte
-func (i *Connection) ReadByte() byte {
+func (i *Connection) ReadByte() (byte, error) {
 	b := make([]byte, 1)
-	_, _ = i.conn.Read(b)
-	return b[0]
+	_, err := i.Read(b)
+	return b[0], err
 }
 
-// ReadBinary will return an array of bytes
-func (i *Connection) Read(b []byte) int {
-	n, _ := i.conn.Read(b)
-	return n
+// Read will read available bytes into b, and return the number of bytes read.
+// It returns ErrTimeout if nothing is received within the timeout.
+func (i *Connection) Read(b []byte) (int, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.readAvailable(b)
 }
 
-// ReadString will read any response from the instrument, with given timeout
-func (i *Connection) ReadString() string {
+// readAvailable is Read without locking
+func (i *Connection) readAvailable(b []byte) (int, error) {
 	if i.conn == nil {
-		return ""
-	}
-	if conn, ok := i.conn.(net.Conn); ok {
-		_ = conn.SetReadDeadline(time.Now().Add(i.Timeout))
+		return 0, ErrClosed
 	}
-	b := make([]byte, 1024)
-	n, err := i.conn.Read(b)
-	if n == 0 || err != nil {
-		return ""
+	n, err := i.read(b)
+	return n, i.ioError(err, n)
+}
+
+// ReadLine will read a response from the instrument, with given timeout.
+// It reads until the Eol terminator, or the end of the message on VXI-11,
+// HiSLIP, USBTMC and GPIB connections. The terminator and trailing
+// CR, LF and null characters are removed, but other characters are kept.
+func (i *Connection) ReadLine() (string, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.readLine()
+}
+
+// readLine is ReadLine without locking
+func (i *Connection) readLine() (string, error) {
+	b, err := i.readResponse()
+	if err != nil {
+		return "", err
 	}
-	return ToString(b[0:n])
+	return string(bytes.TrimRight(b, "\r\n\000")), nil
+}
+
+// ReadString will read any response from the instrument, with given timeout.
+// It returns "" on errors, use ReadLine to get the error.
+func (i *Connection) ReadString() string {
+	s, _ := i.ReadLine()
+	return s
 }
 
 // SetTimeout sets the read timeout
 func (i *Connection) SetTimeout(t time.Duration) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	i.Timeout = t
 }
 
 // Flush will empty the read queue
 func (i *Connection) Flush() {
-	if c, ok := i.conn.(*serial.Port); ok {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.flush()
+}
+
+// flush is Flush without locking
+func (i *Connection) flush() {
+	i.input = nil
+	if c, ok := i.transport().(flusher); ok {
 		_ = c.Flush()
-	}
-	if c, ok := i.conn.(net.Conn); ok {
+	} else if c, ok := i.transport().(net.Conn); ok {
 		b := make([]byte, 1024)
 		_ = c.SetReadDeadline(time.Now().Add(time.Millisecond))
 		_, _ = c.Read(b)
 	}
 }
 
+// Clear will send a device clear to instruments connected by VXI-11, HiSLIP, USBTMC or GPIB.
+// Other connections are just flushed.
+func (i *Connection) Clear() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.clear()
+}
+
+// clear is Clear without locking
+func (i *Connection) clear() error {
+	if c, ok := i.transport().(clearer); ok {
+		return c.Clear()
+	}
+	i.flush()
+	return nil
+}
+
+// StatusByte returns the IEEE 488.2 status byte. HiSLIP connections use the
+// async channel, USBTMC uses a control request and GPIB uses serial poll,
+// while other connections sends *STB?
+func (i *Connection) StatusByte() (byte, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if c, ok := i.transport().(statusReader); ok {
+		return c.StatusByte()
+	}
+	f, err := i.pollFloat("*STB?")
+	return byte(f), err
+}
+
 // Ask will query the instrument for a string response
 func (i *Connection) Ask(query string, args ...interface{}) (string, error) {
-	i.Flush()
-	if args != nil {
-		query = fmt.Sprintf(query, args...)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.query(format(query, args))
+}
+
+// query sends the query and reads the response, reconnecting if needed
+func (i *Connection) query(query string) (string, error) {
+	s, err := i.ask(query)
+	if i.recover(err) {
+		s, err = i.ask(query)
+	}
+	return s, err
+}
+
+// ask sends the query and reads the response without reconnecting
+func (i *Connection) ask(query string) (string, error) {
+	// Serial ports also discard output not yet sent when flushed, so the
+	// previous command must be given its time before flushing
+	if err := i.pace(query); err != nil {
+		return "", err
 	}
-	query = i.addEol(query)
-	err := i.Write(query)
+	i.flush()
+	err := i.write(i.addEol(query))
 	if err != nil {
 		return "", err
 	}
-	response := i.ReadString()
-	return response, nil
+	return i.readLine()
 }
 
 // PollFloat will read a float64 value
 func (i *Connection) PollFloat(query string, args ...interface{}) (float64, error) {
-	s, err := i.Ask(query, args...)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.pollFloat(format(query, args))
+}
+
+// pollFloat is PollFloat without locking
+func (i *Connection) pollFloat(query string) (float64, error) {
+	s, err := i.query(query)
 	if err != nil {
 		return 0.0, err
 	}
@@ -197,8 +460,18 @@ func CheckSerialPort(port string) error {
 }
 
 // FindSerialPort will return the name of the last (highest numbered)
-// serial port that is not in use already
+// serial port that is not in use already. Usbtmc devices with
+// an *IDN? response containing id are returned first.
+//
+// Deprecated: FindSerialPort returns the highest port when no instrument
+// responds, which may be the wrong device. Use Find or Discover.
 func FindSerialPort(id string, baudrate int, eol eol) string {
+	devices, _ := EnumerateUsbtmc()
+	for _, d := range devices {
+		if strings.Contains(d.Description, id) {
+			return d.Name
+		}
+	}
 	list, desc, _ := EnumerateSerialPorts()
 	highest := ""
 	for i := len(list) - 1; i >= 0; i-- {
@@ -258,12 +531,15 @@ func (i *Connection) addEol(s string) string {
 }
 
 // QueryIdn will read the instrument identification string
-// It uses *IDN? which most instruments implement
+// It uses *IDN? which most instruments implement. The query is
+// repeated once if the instrument does not respond in time.
 func (i *Connection) QueryIdn() (string, error) {
-	name, err := i.Ask("*IDN?")
-	if name == "" {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	name, err := i.query("*IDN?")
+	if errors.Is(err, ErrTimeout) {
 		time.Sleep(100 * time.Millisecond)
-		name, err = i.Ask("*IDN?")
+		name, err = i.query("*IDN?")
 	}
 	if err != nil {
 		return "", err
@@ -271,70 +547,3 @@ func (i *Connection) QueryIdn() (string, error) {
 	i.Name = name
 	return name, nil
 }
-
-// TimeToStr will return a string with sec/ms/uS/nS units
-func TimeToStr(t float64) string {
-	unit := "s"
-	if t < 1e-6 {
-		unit = "nS"
-		t = t * 1e9
-	} else if t < 1e-3 {
-		unit = "uS"
-		t = t * 1e6
-	} else if t < 1.0 {
-		unit = "mS"
-		t = t * 1e3
-	} else if t < 60.0 {
-		unit = "S"
-		t = t
-	} else if t < 3600.0 {
-		t = t / 60.0
-		unit = "mn"
-	} else if t < 86400.0 {
-		t = t / 3600.0
-		unit = "hr"
-	}
-
-	dp := 0
-	if t >= 100.0 {
-		dp = 0
-	} else if t >= 10.0 {
-		dp = 1
-	} else if t >= 1.0 {
-		dp = 2
-	} else {
-		dp = 3
-	}
-	return fmt.Sprintf("%0.*f%s", dp, t, unit)
-}
-
-// VoltToStr will return a voltage with V/mV/uV units
-func VoltToStr(v float64) string {
-	unit := "V"
-	if v < 1e-6 {
-		unit = "nV"
-		v = v * 1e9
-	} else if v < 1e-3 {
-		unit = "uV"
-		v = v * 1e6
-	} else if v < 1.0 {
-		unit = "mV"
-		v = v * 1e3
-	} else if v < 1000.0 {
-		unit = "V"
-	} else {
-		v = v / 1e3
-		unit = "kV"
-	}
-	dp := 0
-	if v >= 100.0 {
-		dp = 0
-	} else if v >= 10.0 {
-		dp = 1
-	} else if v >= 1.0 {
-		dp = 2
-	} else {
-		dp = 3
-	}
-	return fmt.Sprintf("%0.*f%s", dp, v, unit)
-}
@@ -0,0 +1,62 @@
+package instr
+
+// Pacing of commands. Some instruments lose commands sent too soon after the
+// previous transfer. Instead of sleeping after each command, the time of the
+// last transfer is recorded, and the next command waits only for the time
+// remaining, so that a command sent long after the previous one is not delayed.
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Pacing gives the minimum time from the end of the last transfer to the next command.
+// The zero value sends commands at once.
+type Pacing struct {
+	Gap      time.Duration            // Minimum time before any command
+	Settle   time.Duration            // Minimum time after a command without response
+	Commands map[string]time.Duration // Minimum time before commands starting with the key, replacing Gap and Settle
+}
+
+// delay returns the time needed before the command s. wrote is true
+// if the last transfer was a command without response.
+func (p Pacing) delay(s string, wrote bool) time.Duration {
+	key := ""
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for k := range p.Commands {
+		if len(k) > len(key) && strings.HasPrefix(s, strings.ToUpper(k)) {
+			key = k
+		}
+	}
+	if key != "" {
+		return p.Commands[key]
+	}
+	if wrote {
+		return max(p.Gap, p.Settle)
+	}
+	return p.Gap
+}
+
+// pace waits until the command s can be sent
+func (i *Connection) pace(s string) error {
+	if i.last.IsZero() {
+		return nil
+	}
+	wait := time.Until(i.last.Add(i.Pacing.delay(s, i.wrote)))
+	if wait <= 0 {
+		return nil
+	}
+	ctx := i.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Sleep(ctx, wait)
+}
+
+// transferred records the end of a transfer, where wrote is true
+// for a command without response
+func (i *Connection) transferred(wrote bool) {
+	i.last = time.Now()
+	i.wrote = wrote
+}
@@ -0,0 +1,85 @@
+package instr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// timedConn records the time of each command, and answers queries with "1"
+type timedConn struct {
+	times    map[string]time.Time
+	response string
+}
+
+func (c *timedConn) Write(b []byte) (int, error) {
+	cmd := strings.TrimSpace(string(b))
+	c.times[cmd] = time.Now()
+	if strings.HasSuffix(cmd, "?") {
+		c.response = "1\n"
+	}
+	return len(b), nil
+}
+
+func (c *timedConn) Read(b []byte) (int, error) {
+	n := copy(b, c.response)
+	c.response = c.response[n:]
+	return n, nil
+}
+
+func (c *timedConn) Flush() error {
+	c.times["flush"] = time.Now()
+	return nil
+}
+
+func (c *timedConn) Close() error {
+	return nil
+}
+
+func TestPacingDelay(t *testing.T) {
+	p := Pacing{Gap: 10, Settle: 20, Commands: map[string]time.Duration{"read?": 50, "READ?;X": 60, "*STB?": 0}}
+	assert.Equal(t, time.Duration(10), p.delay("VOLT 1", false))
+	assert.Equal(t, time.Duration(20), p.delay("VOLT 1", true))
+	assert.Equal(t, time.Duration(50), p.delay("READ?", true))
+	assert.Equal(t, time.Duration(60), p.delay("read?;x", false))
+	assert.Equal(t, time.Duration(0), p.delay("*STB?", true))
+	assert.Equal(t, time.Duration(0), Pacing{}.delay("VOLT 1", true))
+}
+
+func TestPacing(t *testing.T) {
+	conn := &timedConn{times: map[string]time.Time{}}
+	c := &Connection{conn: conn, Timeout: time.Second}
+	c.Pacing = Pacing{Gap: 20 * time.Millisecond, Settle: 50 * time.Millisecond, Commands: map[string]time.Duration{"FAST": 0}}
+	// The first command is not delayed
+	t0 := time.Now()
+	assert.NoError(t, c.Write("A"))
+	assert.Less(t, time.Since(t0), 10*time.Millisecond)
+	// Settle time after a command
+	_, err := c.Ask("B?")
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, conn.times["B?"].Sub(conn.times["A"]), 50*time.Millisecond)
+	// The input is flushed after the settle time, as a serial port would lose the command
+	assert.GreaterOrEqual(t, conn.times["flush"].Sub(conn.times["A"]), 50*time.Millisecond)
+	// Gap after a response
+	assert.NoError(t, c.Write("C"))
+	assert.GreaterOrEqual(t, conn.times["C"].Sub(conn.times["B?"]), 20*time.Millisecond)
+	assert.Less(t, conn.times["C"].Sub(conn.times["B?"]), 45*time.Millisecond)
+	// Override
+	assert.NoError(t, c.Write("FAST"))
+	assert.Less(t, conn.times["FAST"].Sub(conn.times["C"]), 10*time.Millisecond)
+	// No delay when the time has passed already
+	time.Sleep(60 * time.Millisecond)
+	t0 = time.Now()
+	assert.NoError(t, c.Write("D"))
+	assert.Less(t, time.Since(t0), 10*time.Millisecond)
+	// The wait is cancelled by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = c.WriteContext(ctx, "E")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, sent := conn.times["E"]
+	assert.False(t, sent)
+}
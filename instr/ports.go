@@ -0,0 +1,57 @@
+package instr
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortInfo describes a serial port found by EnumeratePorts
+type PortInfo struct {
+	Name         string // Port name used by Open(), f.ex. COM5 or /dev/ttyUSB0
+	Description  string // Friendly name, typically manufacturer and product
+	Vid          uint16 // USB vendor id, 0 if not an USB device
+	Pid          uint16 // USB product id, 0 if not an USB device
+	SerialNumber string // USB serial number, if available
+	Link         string // Persistent name like /dev/serial/by-id/usb-FTDI_..., Linux only
+}
+
+// EnumerateSerialPorts will return a list of port names and a list of descriptions
+func EnumerateSerialPorts() ([]string, []string, error) {
+	list, err := EnumeratePorts()
+	if err != nil {
+		return nil, nil, err
+	}
+	var ports []string
+	var info []string
+	for _, p := range list {
+		ports = append(ports, p.Name)
+		info = append(info, p.Description)
+	}
+	return ports, info, nil
+}
+
+// parseHex16 converts a 4 digit hex string like "0403" to a number.
+// Invalid strings give 0.
+func parseHex16(s string) uint16 {
+	v, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(v)
+}
+
+// sortPorts sorts ports by name, with numbers in numeric order so that COM10 follows COM9
+func sortPorts(ports []PortInfo) {
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i].Name, ports[j].Name
+		pa := strings.TrimRight(a, "0123456789")
+		pb := strings.TrimRight(b, "0123456789")
+		if pa != pb {
+			return pa < pb
+		}
+		na, _ := strconv.Atoi(a[len(pa):])
+		nb, _ := strconv.Atoi(b[len(pb):])
+		return na < nb
+	})
+}
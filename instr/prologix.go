@@ -0,0 +1,239 @@
+package instr
+
+// Support for Prologix GPIB-USB and GPIB-ETHERNET adapters.
+// Several instruments can share one adapter, each with its own
+// GPIB primary address. The adapter is opened once and access is
+// serialised, so that the address is set before each transfer.
+// The adapter runs with ++auto 0, so a read must be requested by
+// "++read eoi". GPIB instruments keep their response until addressed
+// to talk, so other instruments can be used between a write and a read.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	prologixPort = 1234 // Tcp port used by the GPIB-ETHERNET adapter
+	prologixEsc  = 27
+)
+
+// prologixAdapter is the shared state for one adapter
+type prologixAdapter struct {
+	mutex   sync.Mutex
+	key     string
+	conn    Connection
+	addr    int // Currently selected address, -1 if unknown
+	users   int
+	timeout time.Duration
+}
+
+var (
+	adapters      = map[string]*prologixAdapter{}
+	adaptersMutex sync.Mutex
+)
+
+// gpib is a io.ReadWriteCloser for one instrument on a prologix adapter
+type gpib struct {
+	adapter *prologixAdapter
+	addr    int
+	pending []byte
+}
+
+// parseGpibAddress checks that s is a valid primary address 0-30
+func parseGpibAddress(s string) (int, error) {
+	addr, err := strconv.Atoi(s)
+	if err != nil || addr < 0 || addr > 30 {
+		return 0, fmt.Errorf("invalid gpib address \"%s\"", s)
+	}
+	return addr, nil
+}
+
+// dialPrologix returns a connection to the instrument with the given address.
+// The adapter is opened on first use, and shared with later users of the same port.
+func dialPrologix(port string, address string, timeout time.Duration) (*gpib, error) {
+	addr, err := parseGpibAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	adaptersMutex.Lock()
+	defer adaptersMutex.Unlock()
+	a, ok := adapters[port]
+	if !ok {
+		a, err = openPrologix(port, timeout)
+		if err != nil {
+			return nil, err
+		}
+		adapters[port] = a
+	}
+	a.users++
+	return &gpib{adapter: a, addr: addr}, nil
+}
+
+// openPrologix opens the serial port or tcp connection and configures the adapter as controller
+func openPrologix(port string, timeout time.Duration) (*prologixAdapter, error) {
+	a := &prologixAdapter{key: port, addr: -1, timeout: timeout}
+	a.conn = Connection{Port: port, Baudrate: 115200, Timeout: timeout, Eol: Lf}
+	if !isSerialName(port) {
+		if _, _, err := net.SplitHostPort(port); err != nil {
+			port = net.JoinHostPort(port, fmt.Sprint(prologixPort))
+		}
+		port = "tcp://" + port
+	}
+	if err := a.conn.Open(port); err != nil {
+		return nil, err
+	}
+	// Read timeout is given in mS, and must be 1-3000
+	tmo := timeout.Milliseconds()
+	if tmo > 3000 {
+		tmo = 3000
+	} else if tmo < 1 {
+		tmo = 1
+	}
+	for _, cmd := range []string{"++mode 1", "++auto 0", "++eoi 1", "++eos 2", "++eot_enable 0", fmt.Sprintf("++read_tmo_ms %d", tmo)} {
+		if err := a.conn.Write(cmd); err != nil {
+			a.conn.Close()
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// selectAddress sends ++addr if another instrument was used last. Must be called with the mutex locked.
+func (a *prologixAdapter) selectAddress(addr int) error {
+	if a.addr == addr {
+		return nil
+	}
+	if err := a.conn.Write("++addr %d", addr); err != nil {
+		a.addr = -1
+		return err
+	}
+	a.addr = addr
+	return nil
+}
+
+// escape will prefix CR, LF, ESC and '+' with ESC, so that the adapter sends them to the instrument
+func escape(b []byte) []byte {
+	var out []byte
+	for _, ch := range b {
+		if ch == '\r' || ch == '\n' || ch == prologixEsc || ch == '+' {
+			out = append(out, prologixEsc)
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
+// Write sends b to the instrument. The line terminator is removed
+// since the adapter appends its own terminator and asserts EOI.
+func (g *gpib) Write(b []byte) (int, error) {
+	data := append(escape(bytes.TrimRight(b, "\r\n")), '\n')
+	a := g.adapter
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err := a.selectAddress(g.addr); err != nil {
+		return 0, err
+	}
+	if c, ok := a.conn.conn.(deadliner); ok {
+		_ = c.SetWriteDeadline(time.Now().Add(a.timeout))
+	}
+	if _, err := a.conn.conn.Write(data); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read addresses the instrument to talk and reads until end of line or timeout
+func (g *gpib) Read(b []byte) (int, error) {
+	if len(g.pending) == 0 {
+		a := g.adapter
+		a.mutex.Lock()
+		err := a.selectAddress(g.addr)
+		if err == nil {
+			err = a.conn.Write("++read eoi")
+		}
+		if err == nil {
+			g.pending, err = a.readLine()
+		}
+		a.mutex.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, g.pending)
+	g.pending = g.pending[n:]
+	return n, nil
+}
+
+// readLine reads from the adapter until a line feed is received or a read times out
+func (a *prologixAdapter) readLine() ([]byte, error) {
+	data, err := a.conn.readResponse()
+	if errors.Is(err, ErrTimeout) {
+		return nil, fmt.Errorf("%w, no response from gpib address %d", ErrTimeout, a.addr)
+	} else if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// EndOfMessage returns true when the response is read, since the adapter reads until EOI
+func (g *gpib) EndOfMessage() bool {
+	return len(g.pending) == 0
+}
+
+// Clear sends Selected Device Clear (SDC) to the instrument
+func (g *gpib) Clear() error {
+	g.pending = nil
+	a := g.adapter
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err := a.selectAddress(g.addr); err != nil {
+		return err
+	}
+	return a.conn.Write("++clr")
+}
+
+// StatusByte does a serial poll of the instrument
+func (g *gpib) StatusByte() (byte, error) {
+	a := g.adapter
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err := a.conn.Write("++spoll %d", g.addr); err != nil {
+		return 0, err
+	}
+	b, err := a.readLine()
+	if err != nil {
+		return 0, err
+	}
+	stb, err := strconv.Atoi(ToString(b))
+	if err != nil {
+		return 0, fmt.Errorf("invalid serial poll response \"%s\"", ToString(b))
+	}
+	return byte(stb), nil
+}
+
+// Flush discards buffered response data
+func (g *gpib) Flush() error {
+	g.pending = nil
+	return nil
+}
+
+// Close releases the adapter, which is closed when the last instrument is closed
+func (g *gpib) Close() error {
+	adaptersMutex.Lock()
+	defer adaptersMutex.Unlock()
+	a := g.adapter
+	a.users--
+	if a.users == 0 {
+		delete(adapters, a.key)
+		a.mutex.Lock()
+		a.conn.Close()
+		a.mutex.Unlock()
+	}
+	return nil
+}
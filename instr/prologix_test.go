@@ -0,0 +1,110 @@
+package instr
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePrologix emulates a GPIB-ETHERNET adapter with instruments at address 5 and 22.
+// Each instrument answers *IDN? with its address and keeps the response until read.
+func fakePrologix(t *testing.T) (net.Listener, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	log := make(chan string, 100)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		addr := 0
+		output := map[int]string{}
+		r := bufio.NewReader(c)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			log <- line
+			switch {
+			case strings.HasPrefix(line, "++addr "):
+				_, _ = fmt.Sscanf(line, "++addr %d", &addr)
+			case line == "++read eoi":
+				_, _ = c.Write([]byte(output[addr] + "\n"))
+				output[addr] = ""
+			case strings.HasPrefix(line, "++spoll"):
+				_, _ = c.Write([]byte("16\n"))
+			case strings.HasPrefix(line, "++"):
+			case line == "*IDN?":
+				output[addr] = fmt.Sprintf("FAKE,GPIB%d,0,1.0", addr)
+			}
+		}
+	}()
+	return l, log
+}
+
+func TestPrologix(t *testing.T) {
+	l, log := fakePrologix(t)
+	defer l.Close()
+	dmm := &Connection{Timeout: 500 * time.Millisecond}
+	assert.NoError(t, dmm.Open("prologix://"+l.Addr().String()+"/22"))
+	psu := &Connection{Timeout: 500 * time.Millisecond}
+	assert.NoError(t, psu.Open("prologix://"+l.Addr().String()+"/5"))
+	assert.Equal(t, 1, len(adapters), "adapter should be shared")
+
+	// Interleave the two instruments
+	assert.NoError(t, dmm.Write("*IDN?"))
+	assert.NoError(t, psu.Write("*IDN?"))
+	s := dmm.ReadString()
+	assert.Equal(t, "FAKE,GPIB22,0,1.0", s)
+	s = psu.ReadString()
+	assert.Equal(t, "FAKE,GPIB5,0,1.0", s)
+
+	stb, err := dmm.StatusByte()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(16), stb)
+
+	// Special characters are escaped
+	assert.NoError(t, dmm.Write("SYST:BEEP +1"))
+
+	dmm.Close()
+	psu.Close()
+	assert.Equal(t, 0, len(adapters), "adapter should be closed")
+
+	var lines []string
+	for done := false; !done; {
+		select {
+		case line := <-log:
+			lines = append(lines, line)
+		case <-time.After(200 * time.Millisecond):
+			done = true
+		}
+	}
+	assert.Contains(t, lines, "++auto 0")
+	assert.Contains(t, lines, "++addr 22")
+	assert.Contains(t, lines, "++addr 5")
+	assert.Contains(t, lines, "SYST:BEEP \x1b+1")
+}
+
+func TestPrologixResource(t *testing.T) {
+	r, err := ParseResource("prologix://COM5/22")
+	assert.NoError(t, err)
+	assert.Equal(t, Prologix, r.Transport)
+	assert.Equal(t, "COM5", r.Address)
+	assert.Equal(t, "22", r.Device)
+	r, err = ParseResource("prologix:///dev/ttyUSB0/7")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/ttyUSB0", r.Address)
+	assert.Equal(t, "7", r.Device)
+	_, err = ParseResource("prologix://COM5")
+	assert.Error(t, err)
+	c := &Connection{}
+	assert.Error(t, c.Open("prologix://COM5/31"))
+}
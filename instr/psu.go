@@ -1,12 +1,26 @@
 package instr
 
+import "context"
+
 // Psu is a generic power supply interface
 type Psu interface {
 	SetOutput(c Chan, voltage float64, current float64) error
+	SetOutputContext(ctx context.Context, c Chan, voltage float64, current float64) error
 	GetOutput(c Chan) (float64, float64, error)
+	GetOutputContext(ctx context.Context, c Chan) (float64, float64, error)
+	GetOutputReading(c Chan) (voltage Reading, current Reading, err error)
+	GetOutputReadingContext(ctx context.Context, c Chan) (voltage Reading, current Reading, err error)
 	GetSetpoint(c Chan) (float64, float64, error)
 	Disable(c Chan)
 	QueryIdn() (string, error)
 	Close()
 	ChannelCount() int
 }
+
+// OutputReadings returns the voltage and current read from a supply channel as readings
+func OutputReadings(source string, ch Chan, voltage float64, current float64) (Reading, Reading) {
+	v, i := NewReading(voltage, VoltDc, 0), NewReading(current, CurrentDc, 0)
+	v.Source, v.Chan = source, ch
+	i.Source, i.Chan = source, ch
+	return v, i
+}
@@ -0,0 +1,103 @@
+package instr
+
+// Buffered reading of responses. A response ends with the configured Eol
+// terminator, at the end of a message on connections that can tell
+// (GPIB EOI, the VXI-11, HiSLIP and USBTMC END flag), or at a timeout.
+// Data received after the terminator is kept for the next read.
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// maxResponseSize is the longest response accepted by ReadLine
+const maxResponseSize = 1 << 24
+
+// messageReader is implemented by connections that know where a response message ends
+type messageReader interface {
+	EndOfMessage() bool
+}
+
+// terminator returns the characters ending a response, or nil if Eol is None
+func (i *Connection) terminator() []byte {
+	switch i.Eol {
+	case Lf:
+		return []byte("\n")
+	case Cr:
+		return []byte("\r")
+	case CrLf:
+		return []byte("\r\n")
+	case LfCr:
+		return []byte("\n\r")
+	}
+	return nil
+}
+
+// read returns buffered input before reading from the connection
+func (i *Connection) read(b []byte) (int, error) {
+	if len(i.input) > 0 {
+		n := copy(b, i.input)
+		i.input = i.input[n:]
+		return n, nil
+	}
+	n, err := i.conn.Read(b)
+	if n > 0 {
+		i.transferred(false)
+	}
+	return n, err
+}
+
+// readResponse reads until the terminator, the end of a message or a timeout.
+// Without a terminator, the response ends when a read returns data, which
+// for serial ports happens when the instrument stops sending.
+// The terminator is not included in the returned data.
+func (i *Connection) readResponse() ([]byte, error) {
+	if i.conn == nil {
+		return nil, ErrClosed
+	}
+	term := i.terminator()
+	deadline := i.deadline()
+	if conn, ok := i.transport().(deadliner); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	msg, isMessage := i.transport().(messageReader)
+	buf := make([]byte, 4096)
+	done := false
+	for {
+		if term != nil {
+			if k := bytes.Index(i.input, term); k >= 0 {
+				data := i.input[:k]
+				i.input = i.input[k+len(term):]
+				return data, nil
+			}
+		}
+		if done {
+			data := i.input
+			i.input = nil
+			return data, nil
+		}
+		if len(i.input) > maxResponseSize {
+			i.input = nil
+			return nil, fmt.Errorf("response is longer than %d bytes", maxResponseSize)
+		}
+		if err := i.cancelled(); err != nil {
+			return nil, err
+		}
+		n, err := i.conn.Read(buf)
+		i.input = append(i.input, buf[:n]...)
+		if n > 0 {
+			i.transferred(false)
+			done = term == nil || (isMessage && msg.EndOfMessage())
+			continue
+		}
+		if err != nil || !time.Now().Before(deadline) {
+			if len(i.input) > 0 {
+				// The timeout ends a response without terminator
+				done = true
+				continue
+			}
+			return nil, i.ioError(err, n)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package instr
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadLine(t *testing.T) {
+	c := &Connection{Timeout: 50 * time.Millisecond, Eol: Lf}
+	long := strings.Repeat("1.234,", 1000)
+	c.conn = &chunkConn{chunks: []string{"+1.2", "3E-3\n", long[:3000], long[3000:] + "\n", "a\rb\x00c\r\n", "x\ny\n"}}
+	s, err := c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "+1.23E-3", s)
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, long, s)
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "a\rb\x00c", s)
+	// The second line arrived in the same chunk, and is kept for the next read
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "x", s)
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "y", s)
+
+	c.Eol = CrLf
+	c.conn = &chunkConn{chunks: []string{"a\nb\r", "\nc"}}
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb", s)
+	// A response without terminator is ended by the timeout
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "c", s)
+
+	// Without terminator, a read returning data ends the response
+	c.Eol = None
+	c.conn = &chunkConn{chunks: []string{"30.00", "1.000"}}
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "30.00", s)
+
+	// Ask discards old data
+	c.Eol = Lf
+	c.conn = &chunkConn{chunks: []string{"old\nnew\n"}}
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "old", s)
+	_, err = c.Ask("X?")
+	assert.ErrorIs(t, err, ErrClosed)
+}
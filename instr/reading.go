@@ -0,0 +1,77 @@
+package instr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Overload is the value returned by SCPI instruments when the input is outside the range
+const Overload = 9.9e37
+
+// underrangeLimit is the fraction of a fixed range below which a lower range should be used
+const underrangeLimit = 0.1
+
+// Reading is a measured value with its unit, time and status, so that logged data is self-describing
+type Reading struct {
+	Value      float64
+	Unit       EngUnit
+	Time       time.Time // When the value was received
+	Range      float64   // The fixed range used, or 0 for autorange or unknown
+	Overload   bool      // The input is outside the range, and Value is not valid
+	Underrange bool      // The value is below 10% of the fixed range, so a lower range gives better resolution
+	Source     string    // The instrument, normally the *IDN? response
+	Chan       Chan      // The channel measured
+}
+
+// NewReading returns a reading of v received now, with the overload and underrange flags set
+func NewReading(v float64, unit EngUnit, rng float64) Reading {
+	r := Reading{Value: v, Unit: unit, Time: time.Now(), Range: rng}
+	r.Overload = math.IsInf(v, 0) || math.IsNaN(v) || math.Abs(v) >= Overload || (rng > 0 && math.Abs(v) > 1.2*rng)
+	r.Underrange = !r.Overload && rng > 0 && math.Abs(v) < underrangeLimit*rng
+	return r
+}
+
+// Valid returns true if the value can be used
+func (r Reading) Valid() bool {
+	return !r.Overload && r.Unit != Illegal
+}
+
+func (r Reading) String() string {
+	s := fmt.Sprintf("%g %s", r.Value, r.Unit)
+	if r.Overload {
+		s = "overload " + r.Unit.String()
+	} else if r.Underrange {
+		s += " (underrange)"
+	}
+	return s
+}
+
+// ParseRange returns the range in a Setup, or 0 for autorange, like "", "AUTO", "MIN" or "MAX"
+func ParseRange(s string) float64 {
+	r, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || r < 0 {
+		return 0
+	}
+	return r
+}
+
+// ScopeUnit returns the unit of an oscilloscope measurement type, like FREQ or CRMS
+func ScopeUnit(typ string) EngUnit {
+	typ = strings.ToUpper(typ)
+	switch {
+	case strings.HasPrefix(typ, "FREQ"):
+		return Hz
+	case strings.HasPrefix(typ, "PERI"), strings.HasPrefix(typ, "RIS"), strings.HasPrefix(typ, "FALL"),
+		strings.HasPrefix(typ, "PWI"), strings.HasPrefix(typ, "NWI"):
+		return Second
+	case strings.HasPrefix(typ, "CRM"), strings.HasPrefix(typ, "RMS"):
+		return VoltAcRms
+	case strings.HasPrefix(typ, "MEAN"), strings.HasPrefix(typ, "PK2"), strings.HasPrefix(typ, "MINI"),
+		strings.HasPrefix(typ, "MAXI"), strings.HasPrefix(typ, "AMP"):
+		return VoltDc
+	}
+	return Illegal
+}
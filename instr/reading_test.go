@@ -0,0 +1,54 @@
+package instr
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReading(t *testing.T) {
+	r := NewReading(1.5, VoltDc, 10)
+	assert.Equal(t, 1.5, r.Value)
+	assert.Equal(t, VoltDc, r.Unit)
+	assert.WithinDuration(t, time.Now(), r.Time, time.Second)
+	assert.False(t, r.Overload)
+	assert.False(t, r.Underrange)
+	assert.True(t, r.Valid())
+	assert.Equal(t, "1.5 VoltDc", r.String())
+
+	r = NewReading(0.5, VoltDc, 10)
+	assert.True(t, r.Underrange)
+	assert.True(t, r.Valid())
+	assert.Equal(t, "0.5 VoltDc (underrange)", r.String())
+	// No underrange with autorange
+	assert.False(t, NewReading(0.5, VoltDc, 0).Underrange)
+
+	for _, v := range []float64{Overload, -Overload, 12.5, math.Inf(1), math.NaN()} {
+		r = NewReading(v, Ohm, 10)
+		assert.True(t, r.Overload, "%g", v)
+		assert.False(t, r.Underrange, "%g", v)
+		assert.False(t, r.Valid(), "%g", v)
+	}
+	assert.Equal(t, "overload Ohm", r.String())
+	assert.False(t, NewReading(1, Illegal, 0).Valid())
+}
+
+func TestParseRange(t *testing.T) {
+	assert.Equal(t, 100.0, ParseRange("100.0"))
+	assert.Equal(t, 0.001, ParseRange(" 1e-3 "))
+	assert.Equal(t, 0.0, ParseRange(""))
+	assert.Equal(t, 0.0, ParseRange("AUTO"))
+	assert.Equal(t, 0.0, ParseRange("-1"))
+}
+
+func TestScopeUnit(t *testing.T) {
+	assert.Equal(t, Hz, ScopeUnit("FREQuency"))
+	assert.Equal(t, Second, ScopeUnit("peri"))
+	assert.Equal(t, Second, ScopeUnit("PWIdth"))
+	assert.Equal(t, VoltAcRms, ScopeUnit("CRMS"))
+	assert.Equal(t, VoltDc, ScopeUnit("PK2pk"))
+	assert.Equal(t, Illegal, ScopeUnit("PHASE"))
+	assert.Equal(t, "EngUnit(99)", EngUnit(99).String())
+}
@@ -0,0 +1,214 @@
+package instr
+
+// Automatic reconnect. When Reconnect.Attempts is set, a connection lost while
+// writing or asking is reopened, with a delay doubling for each attempt, and the
+// operation is repeated once. A serial port that is renamed when the USB adapter
+// is replugged is found by its USB serial number, or by the *IDN? response.
+// The driver restores the instrument state in Reconnect.Init, f.ex. by setting
+// remote mode and sending the configuration again. Init is called with the
+// connection locked, so it must use the ...Context functions with the given ctx.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Default reconnect delays
+const (
+	reconnectDelay    = 100 * time.Millisecond
+	reconnectMaxDelay = 5 * time.Second
+)
+
+// Reconnect is the policy for reopening a lost connection. It is disabled when Attempts is 0.
+type Reconnect struct {
+	Attempts int                             // Number of attempts each time the connection is lost, set before Open
+	Delay    time.Duration                   // Delay before the first attempt, doubled for each attempt. Default 100mS
+	MaxDelay time.Duration                   // Longest delay between attempts. Default 5s
+	Match    string                          // Text in the *IDN? response used to find a renamed port. Default is Name
+	Init     func(ctx context.Context) error // Restores the instrument state after reconnecting, set by the driver
+	Notify   func(ReconnectEvent)            // Called after each attempt
+}
+
+// ReconnectEvent reports an attempt to reopen a lost connection
+type ReconnectEvent struct {
+	Time    time.Time
+	Port    string // The port opened, which is changed if the instrument is found on another port
+	Attempt int    // Attempt number, starting at 1
+	Cause   error  // The error that lost the connection
+	Err     error  // nil if the connection was reopened
+}
+
+func (e ReconnectEvent) String() string {
+	if e.Err != nil {
+		return fmt.Sprintf("reconnect %d to %s failed, %s", e.Attempt, e.Port, e.Err)
+	}
+	return fmt.Sprintf("reconnected to %s after %s", e.Port, e.Cause)
+}
+
+// recover will reopen a lost connection if Reconnect is enabled. It returns
+// true if the operation failing with err should be repeated.
+func (i *Connection) recover(err error) bool {
+	if i.Reconnect.Attempts <= 0 || i.reconnecting || !errors.Is(err, ErrClosed) {
+		return false
+	}
+	if (i.conn == nil && !i.lost) || i.resource.Transport == "" || i.resource.Transport == Replay {
+		// Closed by Close, or not opened by Open
+		return false
+	}
+	ctx := i.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !i.holds(ctx) {
+		// The mutex is held by the operation that failed
+		t := &lockToken{}
+		i.owner.Store(t)
+		defer i.owner.Store(nil)
+		ctx = context.WithValue(ctx, lockKey{i}, t)
+	}
+	i.reconnecting = true
+	defer func() { i.reconnecting = false }()
+	i.disconnect()
+	delay := i.Reconnect.Delay
+	if delay <= 0 {
+		delay = reconnectDelay
+	}
+	maxDelay := i.Reconnect.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = reconnectMaxDelay
+	}
+	for attempt := 1; attempt <= i.Reconnect.Attempts; attempt++ {
+		if Sleep(ctx, delay) != nil {
+			return false
+		}
+		port, e := i.reopen()
+		if e == nil && i.Reconnect.Init != nil {
+			if e = i.Reconnect.Init(ctx); e != nil {
+				i.disconnect()
+				e = fmt.Errorf("init failed, %w", e)
+			}
+		}
+		if i.Reconnect.Notify != nil {
+			i.Reconnect.Notify(ReconnectEvent{Time: time.Now(), Port: port, Attempt: attempt, Cause: err, Err: e})
+		}
+		if e == nil {
+			return true
+		}
+		delay = min(2*delay, maxDelay)
+	}
+	return false
+}
+
+// disconnect closes the transport of a lost connection, leaving the wrappers
+// like the Recorder open, so that they can be used again.
+func (i *Connection) disconnect() {
+	if i.conn != nil {
+		_ = i.transport().Close()
+		i.conn = nil
+	}
+	i.input = nil
+	i.lost = true
+}
+
+// reopen opens the connection again, and returns the port used
+func (i *Connection) reopen() (string, error) {
+	r := i.resource
+	port, err := i.findPort()
+	if err != nil {
+		return r.Address, err
+	}
+	r.Address = port
+	conn, err := i.dial(r)
+	if err != nil {
+		return port, err
+	}
+	for _, wrap := range i.wraps {
+		conn = wrap(conn)
+	}
+	i.conn, i.resource, i.lost = conn, r, false
+	return port, nil
+}
+
+// match returns the text identifying the instrument in the *IDN? response
+func (i *Connection) match() string {
+	if i.Reconnect.Match != "" {
+		return i.Reconnect.Match
+	}
+	return i.Name
+}
+
+// findPort returns the port where the instrument is found. Serial ports are found by the
+// USB serial number, or by asking the ports for *IDN? if the port is gone. Usbtmc devices
+// are found by *IDN? if the device is gone. Other connections use the address given to Open.
+func (i *Connection) findPort() (string, error) {
+	address := i.resource.Address
+	switch i.resource.Transport {
+	case Serial:
+		ports, err := EnumeratePorts()
+		if err != nil {
+			return address, nil
+		}
+		if i.serialNumber != "" {
+			for _, p := range ports {
+				if p.SerialNumber == i.serialNumber {
+					return p.Name, nil
+				}
+			}
+			return "", fmt.Errorf("no port with serial number %s", i.serialNumber)
+		}
+		for _, p := range ports {
+			if p.Name == address || p.Link == address {
+				return address, nil
+			}
+		}
+		if match := i.match(); match != "" {
+			for _, p := range ports {
+				if i.probe(p.Name, match) {
+					return p.Name, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("port %s not found", address)
+	case USBTMC:
+		if _, err := os.Stat(address); err == nil || !strings.HasPrefix(address, "/dev/") {
+			// VISA resources are found by serial number when opened
+			return address, nil
+		}
+		devices, _ := EnumerateUsbtmc()
+		if match := i.match(); match != "" {
+			for _, d := range devices {
+				if strings.Contains(d.Description, match) {
+					return d.Name, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("device %s not found", address)
+	}
+	return address, nil
+}
+
+// probe returns true if the instrument on the serial port responds to *IDN? with match
+func (i *Connection) probe(port string, match string) bool {
+	c := &Connection{Baudrate: i.Baudrate, Timeout: min(i.Timeout, 200*time.Millisecond), Eol: i.Eol}
+	if c.Open(port) != nil {
+		return false
+	}
+	defer c.Close()
+	resp, _ := c.Ask("*IDN?")
+	return strings.Contains(resp, match)
+}
+
+// usbSerialNumber returns the USB serial number of a serial port, or "" if not known
+func usbSerialNumber(port string) string {
+	ports, _ := EnumeratePorts()
+	for _, p := range ports {
+		if p.Name == port || p.Link == port {
+			return p.SerialNumber
+		}
+	}
+	return ""
+}
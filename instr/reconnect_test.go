@@ -0,0 +1,125 @@
+package instr
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoServer echoes each line received, on the given address
+type echoServer struct {
+	listener net.Listener
+	conns    chan net.Conn
+}
+
+func listenEcho(t *testing.T, addr string) *echoServer {
+	l, err := net.Listen("tcp", addr)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	s := &echoServer{listener: l, conns: make(chan net.Conn, 10)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.conns <- c
+			go func() {
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					_, _ = c.Write([]byte(strings.TrimSpace(line) + "\n"))
+				}
+			}()
+		}
+	}()
+	t.Cleanup(s.stop)
+	return s
+}
+
+// stop closes the listener and all connections, as when the instrument is turned off
+func (s *echoServer) stop() {
+	_ = s.listener.Close()
+	for {
+		select {
+		case c := <-s.conns:
+			_ = c.Close()
+		default:
+			return
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	_ = l.Close()
+	server := listenEcho(t, addr)
+	c := &Connection{Timeout: time.Second}
+	assert.NoError(t, c.Open("tcp://"+addr+"?reconnect=3"))
+	assert.Equal(t, 3, c.Reconnect.Attempts)
+	defer c.Close()
+	var events []ReconnectEvent
+	inits := 0
+	c.Reconnect.Delay = 10 * time.Millisecond
+	c.Reconnect.Init = func(ctx context.Context) error {
+		inits++
+		_, err := c.AskContext(ctx, "INIT")
+		return err
+	}
+	c.Reconnect.Notify = func(e ReconnectEvent) { events = append(events, e) }
+	s, err := c.Ask("A?")
+	assert.NoError(t, err)
+	assert.Equal(t, "A?", s)
+
+	// The instrument is restarted
+	server.stop()
+	time.Sleep(10 * time.Millisecond)
+	server = listenEcho(t, addr)
+	s, err = c.Ask("B?")
+	assert.NoError(t, err)
+	assert.Equal(t, "B?", s)
+	assert.Equal(t, 1, inits)
+	if assert.Len(t, events, 1) {
+		assert.NoError(t, events[0].Err)
+		assert.Equal(t, addr, events[0].Port)
+		assert.True(t, errors.Is(events[0].Cause, ErrClosed), "got %v", events[0].Cause)
+	}
+
+	// The instrument is off during all attempts
+	server.stop()
+	events = nil
+	_, err = c.Ask("C?")
+	assert.True(t, errors.Is(err, ErrClosed), "got %v", err)
+	if assert.Len(t, events, 3) {
+		assert.Error(t, events[2].Err)
+		assert.Equal(t, 3, events[2].Attempt)
+	}
+
+	// and is turned on again
+	listenEcho(t, addr)
+	events = nil
+	assert.NoError(t, c.Write("D"))
+	assert.Len(t, events, 1)
+	s, err = c.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "D", s)
+
+	// No reconnect after Close
+	c.Close()
+	events = nil
+	_, err = c.Ask("E?")
+	assert.True(t, errors.Is(err, ErrClosed), "got %v", err)
+	assert.Len(t, events, 0)
+}
@@ -0,0 +1,106 @@
+package instr
+
+// Recording of the traffic to and from an instrument. Each write and read is
+// stored on one line with a timestamp, the direction and the data as a quoted
+// Go string, like this:
+//
+//	2020-11-02T10:15:04.123456+01:00 > "*IDN?\n"
+//	2020-11-02T10:15:04.131072+01:00 < "FLUKE,8845A,2359004,08/02/10-11:53\r\n"
+//
+// Lines starting with # are comments. A transcript can be served back to
+// a driver by the replay transport, see Replay. Transcripts written by hand,
+// like test fixtures, have - instead of the timestamp.
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Directions used in the transcript
+const (
+	recordWrite = ">"
+	recordRead  = "<"
+)
+
+const recordTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Recorder is a io.ReadWriteCloser that copies all traffic to a transcript
+type Recorder struct {
+	mutex sync.Mutex
+	conn  io.ReadWriteCloser
+	w     io.Writer
+}
+
+// NewRecorder returns a Recorder writing the traffic on conn to w.
+// If w is a io.Closer, it is closed together with conn.
+func NewRecorder(conn io.ReadWriteCloser, w io.Writer) *Recorder {
+	return &Recorder{conn: conn, w: w}
+}
+
+// Comment adds a comment line to the transcript
+func (r *Recorder) Comment(format string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, _ = fmt.Fprintf(r.w, "# "+format+"\n", args...)
+}
+
+func (r *Recorder) record(dir string, b []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, _ = fmt.Fprintf(r.w, "%s %s %s\n", time.Now().Format(recordTimeFormat), dir, strconv.Quote(string(b)))
+}
+
+// Write sends b to the instrument and records it
+func (r *Recorder) Write(b []byte) (int, error) {
+	n, err := r.conn.Write(b)
+	if n > 0 {
+		r.record(recordWrite, b[:n])
+	}
+	return n, err
+}
+
+// Read reads from the instrument and records the data received
+func (r *Recorder) Read(b []byte) (int, error) {
+	n, err := r.conn.Read(b)
+	if n > 0 {
+		r.record(recordRead, b[:n])
+	}
+	return n, err
+}
+
+// Unwrap returns the connection being recorded
+func (r *Recorder) Unwrap() io.ReadWriteCloser {
+	return r.conn
+}
+
+// Close will close the connection and the transcript
+func (r *Recorder) Close() error {
+	err := r.conn.Close()
+	if c, ok := r.w.(io.Closer); ok {
+		_ = c.Close()
+	}
+	return err
+}
+
+// Record will copy all following traffic on the connection to w. It is normally
+// enabled by adding record=filename to the resource string given to Open.
+// Recording continues when the connection is reopened by Reconnect.
+func (i *Connection) Record(w io.Writer) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.startRecording(w)
+}
+
+// startRecording is Record without locking
+func (i *Connection) startRecording(w io.Writer) {
+	comment := "Recorded"
+	i.wrap(func(conn io.ReadWriteCloser) io.ReadWriteCloser {
+		r := NewRecorder(conn, w)
+		r.Comment("%s %s", comment, time.Now().Format(recordTimeFormat))
+		comment = "Reconnected"
+		return r
+	})
+}
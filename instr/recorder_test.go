@@ -0,0 +1,53 @@
+package instr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "session.txt")
+	f, err := os.Create(name)
+	assert.NoError(t, err)
+	c := &Connection{Timeout: 50 * time.Millisecond, Eol: Lf}
+	c.conn = &chunkConn{chunks: []string{"FAKE,DMM,0,1.0\r\n", "+1.2", "3E-3\n", "#14\x00\x01\n\x03"}}
+	c.Record(f)
+	name1, err := c.Ask("*IDN?")
+	assert.NoError(t, err)
+	v, err := c.PollFloat("READ?")
+	assert.NoError(t, err)
+	b, err := c.AskBlock("CURVE?")
+	assert.NoError(t, err)
+	assert.NoError(t, c.Write("SYST:LOC"))
+	c.Close()
+
+	transcript, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(transcript)), "\n")
+	assert.Equal(t, 12, len(lines), string(transcript))
+	assert.True(t, strings.HasPrefix(lines[0], "# Recorded"))
+	assert.True(t, strings.HasSuffix(lines[1], ` > "*IDN?\n"`), lines[1])
+	assert.True(t, strings.HasSuffix(lines[2], ` < "FAKE,DMM,0,1.0\r\n"`), lines[2])
+
+	r := &Connection{Timeout: 50 * time.Millisecond, Eol: Lf}
+	assert.NoError(t, r.Open("replay://"+name))
+	s, err := r.Ask("*IDN?")
+	assert.NoError(t, err)
+	assert.Equal(t, name1, s)
+	f2, err := r.PollFloat("READ?")
+	assert.NoError(t, err)
+	assert.Equal(t, v, f2)
+	b2, err := r.AskBlock("CURVE?")
+	assert.NoError(t, err)
+	assert.Equal(t, b, b2)
+	// Commands must match the transcript
+	assert.ErrorContains(t, r.Write("*RST"), `expected "SYST:LOC\n", got "*RST\n"`)
+	assert.NoError(t, r.Write("SYST:LOC"))
+	_, err = r.Ask("*IDN?")
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package instr
+
+// Registry of instrument drivers. Each driver package registers the models it
+// supports in an init function, so that Open can return the right driver for
+// the instrument found. The driver packages must be imported, f.ex. for their
+// side effects only:
+//
+//	import _ "github.com/jkvatne/go-measure/dmm/fluke"
+//
+//	inst, err := instr.Open("tcp://192.168.2.110:3490")
+//	dmm, ok := inst.(instr.Dmm)
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Instrument is implemented by all drivers
+type Instrument interface {
+	QueryIdn() (string, error)
+	Close()
+}
+
+// Driver describes an instrument driver
+type Driver struct {
+	Name     string                                    // Package name, like fluke
+	Models   []string                                  // Patterns for manufacturer and model, see Identity.Match
+	Baudrate int                                       // Baudrate used when identifying instruments on serial ports
+	Eol      eol                                       // Command terminator used when identifying instruments
+	New      func(resource string) (Instrument, error) // Returns the driver for the instrument at resource
+}
+
+// Match returns true if the driver supports the instrument
+func (d Driver) Match(id Identity) bool {
+	for _, pattern := range d.Models {
+		if id.Match(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// identifyTimeout is the read timeout used when identifying an instrument
+const identifyTimeout = 500 * time.Millisecond
+
+var (
+	driversMutex sync.Mutex
+	drivers      []Driver
+)
+
+// Register makes a driver available to Open. It is called by the init function
+// of the driver package, and panics if the name is registered already.
+func Register(d Driver) {
+	driversMutex.Lock()
+	defer driversMutex.Unlock()
+	if d.New == nil {
+		panic("instr: Register driver " + d.Name + " without constructor")
+	}
+	for _, r := range drivers {
+		if r.Name == d.Name {
+			panic("instr: Register called twice for driver " + d.Name)
+		}
+	}
+	drivers = append(drivers, d)
+}
+
+// Drivers returns the registered drivers
+func Drivers() []Driver {
+	driversMutex.Lock()
+	defer driversMutex.Unlock()
+	return append([]Driver(nil), drivers...)
+}
+
+// Lookup returns the driver supporting the instrument, or false if there is none
+func Lookup(id Identity) (Driver, bool) {
+	for _, d := range Drivers() {
+		if d.Match(id) {
+			return d, true
+		}
+	}
+	return Driver{}, false
+}
+
+// setting is a baudrate and terminator to try when identifying an instrument
+type setting struct {
+	baudrate int
+	eol      eol
+}
+
+// settings returns the settings to try for the resource. Serial ports are tried with
+// the settings of each driver, while other connections need only the terminator.
+func settings(r Resource) []setting {
+	list := []setting{{0, Lf}}
+	for _, d := range Drivers() {
+		s := setting{eol: d.Eol}
+		if r.Transport == Serial {
+			s.baudrate = d.Baudrate
+		}
+		found := false
+		for _, t := range list {
+			found = found || t == s
+		}
+		if !found {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// Identify returns the identity of the instrument at resource, and the driver supporting it.
+// Serial ports are tried with the baudrate and terminator of each registered driver.
+func Identify(resource string) (Identity, Driver, error) {
+	id, d, _, err := identify(context.Background(), resource, identifyTimeout)
+	return id, d, err
+}
+
+// identify is Identify with a timeout for each probe, also returning the setting that got
+// a response. The identity is returned with an error if there is no driver for it.
+func identify(ctx context.Context, resource string, timeout time.Duration) (Identity, Driver, setting, error) {
+	r, err := ParseResource(resource)
+	if err != nil {
+		return Identity{}, Driver{}, setting{}, err
+	}
+	var found *Identity
+	var foundSetting setting
+	for _, s := range settings(r) {
+		if e := ctx.Err(); e != nil {
+			return Identity{}, Driver{}, setting{}, e
+		}
+		c := &Connection{Baudrate: s.baudrate, Eol: s.eol, Timeout: timeout}
+		if err = c.Open(resource); err != nil {
+			if r.Transport == Serial {
+				continue
+			}
+			return Identity{}, Driver{}, setting{}, err
+		}
+		var id Identity
+		id, err = c.Identify()
+		c.Close()
+		if err != nil || id.Manufacturer == "" {
+			continue
+		}
+		if d, ok := Lookup(id); ok {
+			return id, d, s, nil
+		}
+		if found == nil {
+			found, foundSetting = &id, s
+		}
+	}
+	if found != nil {
+		return *found, Driver{}, foundSetting, fmt.Errorf("no driver for %s", found)
+	}
+	if err != nil {
+		// The error from the last setting tried, like a timeout or a port in use
+		return Identity{}, Driver{}, setting{}, fmt.Errorf("no instrument responding to *IDN? at %s, %w", resource, err)
+	}
+	return Identity{}, Driver{}, setting{}, fmt.Errorf("no instrument responding to *IDN? at %s", resource)
+}
+
+// Open identifies the instrument at resource, and returns it opened by its driver.
+// The result can be tested for the Dmm, Psu or Scope interfaces, or the driver type.
+// An empty resource opens the first instrument with a driver found on the usbtmc devices and serial ports.
+func Open(resource string) (Instrument, error) {
+	if strings.TrimSpace(resource) == "" {
+		found, err := Discover(context.Background(), Local())
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			if f.Driver != "" {
+				resource = f.Resource
+				break
+			}
+		}
+		if resource == "" {
+			return nil, fmt.Errorf("%w with a driver, found %s", ErrNotFound, found[0])
+		}
+	}
+	_, d, err := Identify(resource)
+	if err != nil {
+		return nil, err
+	}
+	return d.New(resource)
+}
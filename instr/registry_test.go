@@ -0,0 +1,130 @@
+package instr
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// idnServer answers *IDN? with idn, and ignores other commands
+func idnServer(t *testing.T, idn string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if strings.TrimSpace(line) == "*IDN?" {
+						_, _ = c.Write([]byte(idn + "\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// testInstrument is the instrument returned by the test driver
+type testInstrument struct {
+	Connection
+}
+
+// testDriver returns a driver for the models, opening a testInstrument
+func testDriver(name string, models ...string) Driver {
+	return Driver{Name: name, Models: models, Eol: Lf, New: func(resource string) (Instrument, error) {
+		inst := &testInstrument{}
+		inst.Timeout = time.Second
+		if err := inst.Open(resource); err != nil {
+			return nil, err
+		}
+		return inst, nil
+	}}
+}
+
+// register registers the driver until the test is done
+func register(t *testing.T, d Driver) {
+	Register(d)
+	t.Cleanup(func() {
+		driversMutex.Lock()
+		defer driversMutex.Unlock()
+		for k := range drivers {
+			if drivers[k].Name == d.Name {
+				drivers = append(drivers[:k], drivers[k+1:]...)
+				break
+			}
+		}
+	})
+}
+
+func TestRegister(t *testing.T) {
+	d := testDriver("registry-test", "ACME,X?")
+	assert.Panics(t, func() { Register(Driver{Name: d.Name}) }, "no constructor")
+	register(t, d)
+	assert.Panics(t, func() { Register(d) }, "registered twice")
+
+	found, ok := Lookup(Identity{Manufacturer: "Acme", Model: "X2"})
+	assert.True(t, ok)
+	assert.Equal(t, "registry-test", found.Name)
+	_, ok = Lookup(Identity{Manufacturer: "ACME", Model: "Y2"})
+	assert.False(t, ok)
+
+	addr := idnServer(t, "ACME,X2,1234,1.0")
+	id, found, err := Identify("tcp://" + addr)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{"ACME", "X2", "1234", "1.0"}, id)
+	assert.Equal(t, "registry-test", found.Name)
+	inst, err := Open(addr)
+	if assert.NoError(t, err) {
+		assert.IsType(t, &testInstrument{}, inst)
+		inst.Close()
+	}
+
+	// No driver for the instrument found
+	addr = idnServer(t, "ACME,Y2,1234,1.0")
+	id, _, err = Identify(addr)
+	assert.ErrorContains(t, err, "no driver for ACME,Y2")
+	assert.Equal(t, "Y2", id.Model)
+	_, err = Open(addr)
+	assert.Error(t, err)
+
+	// No response
+	addr = idnServer(t, "")
+	_, _, err = Identify(addr)
+	assert.ErrorContains(t, err, "no instrument responding")
+
+	// The error from the probe is returned, here from a connection closed at once
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = c.Close()
+		}
+	}()
+	_, _, err = Identify(l.Addr().String())
+	assert.ErrorContains(t, err, "no instrument responding")
+	assert.NotEqual(t, "no instrument responding to *IDN? at "+l.Addr().String(), err.Error(), "the error from the probe is lost")
+}
@@ -0,0 +1,107 @@
+package instr
+
+// Replay of a recorded transcript, making it possible to test drivers
+// without the instrument. The commands written by the driver must match
+// the recorded commands, and the recorded responses are returned by Read.
+// The timing of the recording is not repeated.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// replayEntry is one line in a transcript
+type replayEntry struct {
+	line int
+	dir  string
+	data string
+}
+
+// replay is a io.ReadWriteCloser serving a transcript
+type replay struct {
+	name    string
+	entries []replayEntry
+	pending string
+}
+
+// parseTranscript reads a transcript written by a Recorder or by hand. The time is not used.
+func parseTranscript(r io.Reader) ([]replayEntry, error) {
+	var entries []replayEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxResponseSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || (fields[1] != recordWrite && fields[1] != recordRead) {
+			return nil, fmt.Errorf("invalid transcript line %d", n)
+		}
+		data, err := strconv.Unquote(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid data in transcript line %d, %s", n, err)
+		}
+		entries = append(entries, replayEntry{line: n, dir: fields[1], data: data})
+	}
+	return entries, scanner.Err()
+}
+
+// dialReplay opens the transcript file
+func dialReplay(name string) (*replay, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := parseTranscript(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", name, err)
+	}
+	return &replay{name: name, entries: entries}, nil
+}
+
+// Write checks that b is the next command in the transcript
+func (r *replay) Write(b []byte) (int, error) {
+	r.pending = ""
+	// Responses not read by the driver are skipped
+	for len(r.entries) > 0 && r.entries[0].dir == recordRead {
+		r.entries = r.entries[1:]
+	}
+	if len(r.entries) == 0 {
+		return 0, fmt.Errorf("%s ended, got %q", r.name, string(b))
+	}
+	e := r.entries[0]
+	if e.data != string(b) {
+		return 0, fmt.Errorf("%s line %d expected %q, got %q", r.name, e.line, e.data, string(b))
+	}
+	r.entries = r.entries[1:]
+	return len(b), nil
+}
+
+// Read returns the recorded response. ErrTimeout is returned if the
+// next entry is a command, since the instrument did not respond then.
+func (r *replay) Read(b []byte) (int, error) {
+	if r.pending == "" {
+		if len(r.entries) == 0 {
+			return 0, io.EOF
+		}
+		if r.entries[0].dir != recordRead {
+			return 0, ErrTimeout
+		}
+		r.pending = r.entries[0].data
+		r.entries = r.entries[1:]
+	}
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Close does nothing, the transcript is read when opened
+func (r *replay) Close() error {
+	return nil
+}
@@ -0,0 +1,282 @@
+package instr
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transport names used in resource strings
+const (
+	Serial   = "serial"
+	TCP      = "tcp"
+	VXI11    = "vxi11"
+	HiSLIP   = "hislip"
+	USBTMC   = "usbtmc"
+	Prologix = "prologix"
+	Replay   = "replay"
+)
+
+// Resource is a parsed resource string describing how to connect to an instrument.
+// The following forms are accepted:
+//
+//	COM5, /dev/ttyUSB0                      serial port
+//	192.168.2.18:9221                       raw tcp socket
+//	serial:///dev/ttyUSB0?baud=9600&eol=lf  serial port with settings
+//	serial://COM5?baud=19200
+//	tcp://192.168.2.18:9221?timeout=500ms   raw tcp socket with settings
+//	tcp://192.168.2.18:3490?strict=1        check the error queue after each command
+//	serial://COM5?reconnect=5               reopen the port if lost, with 5 attempts
+//	serial://COM5?gap=50ms&settle=100ms     minimum time between commands, see Pacing
+//	ASRL3::INSTR, ASRL/dev/ttyUSB0::INSTR   VISA serial port
+//	TCPIP0::192.168.2.18::5025::SOCKET      VISA raw socket
+//	vxi11://192.168.2.18/inst0              VXI-11 device, port is the portmapper
+//	TCPIP0::192.168.2.18::inst0::INSTR      VISA VXI-11 device, inst0 is default
+//	hislip://192.168.2.18:4880/hislip0      HiSLIP session, port 4880 is default
+//	192.168.2.18:4880                       HiSLIP, since port 4880 is reserved for it
+//	TCPIP0::192.168.2.18::hislip0::INSTR    VISA HiSLIP session
+//	/dev/usbtmc0, usbtmc:///dev/usbtmc0     USBTMC device (linux only)
+//	USB0::0x1AB1::0x04CE::DS1ZA123::INSTR   VISA USBTMC device, found by vid, pid and serial number
+//	prologix://COM5/22                      GPIB address 22 on a Prologix GPIB-USB adapter
+//	prologix:///dev/ttyUSB0/22
+//	prologix://192.168.2.50/22              GPIB-ETHERNET adapter, port 1234 is default
+//	replay://testdata/fluke.txt             replay of a transcript recorded with record=testdata/fluke.txt
+type Resource struct {
+	Transport string     // Serial, TCP, VXI11, HiSLIP, USBTMC, Prologix or Replay
+	Address   string     // Port name or host:port
+	Device    string     // Device name within the instrument, f.ex. inst0, hislip0 or a gpib address
+	Params    url.Values // Optional settings: baud, eol, timeout, strict, record, reconnect, gap, settle
+}
+
+// ParseResource will split a resource string into transport, address and parameters
+func ParseResource(s string) (Resource, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Resource{}, fmt.Errorf("empty resource string")
+	}
+	if strings.Contains(s, "::") {
+		return parseVisa(s)
+	}
+	if strings.Contains(s, "://") {
+		return parseURI(s)
+	}
+	if strings.HasPrefix(s, "/dev/usbtmc") {
+		return Resource{Transport: USBTMC, Address: s, Params: url.Values{}}, nil
+	}
+	if isSerialName(s) {
+		return Resource{Transport: Serial, Address: s, Params: url.Values{}}, nil
+	}
+	if _, port, err := net.SplitHostPort(s); err == nil && port == fmt.Sprint(hislipPort) {
+		return Resource{Transport: HiSLIP, Address: s, Device: "hislip0", Params: url.Values{}}, nil
+	}
+	return Resource{Transport: TCP, Address: s, Params: url.Values{}}, nil
+}
+
+// isSerialName returns true for names like COM5 or /dev/ttyUSB0
+func isSerialName(s string) bool {
+	return strings.HasPrefix(s, "COM") || strings.HasPrefix(s, "/dev/")
+}
+
+func parseURI(s string) (Resource, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Resource{}, fmt.Errorf("invalid resource %s, %s", s, err)
+	}
+	r := Resource{Transport: strings.ToLower(u.Scheme), Address: u.Host + u.Path, Params: u.Query()}
+	switch r.Transport {
+	case Serial:
+		if r.Address == "" {
+			return Resource{}, fmt.Errorf("missing port name in %s", s)
+		}
+	case TCP:
+		if u.Port() == "" {
+			return Resource{}, fmt.Errorf("missing tcp port number in %s", s)
+		}
+		r.Address = u.Host
+	case Prologix:
+		pos := strings.LastIndex(r.Address, "/")
+		if pos <= 0 {
+			return Resource{}, fmt.Errorf("missing gpib address in %s", s)
+		}
+		r.Address, r.Device = r.Address[:pos], r.Address[pos+1:]
+	case USBTMC:
+		if r.Address == "" {
+			return Resource{}, fmt.Errorf("missing device name in %s", s)
+		}
+	case Replay:
+		if r.Address == "" {
+			return Resource{}, fmt.Errorf("missing transcript file name in %s", s)
+		}
+	case VXI11:
+		r.Address = u.Host
+		r.Device = strings.TrimPrefix(u.Path, "/")
+		if r.Device == "" {
+			r.Device = "inst0"
+		}
+	case HiSLIP:
+		r.Address = u.Host
+		r.Device = strings.TrimPrefix(u.Path, "/")
+		if r.Device == "" {
+			r.Device = "hislip0"
+		}
+	default:
+		return Resource{}, fmt.Errorf("unknown transport %s", u.Scheme)
+	}
+	return r, nil
+}
+
+// parseVisa handles the VISA resource strings for serial ports and sockets
+func parseVisa(s string) (Resource, error) {
+	parts := strings.Split(s, "::")
+	kind := strings.ToUpper(parts[0])
+	suffix := strings.ToUpper(parts[len(parts)-1])
+	switch {
+	case strings.HasPrefix(kind, "ASRL"):
+		if len(parts) > 2 || (len(parts) == 2 && suffix != "INSTR") {
+			return Resource{}, fmt.Errorf("invalid serial resource %s", s)
+		}
+		port := parts[0][4:]
+		if n, err := strconv.Atoi(port); err == nil {
+			// ASRL1 is the first serial port, COM1 on windows and /dev/ttyS0 on linux
+			if runtime.GOOS == "windows" {
+				port = fmt.Sprintf("COM%d", n)
+			} else {
+				port = fmt.Sprintf("/dev/ttyS%d", n-1)
+			}
+		}
+		if port == "" {
+			return Resource{}, fmt.Errorf("missing port in %s", s)
+		}
+		return Resource{Transport: Serial, Address: port, Params: url.Values{}}, nil
+	case strings.HasPrefix(kind, "TCPIP"):
+		if len(parts) == 4 && suffix == "SOCKET" {
+			return Resource{Transport: TCP, Address: parts[1] + ":" + parts[2], Params: url.Values{}}, nil
+		}
+		if len(parts) == 3 && suffix == "INSTR" {
+			return Resource{Transport: VXI11, Address: parts[1], Device: "inst0", Params: url.Values{}}, nil
+		}
+		if len(parts) == 4 && suffix == "INSTR" && strings.HasPrefix(strings.ToLower(parts[2]), "hislip") {
+			// The sub address may include the port number, as in hislip0,4880
+			device, port, found := strings.Cut(parts[2], ",")
+			address := parts[1]
+			if found {
+				address = net.JoinHostPort(address, port)
+			}
+			return Resource{Transport: HiSLIP, Address: address, Device: device, Params: url.Values{}}, nil
+		}
+		if len(parts) == 4 && suffix == "INSTR" {
+			return Resource{Transport: VXI11, Address: parts[1], Device: parts[2], Params: url.Values{}}, nil
+		}
+		return Resource{}, fmt.Errorf("unsupported tcpip resource %s", s)
+	case strings.HasPrefix(kind, "USB"):
+		if len(parts) < 4 || suffix != "INSTR" {
+			return Resource{}, fmt.Errorf("invalid usb resource %s", s)
+		}
+		return Resource{Transport: USBTMC, Address: s, Params: url.Values{}}, nil
+	}
+	return Resource{}, fmt.Errorf("unsupported resource %s", s)
+}
+
+// ParseEol converts a name like "lf", "crlf" or "none" to the eol constant
+func ParseEol(s string) (eol, error) {
+	switch strings.ToLower(s) {
+	case "lf":
+		return Lf, nil
+	case "cr":
+		return Cr, nil
+	case "crlf":
+		return CrLf, nil
+	case "lfcr":
+		return LfCr, nil
+	case "none":
+		return None, nil
+	}
+	return Lf, fmt.Errorf("unknown line terminator %s", s)
+}
+
+// String returns the name of the terminator, as used in resource strings
+func (e eol) String() string {
+	switch e {
+	case Cr:
+		return "cr"
+	case CrLf:
+		return "crlf"
+	case LfCr:
+		return "lfcr"
+	case None:
+		return "none"
+	}
+	return "lf"
+}
+
+// parseTimeout accepts durations like "500ms" or "2s", or a number of milliseconds
+func parseTimeout(s string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(s); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// apply will copy the resource parameters to the connection settings.
+// Settings not given in the resource are left unchanged. All parameters are
+// checked before any setting is changed, so that an error leaves them all unchanged.
+func (i *Connection) apply(r Resource) error {
+	baudrate, eol, timeout, strict, record := i.Baudrate, i.Eol, i.Timeout, i.Strict, i.record
+	gap, settle, attempts := i.Pacing.Gap, i.Pacing.Settle, i.Reconnect.Attempts
+	for key := range r.Params {
+		v := r.Params.Get(key)
+		switch strings.ToLower(key) {
+		case "baud", "baudrate":
+			b, err := strconv.Atoi(v)
+			if err != nil || b <= 0 {
+				return fmt.Errorf("invalid baudrate %s", v)
+			}
+			baudrate = b
+		case "eol":
+			e, err := ParseEol(v)
+			if err != nil {
+				return err
+			}
+			eol = e
+		case "timeout":
+			t, err := parseTimeout(v)
+			if err != nil || t <= 0 {
+				return fmt.Errorf("invalid timeout %s", v)
+			}
+			timeout = t
+		case "strict":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid strict value %s", v)
+			}
+			strict = b
+		case "record":
+			record = v
+		case "gap", "settle":
+			t, err := parseTimeout(v)
+			if err != nil || t < 0 {
+				return fmt.Errorf("invalid %s %s", key, v)
+			}
+			if strings.ToLower(key) == "gap" {
+				gap = t
+			} else {
+				settle = t
+			}
+		case "reconnect":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid reconnect attempts %s", v)
+			}
+			attempts = n
+		default:
+			return fmt.Errorf("unknown parameter %s", key)
+		}
+	}
+	i.Baudrate, i.Eol, i.Timeout, i.Strict, i.record = baudrate, eol, timeout, strict, record
+	i.Pacing.Gap, i.Pacing.Settle, i.Reconnect.Attempts = gap, settle, attempts
+	return nil
+}
@@ -0,0 +1,97 @@
+package instr
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResource(t *testing.T) {
+	ttyS2 := "/dev/ttyS2"
+	if runtime.GOOS == "windows" {
+		ttyS2 = "COM3"
+	}
+	tests := []struct {
+		in        string
+		transport string
+		address   string
+	}{
+		{"COM5", Serial, "COM5"},
+		{"/dev/ttyUSB0", Serial, "/dev/ttyUSB0"},
+		{"192.168.2.18:9221", TCP, "192.168.2.18:9221"},
+		{"serial:///dev/ttyUSB0?baud=9600&eol=lf", Serial, "/dev/ttyUSB0"},
+		{"serial://COM5?baud=19200", Serial, "COM5"},
+		{"tcp://192.168.2.18:9221", TCP, "192.168.2.18:9221"},
+		{"ASRL3::INSTR", Serial, ttyS2},
+		{"ASRL/dev/ttyUSB1::INSTR", Serial, "/dev/ttyUSB1"},
+		{"TCPIP0::192.168.2.18::5025::SOCKET", TCP, "192.168.2.18:5025"},
+	}
+	for _, tc := range tests {
+		r, err := ParseResource(tc.in)
+		assert.NoError(t, err, tc.in)
+		assert.Equal(t, tc.transport, r.Transport, tc.in)
+		assert.Equal(t, tc.address, r.Address, tc.in)
+	}
+	for _, s := range []string{"", "tcp://host", "ftp://host:21", "GPIB0::22::INSTR", "serial://"} {
+		_, err := ParseResource(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestApplyResource(t *testing.T) {
+	c := &Connection{Baudrate: 115200, Eol: Lf}
+	r, err := ParseResource("serial:///dev/ttyUSB0?baud=9600&eol=none&timeout=250ms")
+	assert.NoError(t, err)
+	assert.NoError(t, c.apply(r))
+	assert.Equal(t, 9600, c.Baudrate)
+	assert.Equal(t, None, c.Eol)
+	assert.Equal(t, 250*time.Millisecond, c.Timeout)
+
+	r, _ = ParseResource("tcp://localhost:5025?timeout=1500")
+	assert.NoError(t, c.apply(r))
+	assert.Equal(t, 1500*time.Millisecond, c.Timeout)
+
+	r, _ = ParseResource("serial://COM1?gap=50ms&settle=100&reconnect=3")
+	assert.NoError(t, c.apply(r))
+	assert.Equal(t, Pacing{Gap: 50 * time.Millisecond, Settle: 100 * time.Millisecond}, c.Pacing)
+	assert.Equal(t, 3, c.Reconnect.Attempts)
+
+	for _, s := range []string{"serial://COM1?baud=x", "serial://COM1?eol=xx", "serial://COM1?parity=odd", "tcp://h:1?timeout=-1s", "serial://COM1?gap=x", "serial://COM1?reconnect=-1"} {
+		r, _ = ParseResource(s)
+		assert.Error(t, c.apply(r), s)
+	}
+}
+
+func TestOpenTcpResource(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	c := &Connection{}
+	err = c.Open("tcp://" + l.Addr().String() + "?eol=crlf&timeout=300ms")
+	assert.NoError(t, err)
+	assert.Equal(t, CrLf, c.Eol)
+	assert.Equal(t, 300*time.Millisecond, c.Timeout)
+	c.Close()
+}
+
+func TestOpenInvalidResource(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	// A failed Open leaves all the settings unchanged, also those given before the invalid one
+	c := &Connection{Baudrate: 19200, Eol: Lf, Timeout: time.Second}
+	for k := 0; k < 20; k++ {
+		err = c.Open("tcp://" + l.Addr().String() + "?eol=crlf&timeout=300ms&strict=1&gap=5ms&reconnect=2&record=x.txt&baud=9600&settle=x")
+		assert.Error(t, err)
+		assert.Equal(t, 19200, c.Baudrate)
+		assert.Equal(t, Lf, c.Eol)
+		assert.Equal(t, time.Second, c.Timeout)
+		assert.False(t, c.Strict)
+		assert.Equal(t, Pacing{}, c.Pacing)
+		assert.Equal(t, 0, c.Reconnect.Attempts)
+		assert.Equal(t, "", c.record)
+	}
+}
@@ -2,6 +2,8 @@
 
 package instr
 
+import "context"
+
 // SampleMode indicates the decimation mode going from the raw sampling interval
 // to the time between stored samples
 type SampleMode int
@@ -57,8 +59,16 @@ type Scope interface {
 	SetupTrigger(sourceChan Chan, coupling Coupling, slope Slope, trigLevel float64, auto bool, xPos float64) error
 	// Measure data on channel. Type may vary, typical FREQUENCY, CRMS etc
 	Measure(ch Chan, typ string) (float64, error)
+	// MeasureContext is Measure that can be cancelled by ctx
+	MeasureContext(ctx context.Context, ch Chan, typ string) (float64, error)
+	// MeasureReading is Measure returning the value with unit, time and status
+	MeasureReading(ch Chan, typ string) (Reading, error)
+	// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+	MeasureReadingContext(ctx context.Context, ch Chan, typ string) (Reading, error)
 	// Return the data points for a single scan on selected channels
 	GetSamples() ([][]float64, error)
+	// GetSamplesContext is GetSamples that can be cancelled by ctx
+	GetSamplesContext(ctx context.Context) ([][]float64, error)
 	// GetTime will return horizontal settings
 	GetTime() (sampleIntervalSec float64, xPosSec float64)
 	// Close will close communication channel
@@ -0,0 +1,110 @@
+package instr
+
+// SCPI error checking. In strict mode the error queue is read after each
+// command, so that a mistyped command or an illegal parameter is reported
+// by the function sending it, and not ignored by the instrument.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxErrorQueue limits the number of errors read from the error queue
+const maxErrorQueue = 32
+
+// SCPIError is an error reported by the instrument
+type SCPIError struct {
+	Code    int    // Error number, like -113
+	Message string // Error text from the instrument, like "Undefined header"
+	Command string // The command sent before the error was detected
+}
+
+func (e *SCPIError) Error() string {
+	if e.Command == "" {
+		return fmt.Sprintf("instrument error %d, %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("instrument error %d, %s, after \"%s\"", e.Code, e.Message, e.Command)
+}
+
+// ParseSCPIError parses a response to SYST:ERR? like -113,"Undefined header".
+// It returns nil for +0,"No error".
+func ParseSCPIError(s string, command string) (*SCPIError, error) {
+	codeString, msg, _ := strings.Cut(strings.TrimSpace(s), ",")
+	// Some instruments repeat the header before the code
+	if k := strings.LastIndex(codeString, " "); k >= 0 {
+		codeString = codeString[k+1:]
+	}
+	code, err := strconv.Atoi(strings.TrimPrefix(codeString, "+"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid error queue response \"%s\"", s)
+	}
+	if code == 0 {
+		return nil, nil
+	}
+	return &SCPIError{Code: code, Message: strings.Trim(strings.TrimSpace(msg), "\""), Command: command}, nil
+}
+
+// esrErrors are the error bits in the standard event status register, with the
+// SCPI error class used when reporting them
+var esrErrors = []struct {
+	bit  int
+	code int
+	msg  string
+}{
+	{0x20, -100, "command error"},
+	{0x10, -200, "execution error"},
+	{0x08, -300, "device dependent error"},
+	{0x04, -400, "query error"},
+}
+
+// CheckError reads the instrument error queue, and returns the errors as SCPIError.
+// The command is the one sent before, and is used in the error message.
+// ErrorQuery selects SYST:ERR? (the default) or *ESR?, for instruments without an error queue.
+func (i *Connection) CheckError(command string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.checkError(command)
+}
+
+// checkError is CheckError without locking
+func (i *Connection) checkError(command string) error {
+	if strings.EqualFold(i.ErrorQuery, "*ESR?") {
+		esr, err := i.pollFloat("*ESR?")
+		if err != nil {
+			return fmt.Errorf("could not read error status, %w", err)
+		}
+		for _, e := range esrErrors {
+			if int(esr)&e.bit != 0 {
+				return &SCPIError{Code: e.code, Message: e.msg, Command: command}
+			}
+		}
+		return nil
+	}
+	query := i.ErrorQuery
+	if query == "" {
+		query = "SYST:ERR?"
+	}
+	var errs []error
+	for n := 0; n < maxErrorQueue; n++ {
+		resp, err := i.query(query)
+		if err != nil {
+			return fmt.Errorf("could not read error queue, %w", err)
+		}
+		e, err := ParseSCPIError(resp, command)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			break
+		}
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// isQuery returns true for commands with a response
+func isQuery(s string) bool {
+	return strings.Contains(s, "?")
+}
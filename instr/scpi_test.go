@@ -0,0 +1,95 @@
+package instr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// queueConn is an instrument with an error queue. Commands starting with X are undefined.
+type queueConn struct {
+	queue    []string
+	esr      int
+	response string
+}
+
+func (c *queueConn) Write(b []byte) (int, error) {
+	cmd := strings.TrimSpace(string(b))
+	switch {
+	case cmd == "SYST:ERR?":
+		c.response = "+0,\"No error\"\n"
+		if len(c.queue) > 0 {
+			c.response, c.queue = c.queue[0]+"\n", c.queue[1:]
+		}
+	case cmd == "*ESR?":
+		c.response = "32\n"
+		if c.esr == 0 {
+			c.response = "0\n"
+		}
+		c.esr = 0
+	case strings.HasPrefix(cmd, "X"):
+		c.queue = append(c.queue, "-113,\"Undefined header\"")
+		c.esr = 0x20
+	case strings.HasPrefix(cmd, "TWO"):
+		c.queue = append(c.queue, "-222,\"Data out of range\"", "-221,\"Settings conflict\"")
+	}
+	return len(b), nil
+}
+
+func (c *queueConn) Read(b []byte) (int, error) {
+	n := copy(b, c.response)
+	c.response = c.response[n:]
+	return n, nil
+}
+
+func (c *queueConn) Close() error {
+	return nil
+}
+
+func TestParseSCPIError(t *testing.T) {
+	e, err := ParseSCPIError("-113,\"Undefined header\"", "TRIG:X")
+	assert.NoError(t, err)
+	assert.Equal(t, &SCPIError{Code: -113, Message: "Undefined header", Command: "TRIG:X"}, e)
+	e, err = ParseSCPIError("+0,\"No error\"", "")
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+	e, err = ParseSCPIError(":SYST:ERR -222,\"Data out of range;VOLT 99\"", "")
+	assert.NoError(t, err)
+	assert.Equal(t, -222, e.Code)
+	assert.Equal(t, "Data out of range;VOLT 99", e.Message)
+	_, err = ParseSCPIError("garbage", "")
+	assert.Error(t, err)
+}
+
+func TestStrict(t *testing.T) {
+	q := &queueConn{}
+	c := &Connection{Timeout: 50 * time.Millisecond, conn: q}
+	// Errors are not checked unless strict
+	assert.NoError(t, c.Write("XYZ 1"))
+	assert.Error(t, c.CheckError(""))
+	assert.NoError(t, c.CheckError(""))
+
+	c.Strict = true
+	assert.NoError(t, c.Write("VOLT 1"))
+	err := c.Write("XYZ 1")
+	var e *SCPIError
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, -113, e.Code)
+	assert.Equal(t, "XYZ 1", e.Command)
+
+	// All errors in the queue are returned
+	err = c.Write("TWO")
+	assert.ErrorContains(t, err, "-222")
+	assert.ErrorContains(t, err, "-221")
+	assert.Empty(t, q.queue)
+
+	c.ErrorQuery = "*ESR?"
+	assert.Error(t, c.CheckError(""), "event status is not cleared by SYST:ERR?")
+	assert.NoError(t, c.Write("VOLT 1"))
+	err = c.Write("XYZ 2")
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, -100, e.Code)
+}
@@ -0,0 +1,122 @@
+package instr
+
+// Locking of a connection shared by several goroutines, like a polling loop and
+// a GUI handler. Each function on a Connection holds the lock until it returns,
+// so that Ask sends the query and reads the response without commands from other
+// goroutines in between. A sequence of commands is made atomic by Lock, which
+// returns a context holding the lock. It is passed to the ...Context functions
+// until Unlock is called, as the other functions would wait for the lock:
+//
+//	ctx = c.Lock(ctx)
+//	defer c.Unlock(ctx)
+//	err := c.WriteContext(ctx, "MEASU:IMM:SOU CH1")
+//	...
+//	v, err := c.PollFloatContext(ctx, "MEASU:IMM:VAL?")
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errNotLocked is returned by Unlock when the context does not hold the lock
+var errNotLocked = errors.New("connection is not locked by the context")
+
+// lockKey is the context key for the token of the lock on conn
+type lockKey struct {
+	conn *Connection
+}
+
+// lockToken identifies one Lock call. It is invalid when Unlock releases it,
+// so that a context kept after Unlock does not hold the lock.
+type lockToken struct {
+	depth int // Number of nested Lock calls
+}
+
+// mutex is a lock that can be waited for until a context is done. The zero value is unlocked.
+type mutex struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+// Lock waits for the lock
+func (m *mutex) Lock() {
+	m.once.Do(func() { m.ch = make(chan struct{}, 1) })
+	m.ch <- struct{}{}
+}
+
+// LockContext waits for the lock, or returns the ctx error when ctx is done
+func (m *mutex) LockContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.once.Do(func() { m.ch = make(chan struct{}, 1) })
+	select {
+	case m.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unlock releases the lock
+func (m *mutex) Unlock() {
+	select {
+	case <-m.ch:
+	default:
+		panic("unlock of unlocked connection")
+	}
+}
+
+// Lock waits for exclusive access to the connection, and returns a context derived from
+// ctx holding the lock, to be used with the ...Context functions until Unlock is called.
+// Locks can be nested, by calling Lock again with the returned context. If ctx is done
+// before the lock is taken, ctx is returned, and the ...Context functions return its error.
+func (i *Connection) Lock(ctx context.Context) context.Context {
+	if i.holds(ctx) {
+		i.owner.Load().depth++
+		return ctx
+	}
+	if i.mutex.LockContext(ctx) != nil {
+		return ctx
+	}
+	t := &lockToken{}
+	i.owner.Store(t)
+	return context.WithValue(ctx, lockKey{i}, t)
+}
+
+// Unlock releases the lock taken by Lock, given the context returned by Lock.
+// An error is returned if ctx does not hold the lock.
+func (i *Connection) Unlock(ctx context.Context) error {
+	if !i.holds(ctx) {
+		return errNotLocked
+	}
+	if t := i.owner.Load(); t.depth > 0 {
+		t.depth--
+		return nil
+	}
+	i.owner.Store(nil)
+	i.mutex.Unlock()
+	return nil
+}
+
+// holds returns true if ctx is returned by Lock, and the lock is not released
+func (i *Connection) holds(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	t, ok := ctx.Value(lockKey{i}).(*lockToken)
+	return ok && t == i.owner.Load()
+}
+
+// acquire locks the connection for one operation, unless ctx holds the lock already.
+// It returns the function releasing the lock, or the ctx error if ctx is done first.
+func (i *Connection) acquire(ctx context.Context) (func(), error) {
+	if i.holds(ctx) {
+		return func() {}, nil
+	}
+	if err := i.mutex.LockContext(ctx); err != nil {
+		return nil, err
+	}
+	return i.mutex.Unlock, nil
+}
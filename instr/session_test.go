@@ -0,0 +1,183 @@
+package instr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// logServer echoes queries, and logs all lines received
+func logServer(t *testing.T) (net.Listener, func() []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	var mutex sync.Mutex
+	var lines []string
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			s = strings.TrimSpace(s)
+			mutex.Lock()
+			lines = append(lines, s)
+			mutex.Unlock()
+			if strings.HasSuffix(s, "?") {
+				// A slow response makes interleaving likely without locking
+				time.Sleep(time.Millisecond)
+				_, _ = c.Write([]byte(s + "\n"))
+			}
+		}
+	}()
+	return l, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), lines...)
+	}
+}
+
+func TestConcurrentAsk(t *testing.T) {
+	l, _ := logServer(t)
+	defer l.Close()
+	c := &Connection{Timeout: time.Second}
+	assert.NoError(t, c.Open(l.Addr().String()))
+	defer c.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				q := fmt.Sprintf("G%dN%d?", g, n)
+				s, err := c.Ask(q)
+				assert.NoError(t, err)
+				assert.Equal(t, q, s)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLock(t *testing.T) {
+	l, log := logServer(t)
+	defer l.Close()
+	c := &Connection{Timeout: time.Second}
+	assert.NoError(t, c.Open(l.Addr().String()))
+	defer c.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 3; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 5; n++ {
+				ctx := c.Lock(context.Background())
+				assert.NoError(t, c.WriteContext(ctx, "SEQ%d:A", g))
+				// A nested lock, like a driver function called in a sequence
+				inner := c.Lock(ctx)
+				assert.NoError(t, c.WriteContext(inner, "SEQ%d:B", g))
+				assert.NoError(t, c.Unlock(inner))
+				s, err := c.AskContext(ctx, "SEQ%d:C?", g)
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("SEQ%d:C?", g), s)
+				assert.NoError(t, c.Unlock(ctx))
+			}
+		}()
+	}
+	// Other goroutines wait for the sequences
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 10; n++ {
+			s, err := c.Ask("OTHER?")
+			assert.NoError(t, err)
+			assert.Equal(t, "OTHER?", s)
+		}
+	}()
+	wg.Wait()
+	lines := log()
+	assert.Len(t, lines, 55)
+	for k := 0; k < len(lines); k++ {
+		if strings.HasSuffix(lines[k], ":A") {
+			seq := strings.TrimSuffix(lines[k], ":A")
+			if assert.Less(t, k+2, len(lines)) {
+				assert.Equal(t, []string{seq + ":B", seq + ":C?"}, lines[k+1:k+3], "sequence interrupted")
+			}
+		}
+	}
+}
+
+func TestLockReleased(t *testing.T) {
+	l, log := logServer(t)
+	defer l.Close()
+	c := &Connection{Timeout: time.Second}
+	assert.NoError(t, c.Open(l.Addr().String()))
+	defer c.Close()
+	stale := c.Lock(context.Background())
+	assert.NoError(t, c.Unlock(stale))
+	assert.False(t, c.holds(stale), "context still holds the lock after Unlock")
+	// Another goroutine takes the lock. The stale context must wait for it.
+	ctx := c.Lock(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, c.WriteContext(stale, "STALE"))
+		inner := c.Lock(stale)
+		assert.NoError(t, c.WriteContext(inner, "STALE:LOCKED"))
+		assert.NoError(t, c.Unlock(inner))
+	}()
+	assert.NoError(t, c.WriteContext(ctx, "OWNER:A"))
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, c.WriteContext(ctx, "OWNER:B"))
+	select {
+	case <-done:
+		t.Fatal("stale context did not wait for the lock")
+	default:
+	}
+	assert.NoError(t, c.Unlock(ctx))
+	<-done
+	_, err := c.Ask("END?")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"OWNER:A", "OWNER:B", "STALE", "STALE:LOCKED", "END?"}, log())
+}
+
+func TestLockCancel(t *testing.T) {
+	l, log := logServer(t)
+	defer l.Close()
+	c := &Connection{Timeout: time.Second}
+	assert.NoError(t, c.Open(l.Addr().String()))
+	defer c.Close()
+	owner := c.Lock(context.Background())
+	// Waiting for the lock held by another goroutine is stopped by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.AskContext(ctx, "WAITING?")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	locked := c.Lock(ctx)
+	assert.False(t, c.holds(locked))
+	assert.ErrorIs(t, c.WriteContext(locked, "WAITING"), context.DeadlineExceeded)
+	// Unlock with a context not holding the lock does not release it
+	assert.Error(t, c.Unlock(locked))
+	assert.Error(t, c.Unlock(context.Background()))
+	assert.True(t, c.holds(owner))
+	assert.NoError(t, c.WriteContext(owner, "OWNER"))
+	assert.NoError(t, c.Unlock(owner))
+	assert.Error(t, c.Unlock(owner), "unlocked twice")
+	_, err = c.Ask("END?")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"OWNER", "END?"}, log())
+}
@@ -0,0 +1,179 @@
+package instr
+
+// Units and SI prefixes. Values are formatted with an engineering prefix from
+// p to G and a given number of significant digits, like "4.70kΩ" or "-12.5mA",
+// and strings like these are parsed back, f.ex. from configuration files.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var engUnitNames = [...]string{"Illegal", "VoltDc", "VoltAcRms", "VoltAcAvg", "CurrentDc", "CurrentAcRms",
+	"CurrentAcAvg", "Hz", "Ohm", "Celcius", "Second", "Farad", "Watt", "DBm", "Diode", "Continuity", "OhmFourWire"}
+
+var engUnitSymbols = [...]string{"", "V", "V", "V", "A", "A", "A", "Hz", "Ω", "°C", "s", "F", "W", "dBm", "V", "Ω", "Ω"}
+
+func (u EngUnit) String() string {
+	if u < 0 || int(u) >= len(engUnitNames) {
+		return fmt.Sprintf("EngUnit(%d)", int(u))
+	}
+	return engUnitNames[u]
+}
+
+// Symbol returns the symbol of the unit, like V or Ω. Ac and dc units have the same symbol.
+func (u EngUnit) Symbol() string {
+	if u < 0 || int(u) >= len(engUnitSymbols) {
+		return ""
+	}
+	return engUnitSymbols[u]
+}
+
+var sensorNames = [...]string{"default sensor", "Pt100", "4-wire Pt100", "type J thermocouple",
+	"type K thermocouple", "type T thermocouple", "type E thermocouple"}
+
+func (s Sensor) String() string {
+	if s < 0 || int(s) >= len(sensorNames) {
+		return fmt.Sprintf("Sensor(%d)", int(s))
+	}
+	return sensorNames[s]
+}
+
+// Thermocouple returns the thermocouple type, like "K", or "" if s is not a thermocouple
+func (s Sensor) Thermocouple() string {
+	switch s {
+	case ThermocoupleJ:
+		return "J"
+	case ThermocoupleK:
+		return "K"
+	case ThermocoupleT:
+		return "T"
+	case ThermocoupleE:
+		return "E"
+	}
+	return ""
+}
+
+// siPrefixes are the prefixes from 1e-12 to 1e9, in steps of 1000
+const siPrefixes = "pnum kMG"
+
+// prefixScale returns the scale of an SI prefix, or 0 if r is not a prefix.
+// Both u and the micro signs µ and μ are accepted.
+func prefixScale(r rune) float64 {
+	if r == 'µ' || r == 'μ' {
+		r = 'u'
+	}
+	k := strings.IndexRune(siPrefixes, r)
+	if k < 0 || r == ' ' {
+		return 0
+	}
+	return math.Pow(1000, float64(k-4))
+}
+
+// knownSymbols are units starting with a character that is also a prefix
+var knownSymbols = map[string]bool{"min": true, "mn": true, "mil": true}
+
+// SplitPrefix splits a unit like "mA" or "kHz" into the scale given by the prefix and the
+// symbol. Units without prefix, like "dBm" or "V", are returned with scale 1, and a prefix
+// alone, like the m in "5m", gives an empty symbol.
+func SplitPrefix(unit string) (float64, string) {
+	if unit == "" || knownSymbols[unit] {
+		return 1, unit
+	}
+	r, n := utf8.DecodeRuneInString(unit)
+	scale := prefixScale(r)
+	if scale == 0 {
+		return 1, unit
+	}
+	return scale, unit[n:]
+}
+
+// ParseSI parses a value with an optional prefix and unit, like "4.7kΩ", "12.5 mA", "-3.3V" or "1e-3".
+// It returns the value scaled by the prefix, and the unit symbol.
+func ParseSI(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for k, r := range s {
+		if unicode.IsDigit(r) || r == '.' || r == '+' || r == '-' {
+			end = k + 1
+		} else if (r == 'e' || r == 'E') && k+1 < len(s) && strings.ContainsAny(s[k+1:k+2], "0123456789+-") {
+			// An exponent, and not a unit like "Ohm"
+			end = k + 1
+		} else {
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid value %q", s)
+	}
+	scale, unit := SplitPrefix(strings.TrimSpace(s[end:]))
+	return v * scale, unit, nil
+}
+
+// FormatSI formats v with an engineering prefix from p to G and the given number of
+// significant digits, like "4.70kΩ" or "-12.5mA". Zero, infinite and NaN values have
+// no prefix, and digits less than 1 gives 3 significant digits.
+func FormatSI(v float64, unit string, digits int) string {
+	if digits < 1 {
+		digits = 3
+	}
+	if v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.FormatFloat(v, 'f', digits-1, 64) + unit
+	}
+	e := int(math.Floor(math.Log10(math.Abs(v))))
+	eng := engExponent(e)
+	scaled := v / math.Pow10(eng)
+	dp := max(digits-1-(e-eng), 0)
+	s := strconv.FormatFloat(scaled, 'f', dp, 64)
+	if r, _ := strconv.ParseFloat(s, 64); math.Abs(r) >= 1000 && eng < 9 {
+		// Rounded up to the next prefix, like 999.96 to 1.00k
+		eng += 3
+		dp = max(digits-1, 0)
+		s = strconv.FormatFloat(v/math.Pow10(eng), 'f', dp, 64)
+	}
+	prefix := ""
+	if eng != 0 {
+		prefix = string(siPrefixes[eng/3+4])
+	}
+	return s + prefix + unit
+}
+
+// engExponent returns the exponent of the prefix used for a value with exponent e
+func engExponent(e int) int {
+	eng := e - ((e%3)+3)%3
+	return min(max(eng, -12), 9)
+}
+
+// VoltToStr will return a voltage with 3 significant digits and a prefix, like 4.70mV
+func VoltToStr(v float64) string {
+	return FormatSI(v, "V", 3)
+}
+
+// TimeToStr will return a time with 3 significant digits, using s with a prefix
+// below a minute, and minutes or hours above
+func TimeToStr(t float64) string {
+	switch {
+	case math.Abs(t) >= 3600:
+		return strconv.FormatFloat(t/3600, 'f', decimals(t/3600), 64) + "h"
+	case math.Abs(t) >= 60:
+		return strconv.FormatFloat(t/60, 'f', decimals(t/60), 64) + "min"
+	}
+	return FormatSI(t, "s", 3)
+}
+
+// decimals returns the number of decimals giving 3 significant digits for values above 1
+func decimals(v float64) int {
+	v = math.Abs(v)
+	switch {
+	case v >= 99.95:
+		return 0
+	case v >= 9.995:
+		return 1
+	}
+	return 2
+}
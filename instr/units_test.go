@@ -0,0 +1,121 @@
+package instr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSI(t *testing.T) {
+	tests := []struct {
+		v      float64
+		unit   string
+		digits int
+		s      string
+	}{
+		{4700, "Ω", 2, "4.7kΩ"},
+		{4700, "Ω", 3, "4.70kΩ"},
+		{0.0125, "A", 3, "12.5mA"},
+		{-0.0125, "A", 3, "-12.5mA"},
+		{1.5, "V", 4, "1.500V"},
+		{123456, "Hz", 3, "123kHz"},
+		{999.96, "V", 3, "1.00kV"},
+		{-999.96e-6, "V", 3, "-1.00mV"},
+		{2.2e-12, "F", 2, "2.2pF"},
+		{1e-15, "F", 3, "0.00100pF"},
+		{3.3e9, "Hz", 2, "3.3GHz"},
+		{4.5e12, "Hz", 2, "4500GHz"},
+		{0, "V", 3, "0.00V"},
+		{1, "", 0, "1.00"},
+		{math.Inf(-1), "V", 3, "-InfV"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.s, FormatSI(test.v, test.unit, test.digits), "%g", test.v)
+	}
+}
+
+func TestParseSI(t *testing.T) {
+	tests := []struct {
+		s    string
+		v    float64
+		unit string
+	}{
+		{"4.7kΩ", 4700, "Ω"},
+		{"12.5mA", 0.0125, "A"},
+		{" -3.3 V ", -3.3, "V"},
+		{"1e-3", 0.001, ""},
+		{"2.5E+3Hz", 2500, "Hz"},
+		{"100nF", 100e-9, "F"},
+		{"10µs", 10e-6, "s"},
+		{"10μs", 10e-6, "s"},
+		{"10us", 10e-6, "s"},
+		{"1.2MOhm", 1.2e6, "Ohm"},
+		{"5m", 0.005, ""},
+		{"-10dBm", -10, "dBm"},
+		{"2min", 2, "min"},
+		{"3", 3, ""},
+	}
+	for _, test := range tests {
+		v, unit, err := ParseSI(test.s)
+		assert.NoError(t, err, test.s)
+		assert.InDelta(t, test.v, v, math.Abs(test.v)*1e-12, test.s)
+		assert.Equal(t, test.unit, unit, test.s)
+	}
+	for _, s := range []string{"", "V", "k5", "1.2.3V"} {
+		_, _, err := ParseSI(s)
+		assert.Error(t, err, s)
+	}
+	v, unit, err := ParseSI(FormatSI(-0.0047, "V", 3))
+	assert.NoError(t, err)
+	assert.InDelta(t, -0.0047, v, 1e-15)
+	assert.Equal(t, "V", unit)
+}
+
+func TestSplitPrefix(t *testing.T) {
+	scale, symbol := SplitPrefix("mVdc")
+	assert.Equal(t, 1e-3, scale)
+	assert.Equal(t, "Vdc", symbol)
+	scale, symbol = SplitPrefix("kHz")
+	assert.Equal(t, 1e3, scale)
+	assert.Equal(t, "Hz", symbol)
+	scale, symbol = SplitPrefix("dBm")
+	assert.Equal(t, 1.0, scale)
+	assert.Equal(t, "dBm", symbol)
+	scale, symbol = SplitPrefix("°C")
+	assert.Equal(t, 1.0, scale)
+	assert.Equal(t, "°C", symbol)
+}
+
+func TestToStr(t *testing.T) {
+	assert.Equal(t, "4.70mV", VoltToStr(0.0047))
+	assert.Equal(t, "-4.70mV", VoltToStr(-0.0047))
+	assert.Equal(t, "500mV", VoltToStr(0.5))
+	assert.Equal(t, "1.50kV", VoltToStr(1500))
+	assert.Equal(t, "10.0ns", TimeToStr(10e-9))
+	assert.Equal(t, "-2.50ms", TimeToStr(-2.5e-3))
+	assert.Equal(t, "30.0s", TimeToStr(30))
+	assert.Equal(t, "1.50min", TimeToStr(90))
+	assert.Equal(t, "-2.00min", TimeToStr(-120))
+	assert.Equal(t, "2.00h", TimeToStr(7200))
+	assert.Equal(t, "48.0h", TimeToStr(48*3600))
+}
+
+func TestEngUnit(t *testing.T) {
+	assert.Equal(t, "Ω", Ohm.Symbol())
+	assert.Equal(t, "V", VoltAcRms.Symbol())
+	assert.Equal(t, "dBm", DBm.Symbol())
+	assert.Equal(t, "Continuity", Continuity.String())
+	assert.Equal(t, "", EngUnit(99).Symbol())
+	assert.Len(t, engUnitSymbols, len(engUnitNames))
+	assert.Equal(t, "OhmFourWire", OhmFourWire.String())
+	assert.Equal(t, "Ω", OhmFourWire.Symbol())
+}
+
+func TestSensor(t *testing.T) {
+	assert.Equal(t, "4-wire Pt100", Pt100FourWire.String())
+	assert.Equal(t, "Sensor(99)", Sensor(99).String())
+	assert.Equal(t, "K", ThermocoupleK.Thermocouple())
+	assert.Equal(t, "", Pt100.Thermocouple())
+	assert.Len(t, sensorNames, int(ThermocoupleE)+1)
+}
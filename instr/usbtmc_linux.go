@@ -0,0 +1,235 @@
+package instr
+
+// USBTMC transport using the Linux kernel usbtmc driver, which
+// creates a character device /dev/usbtmcN for each instrument.
+// Each write is sent as one message with EOM set, and each read
+// returns the data from one or more bulk-in transfers.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioctl request codes from linux/usb/tmc.h
+const (
+	usbtmcIoctlClear      = 0x00005B02 // _IO(91, 2)
+	usbtmcIoctlSetTimeout = 0x40045B0A // _IOW(91, 10, __u32)
+	usbtmc488IoctlReadStb = 0x80015B12 // _IOR(91, 18, __u8)
+	usbtmcBufferSize      = 1 << 16
+)
+
+// Location of usbtmc class devices. A variable to make testing possible.
+var sysClassUsbmisc = "/sys/class/usbmisc"
+
+// usbtmc is a io.ReadWriteCloser for a /dev/usbtmcN device
+type usbtmc struct {
+	fd      int
+	timeout time.Duration
+	current time.Duration // Timeout last given to the driver
+	pending []byte
+	end     bool // The last read was shorter than the buffer, so the message is complete
+}
+
+func ioctl(fd int, req uintptr, arg uintptr) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// dialUsbtmc opens a usbtmc device given by its path, or by a VISA resource
+// string like USB0::0x1AB1::0x04CE::DS1ZA123::INSTR
+func dialUsbtmc(address string, timeout time.Duration) (*usbtmc, error) {
+	path := address
+	if !strings.HasPrefix(address, "/dev/") {
+		var err error
+		path, err = findUsbtmc(address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The file is used without the go runtime poller, since the driver
+	// does not support non-blocking reads
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s, %s", path, err)
+	}
+	u := &usbtmc{fd: fd, timeout: timeout}
+	u.setTimeout(timeout)
+	return u, nil
+}
+
+// setTimeout gives the driver a new timeout if it has changed. Old kernels
+// does not support this, and will keep the default of 5 seconds.
+func (u *usbtmc) setTimeout(t time.Duration) {
+	if t == u.current || t <= 0 {
+		return
+	}
+	ms := uint32(t.Milliseconds())
+	if ms < 100 {
+		// The driver does not accept less than 100mS
+		ms = 100
+	}
+	if ioctl(u.fd, usbtmcIoctlSetTimeout, uintptr(unsafe.Pointer(&ms))) == nil {
+		u.current = t
+	}
+}
+
+// Write sends b as one message
+func (u *usbtmc) Write(b []byte) (int, error) {
+	n, err := unix.Write(u.fd, b)
+	if errors.Is(err, unix.ETIMEDOUT) {
+		return 0, fmt.Errorf("%w in usbtmc write", ErrTimeout)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// Read returns data from the device. The driver is given a large buffer, since
+// old kernels discards data that does not fit in the buffer.
+func (u *usbtmc) Read(b []byte) (int, error) {
+	if len(u.pending) == 0 {
+		buf := make([]byte, usbtmcBufferSize)
+		n, err := unix.Read(u.fd, buf)
+		if errors.Is(err, unix.ETIMEDOUT) {
+			return 0, fmt.Errorf("%w in usbtmc read", ErrTimeout)
+		}
+		if err != nil {
+			return 0, err
+		}
+		u.pending = buf[:n]
+		u.end = n < usbtmcBufferSize
+	}
+	n := copy(b, u.pending)
+	u.pending = u.pending[n:]
+	return n, nil
+}
+
+// EndOfMessage returns true when the whole message is read
+func (u *usbtmc) EndOfMessage() bool {
+	return u.end && len(u.pending) == 0
+}
+
+// Flush discards buffered response data
+func (u *usbtmc) Flush() error {
+	u.pending = nil
+	return nil
+}
+
+// Clear sends the USBTMC INITIATE_CLEAR request
+func (u *usbtmc) Clear() error {
+	u.pending = nil
+	return ioctl(u.fd, usbtmcIoctlClear, 0)
+}
+
+// StatusByte reads the status byte with the USB488 READ_STATUS_BYTE request
+func (u *usbtmc) StatusByte() (byte, error) {
+	var stb byte
+	err := ioctl(u.fd, usbtmc488IoctlReadStb, uintptr(unsafe.Pointer(&stb)))
+	return stb, err
+}
+
+// Close will close the device
+func (u *usbtmc) Close() error {
+	return unix.Close(u.fd)
+}
+
+// SetReadDeadline sets the driver timeout to the time remaining until t
+func (u *usbtmc) SetReadDeadline(t time.Time) error {
+	u.setTimeout(time.Until(t))
+	return nil
+}
+
+// SetWriteDeadline sets the driver timeout to the time remaining until t
+func (u *usbtmc) SetWriteDeadline(t time.Time) error {
+	u.setTimeout(time.Until(t))
+	return nil
+}
+
+// usbtmcDevices returns the paths of all usbtmc devices with their usb identity
+func usbtmcDevices() ([]PortInfo, error) {
+	files, err := os.ReadDir(sysClassUsbmisc)
+	if err != nil {
+		return nil, err
+	}
+	var list []PortInfo
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), "usbtmc") {
+			continue
+		}
+		p := PortInfo{Name: filepath.Join(devFolder, f.Name())}
+		devDir, err := filepath.EvalSymlinks(filepath.Join(sysClassUsbmisc, f.Name(), "device"))
+		if err == nil {
+			if usbDir := findUsbDevice(devDir); usbDir != "" {
+				p.Vid = parseHex16(readSysFile(usbDir, "idVendor"))
+				p.Pid = parseHex16(readSysFile(usbDir, "idProduct"))
+				p.SerialNumber = readSysFile(usbDir, "serial")
+				p.Description = strings.TrimSpace(readSysFile(usbDir, "manufacturer") + " " + readSysFile(usbDir, "product"))
+			}
+		}
+		list = append(list, p)
+	}
+	sortPorts(list)
+	return list, nil
+}
+
+// findUsbtmc returns the device path for a VISA resource string like USB0::0x1AB1::0x04CE::DS1ZA123::INSTR
+func findUsbtmc(resource string) (string, error) {
+	parts := strings.Split(resource, "::")
+	if len(parts) < 3 {
+		return "", fmt.Errorf("invalid usb resource %s", resource)
+	}
+	vid, err1 := strconv.ParseUint(parts[1], 0, 16)
+	pid, err2 := strconv.ParseUint(parts[2], 0, 16)
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("invalid vendor or product id in %s", resource)
+	}
+	sno := ""
+	if len(parts) > 3 && !strings.EqualFold(parts[3], "INSTR") {
+		sno = parts[3]
+	}
+	list, err := usbtmcDevices()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range list {
+		if p.Vid == uint16(vid) && p.Pid == uint16(pid) && (sno == "" || p.SerialNumber == sno) {
+			return p.Name, nil
+		}
+	}
+	return "", fmt.Errorf("usb device %s not found", resource)
+}
+
+// EnumerateUsbtmc will return all usbtmc devices with the *IDN? response as description.
+// Devices that are busy or does not respond keep the usb product name.
+func EnumerateUsbtmc() ([]PortInfo, error) {
+	list, err := usbtmcDevices()
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The usbtmc driver is not loaded
+			return nil, nil
+		}
+		return nil, err
+	}
+	for n := range list {
+		c := &Connection{Timeout: time.Second / 2}
+		if c.Open(list[n].Name) == nil {
+			if idn, err := c.Ask("*IDN?"); err == nil && idn != "" {
+				list[n].Description = idn
+			}
+			c.Close()
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,39 @@
+package instr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindUsbtmc(t *testing.T) {
+	defer func(a, b string) { sysClassUsbmisc, sysDevicesRoot = a, b }(sysClassUsbmisc, sysDevicesRoot)
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	usbDir := filepath.Join(root, "sys/devices/pci0/usb1/1-3")
+	assert.NoError(t, os.MkdirAll(filepath.Join(usbDir, "1-3:1.0"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(usbDir, "idVendor"), []byte("1ab1\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(usbDir, "idProduct"), []byte("04ce\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(usbDir, "serial"), []byte("DS1ZA123\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "sys/class/usbmisc/usbtmc1"), 0755))
+	assert.NoError(t, os.Symlink(filepath.Join(usbDir, "1-3:1.0"), filepath.Join(root, "sys/class/usbmisc/usbtmc1/device")))
+	sysClassUsbmisc = filepath.Join(root, "sys/class/usbmisc")
+	sysDevicesRoot = filepath.Join(root, "sys/devices")
+
+	path, err := findUsbtmc("USB0::0x1AB1::0x04CE::DS1ZA123::INSTR")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/usbtmc1", path)
+	path, err = findUsbtmc("USB::0x1AB1::0x04CE::INSTR")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/usbtmc1", path)
+	_, err = findUsbtmc("USB0::0x1AB1::0x04CE::OTHER::INSTR")
+	assert.Error(t, err)
+
+	r, err := ParseResource("USB0::0x1AB1::0x04CE::DS1ZA123::INSTR")
+	assert.NoError(t, err)
+	assert.Equal(t, USBTMC, r.Transport)
+	r, err = ParseResource("/dev/usbtmc0")
+	assert.NoError(t, err)
+	assert.Equal(t, USBTMC, r.Transport)
+}
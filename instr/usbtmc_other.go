@@ -0,0 +1,19 @@
+//go:build !linux
+
+package instr
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// dialUsbtmc is only implemented on linux
+func dialUsbtmc(address string, timeout time.Duration) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("usbtmc is not supported on this platform")
+}
+
+// EnumerateUsbtmc will return an empty list, since usbtmc is only supported on linux
+func EnumerateUsbtmc() ([]PortInfo, error) {
+	return nil, nil
+}
@@ -0,0 +1,435 @@
+package instr
+
+// VXI-11 client for LXI instruments without a raw socket interface.
+// The core channel is ONC RPC (RFC 5531) over tcp with XDR encoding (RFC 4506).
+// The port number of the core channel is found by asking the portmapper.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// ONC RPC program, version and procedure numbers
+const (
+	portmapProg    = 100000
+	portmapVers    = 2
+	portmapGetPort = 3
+	portmapPort    = 111
+	vxiCoreProg    = 0x0607AF
+	vxiCoreVers    = 1
+	vxiCreateLink  = 10
+	vxiDeviceWrite = 11
+	vxiDeviceRead  = 12
+	vxiDeviceClear = 15
+	vxiDestroyLink = 23
+)
+
+// Flags and reasons used by device_write and device_read
+const (
+	vxiFlagEnd   = 0x08
+	vxiReasonEnd = 0x04
+	vxiChunkSize = 1 << 20
+	rpcLastFrag  = 0x80000000
+	// rpcMaxRecord is the largest rpc message accepted, room for a read chunk and the reply header
+	rpcMaxRecord = vxiChunkSize + 1024
+)
+
+// errRecordCut is returned with the error stopping a record that is partly transferred
+var errRecordCut = errors.New("rpc record cut")
+
+// errRpcLost is returned after a record is cut, since the following data can not be parsed
+var errRpcLost = fmt.Errorf("%w, rpc stream out of sync", ErrClosed)
+
+// vxiErrors are the error texts for the Device_ErrorCode values
+var vxiErrors = map[uint32]string{
+	1:  "syntax error",
+	3:  "device not accessible",
+	4:  "invalid link identifier",
+	5:  "parameter error",
+	6:  "channel not established",
+	8:  "operation not supported",
+	9:  "out of resources",
+	11: "device locked by another link",
+	12: "no lock held by this link",
+	15: "I/O timeout",
+	17: "I/O error",
+	21: "invalid address",
+	23: "abort",
+	29: "channel already established",
+}
+
+func vxiError(op string, code uint32) error {
+	if code == 0 {
+		return nil
+	}
+	if code == 15 {
+		return fmt.Errorf("%w in vxi11 %s", ErrTimeout, op)
+	}
+	s, ok := vxiErrors[code]
+	if !ok {
+		s = fmt.Sprintf("error %d", code)
+	}
+	return fmt.Errorf("vxi11 %s failed, %s", op, s)
+}
+
+// xdrWriter builds XDR encoded data
+type xdrWriter struct {
+	buf []byte
+}
+
+func (w *xdrWriter) uint(v uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint(uint32(len(b)))
+	w.buf = append(w.buf, b...)
+	for len(w.buf)%4 != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// xdrReader decodes XDR data. The first error is kept and later reads return zero.
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+func (r *xdrReader) uint() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 4 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *xdrReader) opaque() []byte {
+	n := int(r.uint())
+	if r.err != nil {
+		return nil
+	}
+	padded := (n + 3) &^ 3
+	if n < 0 || len(r.buf) < padded {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[padded:]
+	return b
+}
+
+// writeRecord sends one message using the rpc record marking
+func writeRecord(w io.Writer, msg []byte) error {
+	b := binary.BigEndian.AppendUint32(nil, rpcLastFrag|uint32(len(msg)))
+	n, err := w.Write(append(b, msg...))
+	if err != nil && n > 0 {
+		return fmt.Errorf("%w, %w", errRecordCut, err)
+	}
+	return err
+}
+
+// readRecord reads fragments until the last fragment of a message
+func readRecord(r io.Reader) ([]byte, error) {
+	var msg []byte
+	for {
+		var hdr [4]byte
+		if k, err := io.ReadFull(r, hdr[:]); err != nil {
+			if k > 0 || len(msg) > 0 {
+				return nil, fmt.Errorf("%w, %w", errRecordCut, err)
+			}
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(hdr[:])
+		n := h &^ rpcLastFrag
+		if uint64(len(msg))+uint64(n) > rpcMaxRecord {
+			return nil, fmt.Errorf("%w, rpc message too long, %d bytes", errRecordCut, uint64(len(msg))+uint64(n))
+		}
+		frag := make([]byte, n)
+		if _, err := io.ReadFull(r, frag); err != nil {
+			return nil, fmt.Errorf("%w, %w", errRecordCut, err)
+		}
+		msg = append(msg, frag...)
+		if h&rpcLastFrag != 0 {
+			return msg, nil
+		}
+	}
+}
+
+// rpcClient does ONC RPC calls over a tcp connection
+type rpcClient struct {
+	conn net.Conn
+	xid  uint32
+	lost bool // A record is cut, and the connection closed
+}
+
+// cut closes the connection if err stopped a record in the middle
+func (c *rpcClient) cut(err error) error {
+	if errors.Is(err, errRecordCut) {
+		c.lost = true
+		_ = c.conn.Close()
+	}
+	return err
+}
+
+// call sends a request and returns a reader positioned at the results
+func (c *rpcClient) call(prog, vers, proc uint32, args []byte, deadline time.Time) (*xdrReader, error) {
+	if c.lost {
+		return nil, errRpcLost
+	}
+	c.xid++
+	w := &xdrWriter{}
+	// xid, CALL, rpc version 2, program, version, procedure, AUTH_NONE credentials and verifier
+	for _, v := range []uint32{c.xid, 0, 2, prog, vers, proc, 0, 0, 0, 0} {
+		w.uint(v)
+	}
+	w.buf = append(w.buf, args...)
+	_ = c.conn.SetDeadline(deadline)
+	if err := writeRecord(c.conn, w.buf); err != nil {
+		return nil, c.cut(err)
+	}
+	for {
+		msg, err := readRecord(c.conn)
+		if err != nil {
+			return nil, c.cut(err)
+		}
+		r := &xdrReader{buf: msg}
+		xid, msgType, replyStat := r.uint(), r.uint(), r.uint()
+		if xid != c.xid {
+			// Late reply to an earlier call that timed out
+			continue
+		}
+		if msgType != 1 || replyStat != 0 {
+			return nil, fmt.Errorf("rpc call denied")
+		}
+		_ = r.uint()   // Verifier flavor
+		_ = r.opaque() // Verifier body
+		if stat := r.uint(); stat != 0 || r.err != nil {
+			return nil, fmt.Errorf("rpc call failed with status %d", stat)
+		}
+		return r, nil
+	}
+}
+
+// vxi11 is a io.ReadWriteCloser for a VXI-11 device link
+type vxi11 struct {
+	rpc           rpcClient
+	lid           uint32
+	maxRecv       uint32
+	timeout       time.Duration
+	readDeadline  time.Time
+	writeDeadline time.Time
+	pending       []byte
+	end           bool // The last device_read ended with END
+}
+
+// dialVxi11 will find the core channel port using the portmapper at address,
+// and create a link to the given device, typically "inst0" or "gpib0,22"
+func dialVxi11(address string, device string, timeout time.Duration) (*vxi11, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, fmt.Sprint(portmapPort)
+	}
+	deadline := time.Now().Add(timeout)
+	pm, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+	if err != nil {
+		return nil, err
+	}
+	pmClient := rpcClient{conn: pm}
+	w := &xdrWriter{}
+	for _, v := range []uint32{vxiCoreProg, vxiCoreVers, 6 /*tcp*/, 0} {
+		w.uint(v)
+	}
+	r, err := pmClient.call(portmapProg, portmapVers, portmapGetPort, w.buf, deadline)
+	_ = pm.Close()
+	if err != nil {
+		return nil, fmt.Errorf("portmapper failed, %s", err)
+	}
+	corePort := r.uint()
+	if r.err != nil || corePort == 0 {
+		return nil, fmt.Errorf("vxi11 core channel not registered")
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, fmt.Sprint(corePort)), timeout)
+	if err != nil {
+		return nil, err
+	}
+	v := &vxi11{rpc: rpcClient{conn: conn}, timeout: timeout}
+	w = &xdrWriter{}
+	w.uint(uint32(os.Getpid())) // Client id
+	w.uint(0)                   // Lock device
+	w.uint(0)                   // Lock timeout
+	w.opaque([]byte(device))
+	r, err = v.rpc.call(vxiCoreProg, vxiCoreVers, vxiCreateLink, w.buf, deadline)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	code, lid := r.uint(), r.uint()
+	_ = r.uint() // Abort port
+	v.maxRecv = r.uint()
+	if r.err == nil {
+		r.err = vxiError("create_link", code)
+	}
+	if r.err != nil {
+		_ = conn.Close()
+		return nil, r.err
+	}
+	v.lid = lid
+	if v.maxRecv == 0 {
+		v.maxRecv = 1024
+	}
+	return v, nil
+}
+
+// deadline returns the deadline to use and the io timeout in milliseconds.
+// The timeout is used if t is zero, and a deadline that has passed gives ErrTimeout.
+func (v *vxi11) deadline(t time.Time) (time.Time, uint32, error) {
+	if t.IsZero() {
+		t = time.Now().Add(v.timeout)
+	}
+	if !time.Now().Before(t) {
+		return t, 0, fmt.Errorf("%w, deadline passed", ErrTimeout)
+	}
+	ms := time.Until(t).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	// Allow the instrument some time to report its own timeout
+	return t.Add(time.Second), uint32(ms), nil
+}
+
+// Write sends data with device_write, split into chunks the device accepts
+func (v *vxi11) Write(b []byte) (int, error) {
+	deadline, ioTimeout, err := v.deadline(v.writeDeadline)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		chunk := b[n:]
+		flags := uint32(vxiFlagEnd)
+		if uint32(len(chunk)) > v.maxRecv {
+			chunk = chunk[:v.maxRecv]
+			flags = 0
+		}
+		w := &xdrWriter{}
+		for _, x := range []uint32{v.lid, ioTimeout, 0, flags} {
+			w.uint(x)
+		}
+		w.opaque(chunk)
+		r, err := v.rpc.call(vxiCoreProg, vxiCoreVers, vxiDeviceWrite, w.buf, deadline)
+		if err != nil {
+			return n, err
+		}
+		code, size := r.uint(), r.uint()
+		if r.err != nil {
+			return n, r.err
+		}
+		n += int(size)
+		if err = vxiError("device_write", code); err != nil {
+			return n, err
+		}
+		if size == 0 && len(chunk) > 0 {
+			return n, fmt.Errorf("device_write accepted no data")
+		}
+		if n >= len(b) {
+			return n, nil
+		}
+	}
+}
+
+// Read returns data from one device_read call, buffering what does not fit in b
+func (v *vxi11) Read(b []byte) (int, error) {
+	if len(v.pending) == 0 {
+		deadline, ioTimeout, err := v.deadline(v.readDeadline)
+		if err != nil {
+			return 0, err
+		}
+		w := &xdrWriter{}
+		for _, x := range []uint32{v.lid, vxiChunkSize, ioTimeout, 0, 0, 0} {
+			w.uint(x)
+		}
+		r, err := v.rpc.call(vxiCoreProg, vxiCoreVers, vxiDeviceRead, w.buf, deadline)
+		if err != nil {
+			return 0, err
+		}
+		code := r.uint()
+		reason := r.uint()
+		data := r.opaque()
+		if r.err != nil {
+			return 0, r.err
+		}
+		if err = vxiError("device_read", code); err != nil {
+			return 0, err
+		}
+		v.pending = data
+		v.end = reason&vxiReasonEnd != 0
+	}
+	n := copy(b, v.pending)
+	v.pending = v.pending[n:]
+	return n, nil
+}
+
+// generic sends a procedure with Device_GenericParms or Device_Link and checks the error code
+func (v *vxi11) generic(proc uint32, op string, params ...uint32) error {
+	deadline, _, _ := v.deadline(time.Time{})
+	w := &xdrWriter{}
+	for _, x := range params {
+		w.uint(x)
+	}
+	r, err := v.rpc.call(vxiCoreProg, vxiCoreVers, proc, w.buf, deadline)
+	if err != nil {
+		return err
+	}
+	code := r.uint()
+	if r.err != nil {
+		return r.err
+	}
+	return vxiError(op, code)
+}
+
+// Clear sends device_clear, which empties the instruments input and output buffers
+func (v *vxi11) Clear() error {
+	v.pending = nil
+	_, ioTimeout, _ := v.deadline(time.Time{})
+	return v.generic(vxiDeviceClear, "device_clear", v.lid, 0, 0, ioTimeout)
+}
+
+// EndOfMessage returns true when all data up to END is read
+func (v *vxi11) EndOfMessage() bool {
+	return v.end && len(v.pending) == 0
+}
+
+// Flush discards buffered response data
+func (v *vxi11) Flush() error {
+	v.pending = nil
+	return nil
+}
+
+// Close will destroy the link and close the connection
+func (v *vxi11) Close() error {
+	err := v.generic(vxiDestroyLink, "destroy_link", v.lid)
+	_ = v.rpc.conn.Close()
+	return err
+}
+
+// SetReadDeadline sets the time limit for the following Read calls
+func (v *vxi11) SetReadDeadline(t time.Time) error {
+	v.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the time limit for the following Write calls
+func (v *vxi11) SetWriteDeadline(t time.Time) error {
+	v.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,232 @@
+package instr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVxi11 is a VXI-11 server with the portmapper and core channel on the same port.
+// It answers *IDN? and echoes any other query
+type fakeVxi11 struct {
+	l       net.Listener
+	maxRecv uint32
+	clears  int32
+	stalled atomic.Bool // device_write accepts no data
+	cut     atomic.Bool // device_read replies stop in the middle of the record
+}
+
+func newFakeVxi11(t *testing.T) *fakeVxi11 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	f := &fakeVxi11{l: l, maxRecv: 16}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeVxi11) serve(c net.Conn) {
+	defer c.Close()
+	var input, output []byte
+	for {
+		msg, err := readRecord(c)
+		if err != nil {
+			return
+		}
+		r := &xdrReader{buf: msg}
+		xid := r.uint()
+		_, _ = r.uint(), r.uint() // Call, rpc version
+		prog, _, proc := r.uint(), r.uint(), r.uint()
+		_, _, _, _ = r.uint(), r.opaque(), r.uint(), r.opaque() // Credentials and verifier
+		w := &xdrWriter{}
+		for _, v := range []uint32{xid, 1, 0, 0, 0, 0} {
+			w.uint(v)
+		}
+		switch {
+		case prog == portmapProg && proc == portmapGetPort:
+			w.uint(uint32(f.l.Addr().(*net.TCPAddr).Port))
+		case prog == vxiCoreProg && proc == vxiCreateLink:
+			_, _, _ = r.uint(), r.uint(), r.uint()
+			if string(r.opaque()) != "inst0" {
+				w.uint(3)
+			} else {
+				w.uint(0)
+			}
+			w.uint(7)
+			w.uint(0)
+			w.uint(f.maxRecv)
+		case prog == vxiCoreProg && proc == vxiDeviceWrite:
+			_, _, _ = r.uint(), r.uint(), r.uint()
+			flags := r.uint()
+			data := r.opaque()
+			input = append(input, data...)
+			if flags&vxiFlagEnd != 0 {
+				cmd := strings.TrimSpace(string(input))
+				input = nil
+				if cmd == "*IDN?" {
+					output = []byte("FAKE,VXI11,0,1.0\n")
+				} else if strings.Contains(cmd, "?") {
+					output = []byte(cmd + "\n")
+				}
+			}
+			w.uint(0)
+			if f.stalled.Load() {
+				w.uint(0)
+				break
+			}
+			w.uint(uint32(len(data)))
+		case prog == vxiCoreProg && proc == vxiDeviceRead:
+			_ = r.uint()
+			size := r.uint()
+			if len(output) == 0 {
+				w.uint(15)
+				w.uint(0)
+				w.opaque(nil)
+				break
+			}
+			n := len(output)
+			if uint32(n) > size {
+				n = int(size)
+			}
+			w.uint(0)
+			if n == len(output) {
+				w.uint(vxiReasonEnd)
+			} else {
+				w.uint(1)
+			}
+			w.opaque(output[:n])
+			output = output[n:]
+		case prog == vxiCoreProg && proc == vxiDeviceClear:
+			atomic.AddInt32(&f.clears, 1)
+			input, output = nil, nil
+			w.uint(0)
+		case prog == vxiCoreProg && proc == vxiDestroyLink:
+			w.uint(0)
+		default:
+			w.buf = w.buf[:12]
+			w.uint(3) // PROC_UNAVAIL
+		}
+		if f.cut.Load() && prog == vxiCoreProg && proc == vxiDeviceRead {
+			// A part of the reply, like a link stopping in the middle of a record
+			b := binary.BigEndian.AppendUint32(nil, rpcLastFrag|uint32(len(w.buf)))
+			_, _ = c.Write(append(b, w.buf[:len(w.buf)/2]...))
+			continue
+		}
+		if writeRecord(c, w.buf) != nil {
+			return
+		}
+	}
+}
+
+func TestVxi11(t *testing.T) {
+	f := newFakeVxi11(t)
+	defer f.l.Close()
+	c := &Connection{Timeout: 500 * time.Millisecond}
+	err := c.Open("vxi11://" + f.l.Addr().String() + "/inst0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	name, err := c.QueryIdn()
+	assert.NoError(t, err)
+	assert.Equal(t, "FAKE,VXI11,0,1.0", name)
+
+	// Longer than maxRecv, so the write must be split
+	s, err := c.Ask("MEAS:VOLT:DC? 100.0,0.001")
+	assert.NoError(t, err)
+	assert.Equal(t, "MEAS:VOLT:DC? 100.0,0.001", s)
+
+	assert.NoError(t, c.Clear())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&f.clears))
+	c.Close()
+}
+
+func TestVxi11Resource(t *testing.T) {
+	r, err := ParseResource("TCPIP0::192.168.2.18::INSTR")
+	assert.NoError(t, err)
+	assert.Equal(t, VXI11, r.Transport)
+	assert.Equal(t, "192.168.2.18", r.Address)
+	assert.Equal(t, "inst0", r.Device)
+	r, err = ParseResource("TCPIP::192.168.2.18::gpib0,22::INSTR")
+	assert.NoError(t, err)
+	assert.Equal(t, "gpib0,22", r.Device)
+	r, err = ParseResource("vxi11://scope.local")
+	assert.NoError(t, err)
+	assert.Equal(t, "scope.local", r.Address)
+	assert.Equal(t, "inst0", r.Device)
+}
+
+func TestVxi11UnknownDevice(t *testing.T) {
+	f := newFakeVxi11(t)
+	defer f.l.Close()
+	c := &Connection{Timeout: 500 * time.Millisecond}
+	err := c.Open("vxi11://" + f.l.Addr().String() + "/inst9")
+	assert.Error(t, err)
+}
+
+func TestVxi11Stalled(t *testing.T) {
+	f := newFakeVxi11(t)
+	defer f.l.Close()
+	c := &Connection{Timeout: 500 * time.Millisecond}
+	err := c.Open("vxi11://" + f.l.Addr().String() + "/inst0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	f.stalled.Store(true)
+	assert.Error(t, c.Write("SYST:REM"), "write without progress")
+}
+
+func TestVxi11Deadline(t *testing.T) {
+	f := newFakeVxi11(t)
+	defer f.l.Close()
+	c := &Connection{Timeout: 200 * time.Millisecond}
+	err := c.Open("vxi11://" + f.l.Addr().String() + "/inst0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	// A deadline that has passed is a timeout, also when a response is ready
+	assert.NoError(t, c.Write("*IDN?"))
+	v := c.transport().(*vxi11)
+	_ = v.SetReadDeadline(time.Now().Add(-time.Millisecond))
+	_, err = v.Read(make([]byte, 64))
+	assert.ErrorIs(t, err, ErrTimeout)
+	_ = v.SetWriteDeadline(time.Now().Add(-time.Millisecond))
+	_, err = v.Write([]byte("*IDN?\n"))
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// A record cut by the timeout leaves the rest of it in the stream, so the link is lost
+	f.cut.Store(true)
+	_, err = c.Ask("*IDN?")
+	assert.ErrorIs(t, err, ErrTimeout)
+	f.cut.Store(false)
+	_, err = c.Ask("*IDN?")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestReadRecordTooLong(t *testing.T) {
+	// A single fragment of 2GiB
+	_, err := readRecord(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}))
+	assert.ErrorContains(t, err, "too long")
+	// Many fragments adding up to more than the limit
+	var b []byte
+	for k := 0; k < 3; k++ {
+		b = binary.BigEndian.AppendUint32(b, vxiChunkSize/2)
+		b = append(b, make([]byte, vxiChunkSize/2)...)
+	}
+	_, err = readRecord(bytes.NewReader(b))
+	assert.ErrorContains(t, err, "too long")
+}
@@ -1,6 +1,7 @@
 package cpx400
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -12,6 +13,20 @@ import (
 // Check if tti interface satisfies Psu interface
 var _ instr.Psu = &Cpx400{}
 
+// driver registers the supported models, so that instr.Open can find them
+var driver = instr.Driver{Name: "cpx400", Models: []string{"THURLBY THANDAR,CPX400*"}, Eol: instr.Lf}
+
+func init() {
+	driver.New = func(port string) (instr.Instrument, error) {
+		psu, err := New(port)
+		if err != nil {
+			return nil, err
+		}
+		return psu, nil
+	}
+	instr.Register(driver)
+}
+
 // Cpx400 stores setup for a TTI CPX4000 power supply
 type Cpx400 struct {
 	instr.Connection
@@ -19,14 +34,18 @@ type Cpx400 struct {
 
 // New returns a PSU instance for the tti supply
 func New(port string) (*Cpx400, error) {
-	conn := instr.Connection{Port: port, Timeout: 200 * time.Millisecond, Eol: instr.Lf}
-	psu := &Cpx400{conn}
+	psu := &Cpx400{}
+	psu.Port = port
+	psu.Timeout = 200 * time.Millisecond
+	psu.Eol = instr.Lf
+	psu.ErrorQuery = "*ESR?"
 	err := psu.Open(port)
 	if err != nil {
 		return nil, fmt.Errorf("error opening port, %s", err)
 	}
-	psu.Connection.Name, err = psu.QueryIdn()
-	if err != nil || !strings.HasPrefix(psu.Connection.Name, "THURLBY THANDAR, CPX400DP") {
+	id, err := psu.Identify()
+	if err != nil || !driver.Match(id) {
+		psu.Close()
 		return nil, fmt.Errorf("port %s has not a TTi supply connected", port)
 	}
 	return psu, nil
@@ -39,17 +58,24 @@ func (psu *Cpx400) ChannelCount() int {
 
 // SetOutput will set output voltage and current limit for a given channel
 func (psu *Cpx400) SetOutput(ch instr.Chan, voltage float64, current float64) error {
+	return psu.SetOutputContext(context.Background(), ch, voltage, current)
+}
+
+// SetOutputContext is SetOutput that can be cancelled by ctx
+func (psu *Cpx400) SetOutputContext(ctx context.Context, ch instr.Chan, voltage float64, current float64) error {
+	ctx = psu.Lock(ctx)
+	defer psu.Unlock(ctx)
 	// Set output voltage
-	err := psu.Write("V%d %0.3f", ch, voltage)
+	err := psu.WriteContext(ctx, "V%d %0.3f", ch, voltage)
 	if err != nil {
 		return err
 	}
 	// Set current limit
-	err = psu.Write("I%d %0.2f", ch, current)
+	err = psu.WriteContext(ctx, "I%d %0.2f", ch, current)
 	if err != nil {
 		return err
 	}
-	return psu.Write("OP%d 1", ch)
+	return psu.WriteContext(ctx, "OP%d 1", ch)
 }
 
 // Disable will turn off the given output channel
@@ -62,14 +88,21 @@ func (psu *Cpx400) Disable(ch instr.Chan) {
 
 // GetOutput will return the actual output voltage and current from the channel
 func (psu *Cpx400) GetOutput(ch instr.Chan) (float64, float64, error) {
+	return psu.GetOutputContext(context.Background(), ch)
+}
+
+// GetOutputContext is GetOutput that can be cancelled by ctx
+func (psu *Cpx400) GetOutputContext(ctx context.Context, ch instr.Chan) (float64, float64, error) {
 	if ch < 1 || ch > 2 {
 		return 0.0, 0.0, fmt.Errorf("channel %d illegal", ch)
 	}
+	ctx = psu.Lock(ctx)
+	defer psu.Unlock(ctx)
 	// Read back output voltage
-	voltageString, err1 := psu.Ask("V%dO?", ch)
+	voltageString, err1 := psu.AskContext(ctx, "V%dO?", ch)
 	voltageString = strings.TrimRight(voltageString, "V\n")
 	// Read back output current
-	currentString, err2 := psu.Ask("I%dO?", ch)
+	currentString, err2 := psu.AskContext(ctx, "I%dO?", ch)
 	currentString = strings.TrimRight(currentString, "A\n")
 	volt, err3 := strconv.ParseFloat(voltageString, 64)
 	if err1 != nil || err2 != nil || err3 != nil {
@@ -82,6 +115,21 @@ func (psu *Cpx400) GetOutput(ch instr.Chan) (float64, float64, error) {
 	return volt, curr, nil
 }
 
+// GetOutputReading will return the output voltage and current as readings
+func (psu *Cpx400) GetOutputReading(ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	return psu.GetOutputReadingContext(context.Background(), ch)
+}
+
+// GetOutputReadingContext is GetOutputReading that can be cancelled by ctx
+func (psu *Cpx400) GetOutputReadingContext(ctx context.Context, ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	voltage, current, err := psu.GetOutputContext(ctx, ch)
+	if err != nil {
+		return instr.Reading{}, instr.Reading{}, err
+	}
+	v, i := instr.OutputReadings(psu.Name, ch, voltage, current)
+	return v, i, nil
+}
+
 // GetSetpoint will return the setpoint voltage and current from the channel
 func (psu *Cpx400) GetSetpoint(ch instr.Chan) (float64, float64, error) {
 	if ch < 1 || ch > 2 {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/jkvatne/go-measure/instr"
 	"github.com/jkvatne/go-measure/psu/cpx400"
+	"github.com/jkvatne/go-measure/sim"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -78,3 +79,63 @@ func commonTest(t *testing.T, psu instr.Psu) {
 	psu.Disable(2)
 	psu.Close()
 }
+
+// TestTtiPsuReplay runs the common test against a transcript recorded from the simulator, so no instrument is needed
+func TestTtiPsuReplay(t *testing.T) {
+	p, err := cpx400.New("replay://testdata/cpx400.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	commonTest(t, p)
+}
+
+// TestTtiPsuSim runs the common test against the simulated supply, and checks current limiting
+func TestTtiPsuSim(t *testing.T) {
+	s := sim.NewCpx400()
+	srv, err := sim.Listen(s)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	p, err := cpx400.New(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	commonTest(t, p)
+
+	p, err = cpx400.New(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	// 20V into 50 ohm is limited by the 0.2A current limit
+	s.SetLoad(1, 50)
+	assert.NoError(t, p.SetOutput(instr.Ch1, 20.0, 0.2))
+	volt, current, err := p.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 10.0, volt, 0.01, "voltage in constant current mode")
+	assert.InDelta(t, 0.2, current, 0.001, "current in constant current mode")
+	v, i, err := p.GetOutputReading(instr.Ch1)
+	assert.NoError(t, err)
+	assert.Equal(t, instr.VoltDc, v.Unit)
+	assert.Equal(t, instr.CurrentDc, i.Unit)
+	assert.InDelta(t, 0.2, i.Value, 0.001)
+	assert.Equal(t, instr.Ch1, i.Chan)
+	assert.Equal(t, v.Source, p.Name)
+	p.Disable(1)
+	p.Close()
+}
+
+// TestTtiPsuSimOpen checks that the supply is found by instr.Open
+func TestTtiPsuSimOpen(t *testing.T) {
+	srv, err := sim.Listen(sim.NewCpx400())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+	inst, err := instr.Open(srv.Addr())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer inst.Close()
+	assert.IsType(t, &cpx400.Cpx400{}, inst)
+}
@@ -7,6 +7,7 @@
 package korad
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strconv"
@@ -19,6 +20,21 @@ import (
 // Check if Psu interface satisfies Psu interface
 var _ instr.Psu = &Psu{}
 
+// driver registers the supported models, so that instr.Open can find them.
+// Older firmware responds without spaces, like KORADKD3005PV2.0
+var driver = instr.Driver{Name: "korad", Models: []string{"*KD3005P*", "*,*KD3005P*"}, Baudrate: 9600, Eol: instr.None}
+
+func init() {
+	driver.New = func(port string) (instr.Instrument, error) {
+		psu, err := New(port)
+		if err != nil {
+			return nil, err
+		}
+		return psu, nil
+	}
+	instr.Register(driver)
+}
+
 // Psu stores setup for a Korad KD3005 power supply
 type Psu struct {
 	instr.Connection
@@ -31,16 +47,25 @@ func New(port string) (*Psu, error) {
 	psu := &Psu{}
 	psu.Eol = instr.None
 	psu.Connection.Baudrate = 9600
+	psu.Pacing.Gap = 50 * time.Millisecond
+	var err error
 	if port == "" {
-		port = instr.FindSerialPort("KD3005P", 9600, instr.None)
+		if port, err = instr.Find(driver.Name); err != nil {
+			return nil, err
+		}
 	}
-	err := psu.Open(port)
+	err = psu.Open(port)
 	if err != nil {
 		return nil, fmt.Errorf("error opening port, %s", err)
 	}
-	name, err := psu.QueryIdn()
-	if !strings.Contains(name, "KD3005P") {
-		return nil, fmt.Errorf("unknown instrument %s", name)
+	if psu.Strict {
+		psu.Connection.Close()
+		return nil, fmt.Errorf("strict mode is not supported, the korad supply has no error queue")
+	}
+	id, err := psu.Identify()
+	if err != nil || !driver.Match(id) {
+		psu.Connection.Close()
+		return nil, fmt.Errorf("unknown instrument %s", id)
 	}
 	return psu, nil
 }
@@ -52,6 +77,24 @@ func (psu *Psu) ChannelCount() int {
 
 // SetOutput will set output voltage and current limit for a given channel
 func (psu *Psu) SetOutput(ch instr.Chan, voltage float64, current float64) error {
+	return psu.SetOutputContext(context.Background(), ch, voltage, current)
+}
+
+// SetOutputContext is SetOutput that can be cancelled by ctx.
+// The wait for the output to settle is ended when ctx is done. The supply is not
+// locked during the wait, so that other goroutines can use it.
+func (psu *Psu) SetOutputContext(ctx context.Context, ch instr.Chan, voltage float64, current float64) error {
+	wait, err := psu.setOutput(ctx, ch, voltage, current)
+	if err != nil {
+		return err
+	}
+	return instr.Sleep(ctx, wait)
+}
+
+// setOutput sends the voltage and current limit, and returns the time needed for the output to settle
+func (psu *Psu) setOutput(ctx context.Context, ch instr.Chan, voltage float64, current float64) (time.Duration, error) {
+	ctx = psu.Lock(ctx)
+	defer psu.Unlock(ctx)
 	// The output voltage rate of change is ca 10V/sec
 	var wait time.Duration
 	if voltage > psu.voltage {
@@ -62,19 +105,12 @@ func (psu *Psu) SetOutput(ch instr.Chan, voltage float64, current float64) error
 	psu.voltage = voltage
 	psu.current = current
 	// Set output voltage
-	err := psu.Connection.Write("VSET%d:%0.2f", ch, voltage)
-	time.Sleep(20 * time.Millisecond)
+	err := psu.Connection.WriteContext(ctx, "VSET%d:%0.2f", ch, voltage)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	// Set current limit
-	err = psu.Write("ISET%d:%0.3f", ch, current)
-	time.Sleep(20 * time.Millisecond)
-	if err != nil {
-		return err
-	}
-	time.Sleep(wait)
-	return nil
+	return wait, psu.WriteContext(ctx, "ISET%d:%0.3f", ch, current)
 }
 
 // Disable will turn off the given output channel
@@ -85,11 +121,18 @@ func (psu *Psu) Disable(ch instr.Chan) {
 
 // GetOutput will return the actual output voltage and current from the channel
 func (psu *Psu) GetOutput(ch instr.Chan) (float64, float64, error) {
+	return psu.GetOutputContext(context.Background(), ch)
+}
+
+// GetOutputContext is GetOutput that can be cancelled by ctx
+func (psu *Psu) GetOutputContext(ctx context.Context, ch instr.Chan) (float64, float64, error) {
+	ctx = psu.Lock(ctx)
+	defer psu.Unlock(ctx)
 	// Read back output voltage
-	voltageString, err1 := psu.Ask("VOUT%d?", ch)
+	voltageString, err1 := psu.AskContext(ctx, "VOUT%d?", ch)
 	voltageString = strings.TrimRight(voltageString, "V\n")
 	// Read back output current
-	currentString, err2 := psu.Ask("IOUT%d?", ch)
+	currentString, err2 := psu.AskContext(ctx, "IOUT%d?", ch)
 	currentString = strings.TrimRight(currentString, "A\n")
 	volt, err3 := strconv.ParseFloat(voltageString, 64)
 	if err1 != nil || err2 != nil || err3 != nil {
@@ -102,6 +145,21 @@ func (psu *Psu) GetOutput(ch instr.Chan) (float64, float64, error) {
 	return volt, curr, nil
 }
 
+// GetOutputReading will return the output voltage and current as readings
+func (psu *Psu) GetOutputReading(ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	return psu.GetOutputReadingContext(context.Background(), ch)
+}
+
+// GetOutputReadingContext is GetOutputReading that can be cancelled by ctx
+func (psu *Psu) GetOutputReadingContext(ctx context.Context, ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	voltage, current, err := psu.GetOutputContext(ctx, ch)
+	if err != nil {
+		return instr.Reading{}, instr.Reading{}, err
+	}
+	v, i := instr.OutputReadings(psu.Name, ch, voltage, current)
+	return v, i, nil
+}
+
 // GetSetpoint will return the voltage and current setpoints for the channel
 func (psu *Psu) GetSetpoint(ch instr.Chan) (float64, float64, error) {
 	// Read back output voltage setpoint
@@ -0,0 +1,91 @@
+package korad_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jkvatne/go-measure/instr"
+	"github.com/jkvatne/go-measure/psu/korad"
+	"github.com/jkvatne/go-measure/sim"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestKoradSim runs the driver against the simulated supply on a pseudo terminal
+func TestKoradSim(t *testing.T) {
+	s := sim.NewKorad()
+	port, err := sim.OpenSerial(s)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+	p, err := korad.New(port.Port())
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = p.SetOutput(1, 24.0, 0.2)
+	assert.NoError(t, err, "set output 1")
+	volt, current, err := p.GetOutput(1)
+	assert.NoError(t, err, "get output 1")
+	assert.InDelta(t, 24.0, volt, 0.01, "voltage 1 output")
+	assert.InDelta(t, 0.0, current, 0.001, "current 1 output")
+	volt, current, err = p.GetSetpoint(1)
+	assert.NoError(t, err, "get setpoint 1")
+	assert.InDelta(t, 24.0, volt, 0.01, "voltage 1 setpoint")
+	assert.InDelta(t, 0.2, current, 0.001, "current 1 setpoint")
+
+	// 12V into 100 ohm gives 0.12A
+	s.SetLoad(100)
+	err = p.SetOutput(1, 12.0, 0.2)
+	assert.NoError(t, err, "set output 1")
+	volt, current, err = p.GetOutput(1)
+	assert.NoError(t, err, "get output 1")
+	assert.InDelta(t, 12.0, volt, 0.01, "voltage 1 output")
+	assert.InDelta(t, 0.12, current, 0.001, "current 1 output")
+
+	p.Close()
+	volt, _ = s.Output()
+	assert.Equal(t, 0.0, volt, "output not turned off by Close")
+}
+
+// TestKoradSimOpen checks that the supply is found by instr.Open with its baudrate and terminator
+func TestKoradSimOpen(t *testing.T) {
+	port, err := sim.OpenSerial(sim.NewKorad())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+	id, _, err := instr.Identify(port.Port())
+	assert.NoError(t, err)
+	assert.Equal(t, "KD3005P", id.Model)
+	inst, err := instr.Open(port.Port())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer inst.Close()
+	assert.IsType(t, &korad.Psu{}, inst)
+}
+
+// TestKoradSimPollDuringRamp checks that the supply can be read while SetOutput waits for the output to settle
+func TestKoradSimPollDuringRamp(t *testing.T) {
+	port, err := sim.OpenSerial(sim.NewKorad())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+	p, err := korad.New(port.Port())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer p.Close()
+	assert.NoError(t, p.SetOutput(1, 24.0, 0.2))
+	// Going down from 24V waits ca 2.5s
+	done := make(chan error)
+	go func() { done <- p.SetOutput(1, 0, 0.2) }()
+	time.Sleep(300 * time.Millisecond)
+	start := time.Now()
+	_, _, err = p.GetSetpoint(1)
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "blocked by the wait in SetOutput")
+	assert.NoError(t, <-done)
+}
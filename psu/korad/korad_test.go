@@ -71,3 +71,26 @@ func TestKorad(t *testing.T) {
 	fmt.Printf("Shutdown\n")
 	p.Close()
 }
+
+// TestKoradReplay runs the driver against a transcript recorded from the simulator, so no supply is needed
+func TestKoradReplay(t *testing.T) {
+	p, err := korad.New("replay://testdata/korad.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = p.SetOutput(1, 24.0, 0.2)
+	assert.NoError(t, err, "set output 1")
+	volt, current, err := p.GetOutput(1)
+	assert.NoError(t, err, "get output 1")
+	assert.InDelta(t, 24.0, volt, 0.1, "voltage 1 output")
+	assert.InDelta(t, 0.0, current, 0.1, "current 1 output")
+	volt, current, err = p.GetSetpoint(1)
+	assert.NoError(t, err, "get setpoint 1")
+	assert.InDelta(t, 24.0, volt, 0.01, "voltage 1 setpoint")
+	assert.InDelta(t, 0.2, current, 0.001, "current 1 setpoint")
+	p.Disable(1)
+	volt, _, err = p.GetOutput(1)
+	assert.NoError(t, err, "get output 1")
+	assert.InDelta(t, 0.0, volt, 0.1, "voltage 1 output")
+	p.Close()
+}
@@ -2,6 +2,7 @@ package manualpsu
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"strconv"
@@ -48,6 +49,15 @@ func (p *ManualPsu) SetOutput(ch instr.Chan, voltage float64, current float64) e
 	return nil
 }
 
+// SetOutputContext is SetOutput, but returns at once if ctx is done.
+// Waiting for the operator can not be cancelled.
+func (p *ManualPsu) SetOutputContext(ctx context.Context, ch instr.Chan, voltage float64, current float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.SetOutput(ch, voltage, current)
+}
+
 // GetSetpoint will return the voltage and current setpoints
 func (p *ManualPsu) GetSetpoint(ch instr.Chan) (float64, float64, error) {
 	return p.voltage[ch], p.current[ch], nil
@@ -77,6 +87,29 @@ func (p *ManualPsu) GetOutput(ch instr.Chan) (float64, float64, error) {
 	return p.voltage[ch], cur, nil
 }
 
+// GetOutputContext is GetOutput, but returns at once if ctx is done
+func (p *ManualPsu) GetOutputContext(ctx context.Context, ch instr.Chan) (float64, float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	return p.GetOutput(ch)
+}
+
+// GetOutputReading will return the output voltage and current as readings
+func (p *ManualPsu) GetOutputReading(ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	return p.GetOutputReadingContext(context.Background(), ch)
+}
+
+// GetOutputReadingContext is GetOutputReading that can be cancelled by ctx
+func (p *ManualPsu) GetOutputReadingContext(ctx context.Context, ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	voltage, current, err := p.GetOutputContext(ctx, ch)
+	if err != nil {
+		return instr.Reading{}, instr.Reading{}, err
+	}
+	v, i := instr.OutputReadings("Manual power supply", ch, voltage, current)
+	return v, i, nil
+}
+
 // Close will turn off all outputs and close the communication
 func (p *ManualPsu) Close() {
 	_, _ = fmt.Fprint(*p.Out, "Turn off power supply\n")
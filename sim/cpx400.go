@@ -0,0 +1,152 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// output is one simulated power supply output with a resistive load
+type output struct {
+	voltage float64 // Voltage setpoint
+	current float64 // Current limit
+	on      bool
+	load    float64 // Load resistance, +Inf when open
+}
+
+// actual returns the output voltage and current. The supply is in constant current
+// mode when the load would draw more than the current limit.
+func (o *output) actual() (float64, float64) {
+	if !o.on {
+		return 0, 0
+	}
+	i := o.voltage / o.load
+	if i > o.current {
+		return o.current * o.load, o.current
+	}
+	return o.voltage, i
+}
+
+// Cpx400 simulates a TTi CPX400DP dual power supply. The outputs are open
+// until a load is connected by SetLoad.
+type Cpx400 struct {
+	mutex   sync.Mutex
+	in      lineInput
+	errors  errorQueue
+	outputs [2]output
+}
+
+// NewCpx400 returns a simulated power supply with both outputs off
+func NewCpx400() *Cpx400 {
+	p := &Cpx400{}
+	for k := range p.outputs {
+		p.outputs[k].load = math.Inf(1)
+	}
+	return p
+}
+
+// SetLoad connects a load resistance to output ch (1 or 2). Use math.Inf(1) for an open output.
+func (p *Cpx400) SetLoad(ch int, ohm float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.outputs[ch-1].load = ohm
+}
+
+// Output returns the actual voltage and current on output ch (1 or 2)
+func (p *Cpx400) Output(ch int) (float64, float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.outputs[ch-1].actual()
+}
+
+// Receive handles the commands in data, and returns the responses
+func (p *Cpx400) Receive(data []byte) []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var out []byte
+	for _, line := range p.in.lines(data) {
+		for _, c := range splitCommands(line) {
+			if r, ok := p.execute(c); ok {
+				out = append(out, r+"\r\n"...)
+			}
+		}
+	}
+	return out
+}
+
+// channel returns the output selected by the number in a command
+func (p *Cpx400) channel(n int) *output {
+	if n < 1 || n > len(p.outputs) {
+		p.errors.push(errDataOutOfRange, "Data out of range")
+		return nil
+	}
+	return &p.outputs[n-1]
+}
+
+// execute handles one command, returning the response to queries
+func (p *Cpx400) execute(c command) (string, bool) {
+	if _, ok := c.match("*IDN?"); ok {
+		return "THURLBY THANDAR, CPX400DP, 527193, 1.03-1.00-1.02", true
+	} else if _, ok := c.match("*RST"); ok {
+		for k := range p.outputs {
+			p.outputs[k] = output{voltage: 1, current: 1, load: p.outputs[k].load}
+		}
+	} else if _, ok := c.match("*CLS"); ok {
+		p.errors.clear()
+	} else if _, ok := c.match("*ESR?"); ok {
+		return p.errors.readEsr(), true
+	} else if _, ok := c.match("*OPC?"); ok {
+		return "1", true
+	} else if n, ok := c.match("V#"); ok {
+		p.set(n, c, func(o *output, v float64) { o.voltage = v }, 60)
+	} else if n, ok := c.match("I#"); ok {
+		p.set(n, c, func(o *output, v float64) { o.current = v }, 20)
+	} else if n, ok := c.match("OP#"); ok {
+		if o := p.channel(n); o != nil {
+			o.on = strings.TrimSpace(c.args) == "1"
+		}
+	} else if n, ok := c.match("V#?"); ok {
+		if o := p.channel(n); o != nil {
+			return fmt.Sprintf("V%d %0.2f", n, o.voltage), true
+		}
+	} else if n, ok := c.match("I#?"); ok {
+		if o := p.channel(n); o != nil {
+			return fmt.Sprintf("I%d %0.3f", n, o.current), true
+		}
+	} else if n, ok := c.match("OP#?"); ok {
+		if o := p.channel(n); o != nil {
+			if o.on {
+				return "1", true
+			}
+			return "0", true
+		}
+	} else if n, ok := c.match("V#O?"); ok {
+		if o := p.channel(n); o != nil {
+			v, _ := o.actual()
+			return fmt.Sprintf("%0.2fV", v), true
+		}
+	} else if n, ok := c.match("I#O?"); ok {
+		if o := p.channel(n); o != nil {
+			_, i := o.actual()
+			return fmt.Sprintf("%0.3fA", i), true
+		}
+	} else {
+		p.errors.push(errUndefinedHeader, "Undefined header")
+	}
+	return "", false
+}
+
+// set changes a setpoint, checking that the value is from 0 to max
+func (p *Cpx400) set(n int, c command, set func(o *output, v float64), max float64) {
+	o := p.channel(n)
+	if o == nil {
+		return
+	}
+	v, err := c.float()
+	if err != nil || v < 0 || v > max {
+		p.errors.push(errDataOutOfRange, "Data out of range")
+		return
+	}
+	set(o, v)
+}
@@ -0,0 +1,409 @@
+package sim
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fluke8845 simulates a Fluke 8845A multimeter, or the 8846A having capacitance
+// and temperature. The values measured are set by Set, and may be changed while
+// a driver is connected.
+type Fluke8845 struct {
+	mutex    sync.Mutex
+	model    string
+	in       lineInput
+	errors   errorQueue
+	remote   bool
+	function string
+	rng      float64
+	values   map[string]float64
+	nplc     map[string]float64 // Integration time in power line cycles, for each function
+	trigger  flukeTrigger
+	pending  int       // Triggers left of the acquisition started by INIT
+	memory   []float64 // Readings not yet read by R?
+	readings []float64 // Readings of the last acquisition, returned by FETC?
+}
+
+// flukeTrigger is the trigger setup used by INIT
+type flukeTrigger struct {
+	source  string // IMM, BUS or EXT
+	count   int    // Triggers accepted by INIT (TRIG:COUN)
+	samples int    // Readings taken for each trigger (SAMP:COUN)
+	delay   float64
+}
+
+// flukeDefaultTrigger is the trigger setup after *RST
+var flukeDefaultTrigger = flukeTrigger{source: "IMM", count: 1, samples: 1}
+
+// flukeNplc are the integration times supported, in power line cycles
+var flukeNplc = []float64{0.02, 0.2, 1, 10, 100}
+
+// flukeMemory is the number of readings the data memory holds
+const flukeMemory = 5000
+
+// flukeFunctions maps the measurement functions to the names used by Set
+var flukeFunctions = []struct {
+	pattern  string
+	function string
+}{
+	{"VOLTage", "VOLT:DC"},
+	{"VOLTage:DC", "VOLT:DC"},
+	{"VOLTage:AC", "VOLT:AC"},
+	{"CURRent", "CURR:DC"},
+	{"CURRent:DC", "CURR:DC"},
+	{"CURRent:AC", "CURR:AC"},
+	{"RESistance", "RES"},
+	{"FRESistance", "FRES"},
+	{"FREQuency", "FREQ"},
+	{"PERiod", "PER"},
+	{"CAPacitance", "CAP"},
+	{"TEMPerature", "TEMP:RTD"},
+	{"TEMPerature:RTD", "TEMP:RTD"},
+	{"TEMPerature:FRTD", "TEMP:FRTD"},
+	{"DIODe", "DIOD"},
+	{"CONTinuity", "CONT"},
+}
+
+// flukeRanges are the ranges of the functions having a range. The range used is 0 for autorange.
+var flukeRanges = map[string][]float64{
+	"VOLT:DC": {0.1, 1, 10, 100, 1000},
+	"VOLT:AC": {0.1, 1, 10, 100, 750},
+	"CURR:DC": {100e-6, 1e-3, 10e-3, 100e-3, 400e-3, 1, 3, 10},
+	"CURR:AC": {100e-6, 1e-3, 10e-3, 100e-3, 400e-3, 1, 3, 10},
+	"RES":     {10, 100, 1e3, 10e3, 100e3, 1e6, 10e6, 100e6},
+	"FRES":    {10, 100, 1e3, 10e3, 100e3, 1e6, 10e6, 100e6},
+	"CAP":     {1e-9, 10e-9, 100e-9, 1e-6, 10e-6, 100e-6, 1e-3, 10e-3, 100e-3},
+}
+
+// flukeOverload is returned when the value is outside the range
+const flukeOverload = 9.9e37
+
+// NewFluke8845 returns a simulated multimeter measuring 0 on all functions
+func NewFluke8845() *Fluke8845 {
+	return &Fluke8845{model: "8845A", function: "VOLT:DC", values: map[string]float64{}, nplc: map[string]float64{},
+		trigger: flukeDefaultTrigger}
+}
+
+// NewFluke8846 returns a simulated 8846A multimeter, which also measures capacitance and temperature
+func NewFluke8846() *Fluke8845 {
+	f := NewFluke8845()
+	f.model = "8846A"
+	return f
+}
+
+// Set will set the value measured by a function like "VOLT:DC", "CURR:AC", "RES", "FREQ" or "TEMP".
+// The temperature is the same for all sensors.
+func (f *Fluke8845) Set(function string, value float64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.values[function] = value
+}
+
+// Remote returns true when the multimeter has been set to remote by SYST:REM
+func (f *Fluke8845) Remote() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.remote
+}
+
+// Nplc returns the integration time of a function like "VOLT:DC", in power line cycles
+func (f *Fluke8845) Nplc(function string) float64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.nplcOf(function)
+}
+
+// nplcOf returns the integration time of a function, 10 if not set
+func (f *Fluke8845) nplcOf(function string) float64 {
+	if n, ok := f.nplc[function]; ok {
+		return n
+	}
+	return 10
+}
+
+// Receive handles the commands in data, and returns the responses
+func (f *Fluke8845) Receive(data []byte) []byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var out []byte
+	for _, line := range f.in.lines(data) {
+		var resp []string
+		for _, c := range splitCommands(line) {
+			if r, ok := f.execute(c); ok {
+				resp = append(resp, r)
+			}
+		}
+		if len(resp) > 0 {
+			out = append(out, strings.Join(resp, ";")+"\r\n"...)
+		}
+	}
+	return out
+}
+
+// execute handles one command, returning the response to queries
+func (f *Fluke8845) execute(c command) (string, bool) {
+	if _, ok := c.match("*IDN?"); ok {
+		return "FLUKE," + f.model + ",2359004,08/02/10-11:53", true
+	} else if _, ok := c.match("*RST"); ok {
+		f.function, f.rng = "VOLT:DC", 0
+		f.nplc, f.trigger, f.pending = map[string]float64{}, flukeDefaultTrigger, 0
+		f.memory, f.readings = nil, nil
+	} else if _, ok := c.match("*TRG"); ok {
+		f.trig("BUS")
+	} else if _, ok := c.match("*CLS"); ok {
+		f.errors.clear()
+	} else if _, ok := c.match("*ESR?"); ok {
+		return f.errors.readEsr(), true
+	} else if _, ok := c.match("*OPC?"); ok {
+		return "1", true
+	} else if _, ok := c.match("SYSTem:ERRor?"); ok {
+		return f.errors.next(), true
+	} else if _, ok := c.match("SYSTem:REMote"); ok {
+		f.remote = true
+	} else if _, ok := c.match("SYSTem:LOCal"); ok {
+		f.remote = false
+	} else if _, ok := c.match("READ?"); ok {
+		return formatFloat(f.read()), true
+	} else if _, ok := c.match("TRIGger:SOURce"); ok {
+		src := strings.ToUpper(strings.TrimSpace(c.args))
+		switch {
+		case strings.HasPrefix(src, "IMM"):
+			f.trigger.source = "IMM"
+		case src == "BUS", strings.HasPrefix(src, "EXT"):
+			f.trigger.source = src[:3]
+		default:
+			f.errors.push(errDataOutOfRange, "Data out of range")
+		}
+	} else if _, ok := c.match("TRIGger:COUNt"); ok {
+		f.trigger.count = f.count(c)
+	} else if _, ok := c.match("SAMPle:COUNt"); ok {
+		f.trigger.samples = f.count(c)
+	} else if _, ok := c.match("TRIGger:DELay"); ok {
+		if v, err := c.float(); err == nil && v >= 0 {
+			f.trigger.delay = v
+		} else {
+			f.errors.push(errDataOutOfRange, "Data out of range")
+		}
+	} else if _, ok := c.match("INITiate"); ok {
+		f.memory, f.readings, f.pending = nil, nil, f.trigger.count
+		if f.trigger.source == "IMM" {
+			for f.pending > 0 {
+				f.trig("IMM")
+			}
+		}
+	} else if _, ok := c.match("FETCh?"); ok {
+		return f.join(f.readings), true
+	} else if _, ok := c.match("R?"); ok {
+		n := len(f.memory)
+		if v, err := c.float(); err == nil && v >= 0 && int(v) < n {
+			n = int(v)
+		}
+		data := f.join(f.memory[:n])
+		f.memory = f.memory[n:]
+		return block([]byte(data)), true
+	} else if _, ok := c.match("DATA:POINts?"); ok {
+		return strconv.Itoa(len(f.memory)), true
+	} else if fn, ok := f.setting(c, "NPLCycles?"); ok {
+		return formatFloat(f.nplcOf(fn)), true
+	} else if fn, ok := f.setting(c, "NPLCycles"); ok {
+		f.setNplc(fn, c)
+	} else if fn, ok := f.setting(c, "RANGe:AUTO?"); ok && fn == f.function {
+		if f.rng == 0 {
+			return "1", true
+		}
+		return "0", true
+	} else if fn, ok := f.setting(c, "RANGe:AUTO"); ok && fn == f.function {
+		switch strings.ToUpper(c.args) {
+		case "ON", "1":
+			f.rng = 0
+		case "OFF", "0":
+			f.rng = f.rangeUsed()
+		default:
+			f.errors.push(errDataOutOfRange, "Data out of range")
+		}
+	} else if _, ok := c.match("CONFigure?"); ok {
+		return "\"" + f.function + " " + formatFloat(f.rangeUsed()) + "\"", true
+	} else if fn, ok := f.subFunction(c, "CONFigure:"); ok {
+		f.configure(fn, c.args)
+	} else if fn, ok := f.subFunction(c, "MEASure:"); ok && strings.HasSuffix(c.header, "?") {
+		f.configure(fn, c.args)
+		return formatFloat(f.read()), true
+	} else {
+		f.errors.push(errUndefinedHeader, "Undefined header")
+	}
+	return "", false
+}
+
+// trig takes the readings for one trigger from source, if INIT waits for it
+func (f *Fluke8845) trig(source string) {
+	if f.pending == 0 || f.trigger.source != source {
+		return
+	}
+	f.pending--
+	for k := 0; k < f.trigger.samples; k++ {
+		v := f.read()
+		f.readings = append(f.readings, v)
+		if len(f.memory) < flukeMemory {
+			f.memory = append(f.memory, v)
+		}
+	}
+}
+
+// count returns the argument of TRIG:COUN or SAMP:COUN, which must be from 1 to 50000
+func (f *Fluke8845) count(c command) int {
+	v, err := c.float()
+	if err != nil || v < 1 || v > 50000 {
+		f.errors.push(errDataOutOfRange, "Data out of range")
+		return 1
+	}
+	return int(v)
+}
+
+// join formats the readings as a comma separated list
+func (f *Fluke8845) join(values []float64) string {
+	s := make([]string, len(values))
+	for k, v := range values {
+		s[k] = formatFloat(v)
+	}
+	return strings.Join(s, ",")
+}
+
+// setting returns the function of a command like VOLT:DC:NPLC or SENS:RES:RANG:AUTO?,
+// where the pattern gives the setting following the function
+func (f *Fluke8845) setting(c command, pattern string) (string, bool) {
+	header := c.header
+	if root, rest, found := strings.Cut(header, ":"); found {
+		if _, ok := (command{header: root}).match("SENSe"); ok {
+			header = rest
+		}
+	}
+	parts := strings.Split(header, ":")
+	n := len(parts) - strings.Count(pattern, ":") - 1
+	if n < 1 {
+		return "", false
+	}
+	if _, ok := (command{header: strings.Join(parts[n:], ":")}).match(pattern); !ok {
+		return "", false
+	}
+	sub := command{header: strings.Join(parts[:n], ":")}
+	for _, fn := range flukeFunctions {
+		if _, ok := sub.match(fn.pattern); ok {
+			return fn.function, true
+		}
+	}
+	return "", false
+}
+
+// setNplc sets the integration time of a function, which must be one of the supported values
+func (f *Fluke8845) setNplc(function string, c command) {
+	switch function {
+	case "VOLT:DC", "CURR:DC", "RES", "FRES":
+	default:
+		f.errors.push(errUndefinedHeader, "Undefined header")
+		return
+	}
+	arg := strings.ToUpper(strings.TrimSpace(c.args))
+	switch arg {
+	case "MIN":
+		f.nplc[function] = flukeNplc[0]
+		return
+	case "MAX":
+		f.nplc[function] = flukeNplc[len(flukeNplc)-1]
+		return
+	}
+	v, err := strconv.ParseFloat(arg, 64)
+	if err == nil {
+		for _, n := range flukeNplc {
+			if v <= n*1.001 {
+				f.nplc[function] = n
+				return
+			}
+		}
+	}
+	f.errors.push(errDataOutOfRange, "Data out of range")
+}
+
+// subFunction returns the function following the prefix, like VOLT:DC in CONF:VOLT:DC
+func (f *Fluke8845) subFunction(c command, prefix string) (string, bool) {
+	root, rest, found := strings.Cut(c.header, ":")
+	if !found {
+		return "", false
+	}
+	if _, ok := (command{header: root}).match(strings.TrimSuffix(prefix, ":")); !ok {
+		return "", false
+	}
+	sub := command{header: strings.TrimSuffix(rest, "?")}
+	for _, fn := range flukeFunctions {
+		if _, ok := sub.match(fn.pattern); ok {
+			return fn.function, true
+		}
+	}
+	return "", false
+}
+
+// configure selects function and range. The range is the first argument.
+// Like the real multimeter, the trigger and integration time are set to the defaults.
+func (f *Fluke8845) configure(function string, args string) {
+	r, _, _ := strings.Cut(args, ",")
+	r = strings.ToUpper(strings.TrimSpace(r))
+	if f.model == "8845A" && (function == "CAP" || strings.HasPrefix(function, "TEMP")) {
+		f.errors.push(errUndefinedHeader, "Undefined header")
+		return
+	}
+	ranges := flukeRanges[function]
+	rng := 0.0
+	switch {
+	case r == "" || r == "DEF" || r == "AUTO" || len(ranges) == 0:
+	case r == "MIN":
+		rng = ranges[0]
+	case r == "MAX":
+		rng = ranges[len(ranges)-1]
+	default:
+		v, err := strconv.ParseFloat(r, 64)
+		if err != nil || v <= 0 || v > ranges[len(ranges)-1]*1.001 {
+			f.errors.push(errDataOutOfRange, "Data out of range")
+			return
+		}
+		// The lowest range covering the value
+		for k := len(ranges) - 1; k >= 0 && v <= ranges[k]*1.001; k-- {
+			rng = ranges[k]
+		}
+	}
+	f.function, f.rng = function, rng
+	f.trigger = flukeDefaultTrigger
+	delete(f.nplc, function)
+}
+
+// key returns the name used by Set for the configured function
+func (f *Fluke8845) key() string {
+	if strings.HasPrefix(f.function, "TEMP") {
+		return "TEMP"
+	}
+	return f.function
+}
+
+// rangeUsed returns the range, which in autorange is the lowest range covering the value
+func (f *Fluke8845) rangeUsed() float64 {
+	ranges := flukeRanges[f.function]
+	if f.rng > 0 || len(ranges) == 0 {
+		return f.rng
+	}
+	v := math.Abs(f.values[f.key()])
+	for _, r := range ranges {
+		if v <= r*1.2 {
+			return r
+		}
+	}
+	return ranges[len(ranges)-1]
+}
+
+// read returns the value for the configured function, or overload if it is outside the range
+func (f *Fluke8845) read() float64 {
+	v := f.values[f.key()]
+	if r := f.rangeUsed(); r > 0 && (v > r*1.2 || v < -r*1.2) {
+		return flukeOverload
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// koradCommand matches one command at the start of the received data. The korad
+// commands have no terminator, and two commands written without a pause may
+// arrive in the same read, so they are separated by their syntax.
+var koradCommand = regexp.MustCompile(`^(\*IDN\?|STATUS\?|OUT[01]|OCP[01]|OVP[01]|BEEP[01]|` +
+	`(VSET|ISET)(\d):([0-9]*\.?[0-9]*)|(VSET|ISET|VOUT|IOUT)(\d)\?)`)
+
+// Korad simulates a Korad KD3005P power supply. The output is on, like
+// after power-up of the real supply, and open until a load is connected by SetLoad.
+type Korad struct {
+	mutex sync.Mutex
+	out   output
+}
+
+// NewKorad returns a simulated power supply set to 0V and 0A
+func NewKorad() *Korad {
+	return &Korad{out: output{on: true, load: math.Inf(1)}}
+}
+
+// SetLoad connects a load resistance to the output. Use math.Inf(1) for an open output.
+func (k *Korad) SetLoad(ohm float64) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.out.load = ohm
+}
+
+// Output returns the actual voltage and current on the output
+func (k *Korad) Output() (float64, float64) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.out.actual()
+}
+
+// Receive handles the commands in data, and returns the responses.
+// Data not recognized as a command is ignored, as on the real supply.
+func (k *Korad) Receive(data []byte) []byte {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	var out []byte
+	s := string(data)
+	for len(s) > 0 {
+		m := koradCommand.FindStringSubmatch(s)
+		if m == nil {
+			s = s[1:]
+			continue
+		}
+		s = s[len(m[0]):]
+		out = append(out, k.execute(m)...)
+	}
+	return out
+}
+
+// execute handles one command, given as the submatches of koradCommand
+func (k *Korad) execute(m []string) string {
+	v, i := k.out.actual()
+	switch {
+	case m[0] == "*IDN?":
+		return "KORAD KD3005P V6.8 SN:03379314"
+	case m[0] == "STATUS?":
+		status := byte(0)
+		if i < k.out.current {
+			status |= 0x01 // Constant voltage mode
+		}
+		if k.out.on {
+			status |= 0x40
+		}
+		return string([]byte{status})
+	case m[0] == "OUT0" || m[0] == "OUT1":
+		k.out.on = m[0] == "OUT1"
+	case m[2] != "" && m[3] == "1":
+		value, err := strconv.ParseFloat(m[4], 64)
+		if err != nil {
+			return ""
+		}
+		if m[2] == "VSET" {
+			k.out.voltage = math.Min(value, 31)
+		} else {
+			k.out.current = math.Min(value, 5.1)
+		}
+	case m[6] == "1":
+		switch m[5] {
+		case "VSET":
+			return fmt.Sprintf("%05.2f", k.out.voltage)
+		case "ISET":
+			return fmt.Sprintf("%05.3f", k.out.current)
+		case "VOUT":
+			return fmt.Sprintf("%05.2f", v)
+		case "IOUT":
+			return fmt.Sprintf("%05.3f", i)
+		}
+	}
+	return ""
+}
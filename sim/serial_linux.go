@@ -0,0 +1,113 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Serial serves a simulated instrument on a pseudo terminal, which the driver
+// opens as a serial port. The baudrate is ignored.
+type Serial struct {
+	master *os.File
+	slave  *os.File
+	name   string
+	wg     sync.WaitGroup
+}
+
+// OpenSerial creates a pseudo terminal and starts serving inst on it.
+// Use Port to get the name of the port.
+func OpenSerial(inst Instrument) (*Serial, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	name, err := ptsName(master)
+	if err != nil {
+		_ = master.Close()
+		return nil, err
+	}
+	// The slave is kept open, so that reading the master does not fail while the driver
+	// has the port closed. It is also set to raw mode before the driver opens it.
+	slave, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err == nil {
+		err = makeRaw(slave)
+	}
+	if err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("error opening %s, %w", name, err)
+	}
+	s := &Serial{master: master, slave: slave, name: name}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		serve(master, inst)
+	}()
+	return s, nil
+}
+
+// Port returns the name of the port to give to the driver, like /dev/pts/3
+func (s *Serial) Port() string {
+	return s.name
+}
+
+// Close stops serving and removes the pseudo terminal
+func (s *Serial) Close() {
+	_ = s.master.Close()
+	s.wg.Wait()
+	_ = s.slave.Close()
+}
+
+// ptsName unlocks the slave of the pseudo terminal and returns its name
+func ptsName(master *os.File) (string, error) {
+	rc, err := master.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+	var n uint32
+	var ioctlErr error
+	err = rc.Control(func(fd uintptr) {
+		unlock := int32(0)
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock)))
+		if errno != 0 {
+			ioctlErr = errno
+			return
+		}
+		n, ioctlErr = unix.IoctlGetUint32(int(fd), unix.TIOCGPTN)
+	})
+	if err == nil {
+		err = ioctlErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("error creating pseudo terminal, %w", err)
+	}
+	return fmt.Sprintf("/dev/pts/%d", n), nil
+}
+
+// makeRaw turns off echo and all processing of characters, so binary data passes unchanged
+func makeRaw(f *os.File) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = rc.Control(func(fd uintptr) {
+		var t *unix.Termios
+		t, ioctlErr = unix.IoctlGetTermios(int(fd), unix.TCGETS)
+		if ioctlErr != nil {
+			return
+		}
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag = t.Cflag&^(unix.CSIZE|unix.PARENB) | unix.CS8
+		ioctlErr = unix.IoctlSetTermios(int(fd), unix.TCSETS, t)
+	})
+	if err == nil {
+		err = ioctlErr
+	}
+	return err
+}
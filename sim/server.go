@@ -0,0 +1,85 @@
+package sim
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// Server serves a simulated instrument on a tcp port on localhost
+type Server struct {
+	listener net.Listener
+	inst     Instrument
+	mutex    sync.Mutex
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+// Listen starts serving inst on a free tcp port. Use Addr to get the address.
+func Listen(inst Instrument) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: l, inst: inst, conns: map[net.Conn]bool{}}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address to give to the driver, like 127.0.0.1:41235
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes all connections
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.mutex.Lock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns[c] = true
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			serve(c, s.inst)
+			s.mutex.Lock()
+			delete(s.conns, c)
+			s.mutex.Unlock()
+			_ = c.Close()
+		}()
+	}
+}
+
+// serve passes data received on conn to the instrument and sends back the responses,
+// until conn is closed
+func serve(conn io.ReadWriter, inst Instrument) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if resp := inst.Receive(buf[:n]); len(resp) > 0 {
+				if _, err := conn.Write(resp); err != nil {
+					return
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
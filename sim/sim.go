@@ -0,0 +1,186 @@
+// Package sim contains simulated instruments, making it possible to test the
+// drivers without hardware. The Fluke 8845A and TTi CPX400DP are served on a
+// tcp port by Listen, while the Korad KD3005P and Tektronix TPS2000 are
+// connected to a pseudo terminal by OpenSerial (linux only).
+
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Instrument is a simulated instrument. Receive is called with the data received
+// from the driver, and returns the data to send back.
+type Instrument interface {
+	Receive(data []byte) []byte
+}
+
+// SCPI error codes used by the simulators
+const (
+	errUndefinedHeader = -113
+	errDataOutOfRange  = -222
+	errQueryInterrupt  = -410
+)
+
+// Standard event status register bits
+const (
+	esrQueryError   = 0x04
+	esrDeviceError  = 0x08
+	esrExecError    = 0x10
+	esrCommandError = 0x20
+)
+
+// scpiError is an entry in the error queue
+type scpiError struct {
+	code int
+	msg  string
+}
+
+// errorQueue is the SCPI error queue and standard event status register
+type errorQueue struct {
+	errors []scpiError
+	esr    int
+}
+
+// push adds an error to the queue and sets the event status bit for its class
+func (q *errorQueue) push(code int, msg string) {
+	q.errors = append(q.errors, scpiError{code, msg})
+	switch {
+	case code <= -100 && code > -200:
+		q.esr |= esrCommandError
+	case code <= -200 && code > -300:
+		q.esr |= esrExecError
+	case code <= -400 && code > -500:
+		q.esr |= esrQueryError
+	default:
+		q.esr |= esrDeviceError
+	}
+}
+
+// next returns the response to SYST:ERR?
+func (q *errorQueue) next() string {
+	if len(q.errors) == 0 {
+		return "+0,\"No error\""
+	}
+	e := q.errors[0]
+	q.errors = q.errors[1:]
+	return fmt.Sprintf("%+d,\"%s\"", e.code, e.msg)
+}
+
+// readEsr returns and clears the event status register
+func (q *errorQueue) readEsr() string {
+	esr := q.esr
+	q.esr = 0
+	return strconv.Itoa(esr)
+}
+
+// clear empties the queue, like *CLS
+func (q *errorQueue) clear() {
+	q.errors = nil
+	q.esr = 0
+}
+
+// lineInput collects received data until a line terminator arrives
+type lineInput struct {
+	buf []byte
+}
+
+// lines returns the complete lines received, without terminators
+func (l *lineInput) lines(data []byte) []string {
+	l.buf = append(l.buf, data...)
+	var lines []string
+	for {
+		k := strings.IndexAny(string(l.buf), "\n")
+		if k < 0 {
+			return lines
+		}
+		lines = append(lines, strings.TrimRight(string(l.buf[:k]), "\r"))
+		l.buf = l.buf[k+1:]
+	}
+}
+
+// command is one SCPI command, split into header and arguments
+type command struct {
+	header string
+	args   string
+}
+
+// splitCommands splits a line into commands. A command following a semicolon
+// is relative to the path of the previous command, unless it starts with : or *.
+func splitCommands(line string) []command {
+	var cmds []command
+	path := ""
+	for _, s := range strings.Split(line, ";") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		header, args, _ := strings.Cut(s, " ")
+		header = strings.ToUpper(header)
+		if strings.HasPrefix(header, ":") || strings.HasPrefix(header, "*") {
+			header = strings.TrimPrefix(header, ":")
+		} else {
+			header = path + header
+		}
+		if k := strings.LastIndex(header, ":"); k >= 0 {
+			path = header[:k+1]
+		} else {
+			path = ""
+		}
+		cmds = append(cmds, command{header: header, args: strings.TrimSpace(args)})
+	}
+	return cmds
+}
+
+// match compares a command header with a pattern having the short form in upper case
+// and the rest in lower case, like "MEASurement:IMMed:VALue?". A # in the pattern
+// matches a number, which is returned. Both the short and long forms are accepted.
+func (c command) match(pattern string) (n int, ok bool) {
+	pp := strings.Split(pattern, ":")
+	hp := strings.Split(c.header, ":")
+	if len(pp) != len(hp) {
+		return 0, false
+	}
+	for k, p := range pp {
+		h := hp[k]
+		if strings.HasSuffix(p, "?") != strings.HasSuffix(h, "?") {
+			return 0, false
+		}
+		p, h = strings.TrimSuffix(p, "?"), strings.TrimSuffix(h, "?")
+		if pre, post, found := strings.Cut(p, "#"); found {
+			j := strings.IndexAny(h, "0123456789")
+			if j < 0 {
+				return 0, false
+			}
+			e := j + len(h[j:]) - len(strings.TrimLeft(h[j:], "0123456789"))
+			if h[e:] != strings.ToUpper(post) {
+				return 0, false
+			}
+			n, _ = strconv.Atoi(h[j:e])
+			p, h = pre, h[:j]
+		}
+		short := strings.TrimRightFunc(p, func(r rune) bool { return r >= 'a' && r <= 'z' })
+		if len(h) < len(short) || !strings.HasPrefix(strings.ToUpper(p), h) {
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+// float returns the argument as a number
+func (c command) float() (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(c.args), 64)
+}
+
+// block formats data as an IEEE 488.2 definite length block, like #15hello
+func block(data []byte) string {
+	n := strconv.Itoa(len(data))
+	return "#" + strconv.Itoa(len(n)) + n + string(data)
+}
+
+// formatFloat formats a value like most SCPI instruments
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%+.8E", v)
+}
@@ -0,0 +1,42 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommands(t *testing.T) {
+	cmds := splitCommands("DATA:WIDTH 1;START 1;:CH1:SCA 0.5;*OPC?")
+	assert.Equal(t, []command{
+		{header: "DATA:WIDTH", args: "1"},
+		{header: "DATA:START", args: "1"},
+		{header: "CH1:SCA", args: "0.5"},
+		{header: "*OPC?"},
+	}, cmds)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		pattern string
+		n       int
+		ok      bool
+	}{
+		{"MEASU:IMMED:VALUE?", "MEASUrement:IMMed:VALue?", 0, true},
+		{"MEASUREMENT:IMM:VAL?", "MEASUrement:IMMed:VALue?", 0, true},
+		{"MEAS:IMM:VAL?", "MEASUrement:IMMed:VALue?", 0, false},
+		{"MEASU:IMM:VAL", "MEASUrement:IMMed:VALue?", 0, false},
+		{"WFMPRE:CH3:XINCR?", "WFMPre:CH#:XINcr?", 3, true},
+		{"V2O?", "V#O?", 2, true},
+		{"V2?", "V#O?", 0, false},
+		{"V12", "V#", 12, true},
+		{"CONF:VOLT:DC", "CONFigure:VOLTage:DC", 0, true},
+		{"CONF:VOLT", "CONFigure:VOLTage:DC", 0, false},
+	}
+	for _, test := range tests {
+		n, ok := command{header: test.header}.match(test.pattern)
+		assert.Equal(t, test.ok, ok, "%s matching %s", test.header, test.pattern)
+		assert.Equal(t, test.n, n, "%s matching %s", test.header, test.pattern)
+	}
+}
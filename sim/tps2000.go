@@ -0,0 +1,414 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Shape is the form of a simulated signal
+type Shape int
+
+// Signal shapes
+const (
+	Dc Shape = iota
+	Sine
+	Square
+)
+
+// Signal is a periodic signal connected to a simulated scope channel
+type Signal struct {
+	Shape     Shape
+	Frequency float64 // Hz, not used for Dc
+	Amplitude float64 // Peak voltage, not used for Dc
+	Offset    float64 // Average voltage
+}
+
+// ProbeComp is the probe compensation signal on the front of the scope, 0 to 5V at 1kHz
+var ProbeComp = Signal{Shape: Square, Frequency: 1000, Amplitude: 2.5, Offset: 2.5}
+
+// value returns the voltage at time t, where t=0 is the start of a period.
+// A sine wave starts at the offset going up, and a square wave starts high.
+func (s Signal) value(t float64) float64 {
+	switch s.Shape {
+	case Sine:
+		return s.Offset + s.Amplitude*math.Sin(2*math.Pi*s.Frequency*t)
+	case Square:
+		if p := t * s.Frequency; p-math.Floor(p) < 0.5 {
+			return s.Offset + s.Amplitude
+		}
+		return s.Offset - s.Amplitude
+	}
+	return s.Offset
+}
+
+// crossing returns the time within the first period where the signal passes level
+// on the given slope, or 0 if it never does
+func (s Signal) crossing(level float64, rising bool) float64 {
+	if s.Shape == Dc || s.Frequency <= 0 || math.Abs(level-s.Offset) >= s.Amplitude {
+		return 0
+	}
+	period := 1 / s.Frequency
+	if s.Shape == Square {
+		if rising {
+			return 0
+		}
+		return period / 2
+	}
+	phase := math.Asin((level - s.Offset) / s.Amplitude)
+	if !rising {
+		phase = math.Pi - phase
+	}
+	return math.Mod(phase/(2*math.Pi)+1, 1) * period
+}
+
+// tpsChannel is the vertical setup and input signal of one channel
+type tpsChannel struct {
+	on       bool
+	scale    float64 // Volt pr division
+	position float64 // Divisions
+	coupling string
+	signal   Signal
+}
+
+// Tps2000 simulates a Tektronix TPS2024 oscilloscope. The signals on the channels
+// are set by SetSignal, and channel 1 has the probe compensation signal connected.
+// The acquired waveform is triggered on the selected edge of the trigger source.
+type Tps2000 struct {
+	mutex      sync.Mutex
+	in         lineInput
+	errors     errorQueue
+	channels   [4]tpsChannel
+	horScale   float64 // Seconds pr division
+	horPos     float64
+	acqMode    string
+	trigSource int
+	trigLevel  float64
+	trigRising bool
+	trigMode   string
+	dataSource int
+	dataWidth  int
+	dataStart  int
+	dataStop   int
+	encoding   string
+	measSource int
+	measType   string
+}
+
+// tpsRecordLength is the number of points in a waveform, covering 10 divisions
+const tpsRecordLength = 2500
+
+// tpsInvalid is returned by measurements that can not be made
+const tpsInvalid = 9.9e37
+
+// NewTps2000 returns a simulated scope after a reset
+func NewTps2000() *Tps2000 {
+	s := &Tps2000{}
+	s.reset()
+	s.channels[0].signal = ProbeComp
+	return s
+}
+
+// reset sets the default setup, but keeps the signals
+func (s *Tps2000) reset() {
+	for k := range s.channels {
+		s.channels[k] = tpsChannel{on: k == 0, scale: 1, coupling: "DC", signal: s.channels[k].signal}
+	}
+	s.horScale, s.horPos, s.acqMode = 500e-6, 0, "SAMPLE"
+	s.trigSource, s.trigLevel, s.trigRising, s.trigMode = 1, 0, true, "AUTO"
+	s.dataSource, s.dataWidth, s.dataStart, s.dataStop, s.encoding = 1, 1, 1, tpsRecordLength, "RIBINARY"
+	s.measSource, s.measType = 1, "FREQUENCY"
+}
+
+// SetSignal connects a signal to channel ch (1 to 4)
+func (s *Tps2000) SetSignal(ch int, signal Signal) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.channels[ch-1].signal = signal
+}
+
+// Receive handles the commands in data, and returns the responses
+func (s *Tps2000) Receive(data []byte) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var out []byte
+	for _, line := range s.in.lines(data) {
+		var resp []string
+		for _, c := range splitCommands(line) {
+			if r, ok := s.execute(c); ok {
+				resp = append(resp, r)
+			}
+		}
+		if len(resp) > 0 {
+			out = append(out, strings.Join(resp, ";")+"\n"...)
+		}
+	}
+	return out
+}
+
+// channel returns the channel with number n, or nil if it does not exist
+func (s *Tps2000) channel(n int) *tpsChannel {
+	if n < 1 || n > len(s.channels) {
+		s.errors.push(errUndefinedHeader, "Undefined header")
+		return nil
+	}
+	return &s.channels[n-1]
+}
+
+// source parses a channel name like CH1
+func (s *Tps2000) source(arg string) int {
+	c := command{header: strings.ToUpper(strings.TrimSpace(arg))}
+	if n, ok := c.match("CH#"); ok && n >= 1 && n <= len(s.channels) {
+		return n
+	}
+	s.errors.push(errDataOutOfRange, "Data out of range")
+	return 0
+}
+
+// number parses a numeric argument, pushing an error if it is invalid
+func (s *Tps2000) number(c command) (float64, bool) {
+	v, err := c.float()
+	if err != nil {
+		s.errors.push(errDataOutOfRange, "Data out of range")
+		return 0, false
+	}
+	return v, true
+}
+
+// execute handles one command, returning the response to queries
+func (s *Tps2000) execute(c command) (string, bool) {
+	arg := strings.ToUpper(c.args)
+	if _, ok := c.match("*IDN?"); ok {
+		return "TEKTRONIX,TPS 2024,C010123,CF:91.1CT FV:v11.12", true
+	} else if _, ok := c.match("*RST"); ok {
+		s.reset()
+	} else if _, ok := c.match("*CLS"); ok {
+		s.errors.clear()
+	} else if _, ok := c.match("*ESR?"); ok {
+		return s.errors.readEsr(), true
+	} else if _, ok := c.match("*OPC?"); ok {
+		return "1", true
+	} else if _, ok := c.match("POWer:BUTTONLIGHT"); ok {
+	} else if _, ok := c.match("ACQuire:MODe"); ok {
+		s.acqMode = arg
+	} else if n, ok := c.match("CH#:POSition"); ok {
+		if ch, v := s.channel(n), 0.0; ch != nil {
+			if v, ok = s.number(c); ok {
+				ch.position = v
+			}
+		}
+	} else if n, ok := c.match("CH#:SCAle"); ok {
+		if ch, v := s.channel(n), 0.0; ch != nil {
+			if v, ok = s.number(c); ok && v > 0 {
+				ch.scale = v
+			}
+		}
+	} else if n, ok := c.match("CH#:COUPling"); ok {
+		if ch := s.channel(n); ch != nil {
+			ch.coupling = arg
+		}
+	} else if n, ok := c.match("SELect:CH#"); ok {
+		if ch := s.channel(n); ch != nil {
+			ch.on = arg == "ON" || arg == "1"
+		}
+	} else if _, ok := c.match("HORizontal:MAIn:SCAle"); ok {
+		if v, ok := s.number(c); ok && v > 0 {
+			s.horScale = v
+		}
+	} else if _, ok := c.match("HORizontal:MAIn:SCAle?"); ok {
+		return formatTek(s.horScale), true
+	} else if _, ok := c.match("HORizontal:MAIn:POSition"); ok {
+		if v, ok := s.number(c); ok {
+			s.horPos = v
+		}
+	} else if _, ok := c.match("HORizontal:MAIn:POSition?"); ok {
+		return formatTek(s.horPos), true
+	} else if _, ok := c.match("HORizontal:DELay:POSition"); ok {
+	} else if _, ok := c.match("TRIGger:MAIn:EDGE:COUPling"); ok {
+	} else if _, ok := c.match("TRIGger:MAIn:EDGE:SLOpe"); ok {
+		s.trigRising = arg == "RISE"
+	} else if _, ok := c.match("TRIGger:MAIn:EDGE:SOUrce"); ok {
+		if n := s.source(arg); n > 0 {
+			s.trigSource = n
+		}
+	} else if _, ok := c.match("TRIGger:MAIn:HOLDOff:VALue"); ok {
+	} else if _, ok := c.match("TRIGger:MAIn:LEVel"); ok {
+		if v, ok := s.number(c); ok {
+			s.trigLevel = v
+		}
+	} else if _, ok := c.match("TRIGger:MAIn:MODe"); ok {
+		s.trigMode = arg
+	} else if _, ok := c.match("TRIGger:MAIn:FREQuency?"); ok {
+		return formatTek(s.channels[s.trigSource-1].signal.Frequency), true
+	} else if _, ok := c.match("MEASUrement:IMMed:SOUrce"); ok {
+		if n := s.source(arg); n > 0 {
+			s.measSource = n
+		}
+	} else if _, ok := c.match("MEASUrement:IMMed:TYPe"); ok {
+		s.measType = arg
+	} else if _, ok := c.match("MEASUrement:IMMed:VALue?"); ok {
+		return formatTek(s.measure()), true
+	} else if _, ok := c.match("DATa:SOUrce"); ok {
+		if n := s.source(arg); n > 0 {
+			s.dataSource = n
+		}
+	} else if _, ok := c.match("DATa:WIDth"); ok {
+		if v, ok := s.number(c); ok && (v == 1 || v == 2) {
+			s.dataWidth = int(v)
+		}
+	} else if _, ok := c.match("DATa:STARt"); ok {
+		if v, ok := s.number(c); ok {
+			s.dataStart = min(max(int(v), 1), tpsRecordLength)
+		}
+	} else if _, ok := c.match("DATa:STOP"); ok {
+		if v, ok := s.number(c); ok {
+			s.dataStop = min(max(int(v), 1), tpsRecordLength)
+		}
+	} else if _, ok := c.match("DATa:ENCdg"); ok {
+		s.encoding = arg
+	} else if _, ok := c.match("WFMPre:YMUlt?"); ok {
+		return formatTek(s.yMult()), true
+	} else if _, ok := c.match("WFMPre:YOFf?"); ok {
+		return formatTek(s.yOff()), true
+	} else if _, ok := c.match("WFMPre:XINcr?"); ok {
+		return formatTek(s.horScale * 10 / tpsRecordLength), true
+	} else if _, ok := c.match("WFMPre:CH#:XINcr?"); ok {
+		return formatTek(s.horScale * 10 / tpsRecordLength), true
+	} else if _, ok := c.match("WFMPre:NR_Pt?"); ok {
+		return strconv.Itoa(tpsRecordLength), true
+	} else if _, ok := c.match("WFMPre:WFId?"); ok {
+		ch := s.channels[s.dataSource-1]
+		return fmt.Sprintf("\"Ch%d, %s coupling, %s V/div, %s s/div, %d points, Sample mode\"",
+			s.dataSource, ch.coupling, formatTek(ch.scale), formatTek(s.horScale), tpsRecordLength), true
+	} else if _, ok := c.match("CURVe?"); ok {
+		return s.curve(), true
+	} else {
+		s.errors.push(errUndefinedHeader, "Undefined header")
+	}
+	return "", false
+}
+
+// formatTek formats a value like the scope does, f.ex. 4.0E-2
+func formatTek(v float64) string {
+	s := strconv.FormatFloat(v, 'E', -1, 64)
+	mantissa, exponent, _ := strings.Cut(s, "E")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	e, _ := strconv.Atoi(exponent)
+	return fmt.Sprintf("%sE%d", mantissa, e)
+}
+
+// yMult is the volt pr digitizing level for the data source
+func (s *Tps2000) yMult() float64 {
+	m := s.channels[s.dataSource-1].scale / 25
+	if s.dataWidth == 2 {
+		m /= 256
+	}
+	return m
+}
+
+// yOff is the position of the data source in digitizing levels
+func (s *Tps2000) yOff() float64 {
+	off := s.channels[s.dataSource-1].position * 25
+	if s.dataWidth == 2 {
+		off *= 256
+	}
+	return off
+}
+
+// sampleTime returns the time of point k relative to the trigger point,
+// which is in the middle of the record when the horizontal position is 0
+func (s *Tps2000) sampleTime(k int) float64 {
+	return float64(k-tpsRecordLength/2)*s.horScale*10/tpsRecordLength + s.horPos
+}
+
+// curve returns the CURVE? response, a block of samples from the data source
+func (s *Tps2000) curve() string {
+	ch := s.channels[s.dataSource-1]
+	trig := s.channels[s.trigSource-1].signal
+	t0 := trig.crossing(s.trigLevel, s.trigRising)
+	yMult, yOff := s.yMult(), s.yOff()
+	lo, hi := -128.0, 127.0
+	if s.dataWidth == 2 {
+		lo, hi = -32768, 32767
+	}
+	unsigned := strings.HasPrefix(s.encoding, "RP") || strings.HasPrefix(s.encoding, "SRP")
+	var values []string
+	var b []byte
+	for k := s.dataStart - 1; k < s.dataStop; k++ {
+		v := ch.signal.value(s.sampleTime(k) + t0)
+		if ch.coupling == "AC" {
+			v -= ch.signal.Offset
+		} else if ch.coupling == "GND" {
+			v = 0
+		}
+		raw := int(math.Max(lo, math.Min(hi, math.Round(v/yMult+yOff))))
+		if unsigned {
+			raw -= int(lo)
+		}
+		if strings.HasPrefix(s.encoding, "ASC") {
+			values = append(values, strconv.Itoa(raw))
+			continue
+		}
+		if s.dataWidth == 1 {
+			b = append(b, byte(raw))
+		} else if strings.HasPrefix(s.encoding, "SR") {
+			b = append(b, byte(raw), byte(raw>>8))
+		} else {
+			b = append(b, byte(raw>>8), byte(raw))
+		}
+	}
+	if values != nil {
+		return strings.Join(values, ",")
+	}
+	return block(b)
+}
+
+// measure returns the immediate measurement on the measurement source
+func (s *Tps2000) measure() float64 {
+	sig := s.channels[s.measSource-1].signal
+	if strings.HasPrefix(s.measType, "FREQ") || strings.HasPrefix(s.measType, "PERI") {
+		if sig.Shape == Dc || sig.Frequency <= 0 {
+			return tpsInvalid
+		}
+		if strings.HasPrefix(s.measType, "FREQ") {
+			return sig.Frequency
+		}
+		return 1 / sig.Frequency
+	}
+	if strings.HasPrefix(s.measType, "PWI") || strings.HasPrefix(s.measType, "NWI") {
+		if sig.Shape == Dc || sig.Frequency <= 0 {
+			return tpsInvalid
+		}
+		return 0.5 / sig.Frequency
+	}
+	// Other measurements are calculated from one period of the signal
+	const n = 1000
+	period := 1.0
+	if sig.Shape != Dc && sig.Frequency > 0 {
+		period = 1 / sig.Frequency
+	}
+	lo, hi, sum, sumSquare := math.Inf(1), math.Inf(-1), 0.0, 0.0
+	for k := 0; k < n; k++ {
+		v := sig.value(period * float64(k) / n)
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+		sum += v
+		sumSquare += v * v
+	}
+	switch {
+	case strings.HasPrefix(s.measType, "MEAN"):
+		return sum / n
+	case strings.HasPrefix(s.measType, "PK2"):
+		return hi - lo
+	case strings.HasPrefix(s.measType, "CRM"):
+		return math.Sqrt(sumSquare / n)
+	case strings.HasPrefix(s.measType, "MINI"):
+		return lo
+	case strings.HasPrefix(s.measType, "MAXI"):
+		return hi
+	}
+	return tpsInvalid
+}
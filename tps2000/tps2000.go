@@ -2,16 +2,30 @@
 package tps2000
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
-	"sync/atomic"
 	"time"
 
 	"github.com/jkvatne/go-measure/alog"
 	"github.com/jkvatne/go-measure/instr"
 )
 
+// driver registers the supported models, so that instr.Open can find them
+var driver = instr.Driver{Name: "tps2000", Models: []string{"TEKTRONIX,TPS 20*"}, Baudrate: 19200, Eol: instr.Lf}
+
+func init() {
+	driver.New = func(port string) (instr.Instrument, error) {
+		osc, err := New(port)
+		if err != nil {
+			return nil, err
+		}
+		return osc, nil
+	}
+	instr.Register(driver)
+}
+
 // Tps2000 contains local state data for the scope
 type Tps2000 struct {
 	instr.Connection
@@ -23,13 +37,12 @@ type Tps2000 struct {
 	offsets         [4]float64
 	ranges          [4]float64
 	channelCount    int
+	callNo          int
 }
 
 // Declare conformity with Scope interface
 var _ instr.Scope = (*Tps2000)(nil)
 
-var callNo int
-
 // Point is a 2D point, usually containing (Volt, Time) points
 type Point struct {
 	x, y float64
@@ -38,17 +51,27 @@ type Point struct {
 // New is a Oscilloscope instance for the tti supply
 func New(port string) (instr.Scope, error) {
 	if port == "" {
-		port = instr.FindSerialPort("TEKTRONIX", 19200, instr.Lf)
+		var err error
+		if port, err = instr.Find(driver.Name); err != nil {
+			return nil, err
+		}
 	}
-	conn := instr.Connection{Port: port, Baudrate: 19200, Timeout: 750 * time.Millisecond, Eol: instr.Lf}
-	osc := &Tps2000{Connection: conn}
+	osc := &Tps2000{}
+	osc.Port = port
+	osc.Baudrate = 19200
+	osc.Timeout = 750 * time.Millisecond
+	osc.Eol = instr.Lf
+	osc.ErrorQuery = "*ESR?"
+	// The scope needs some time to handle a command before the next one
+	osc.Pacing.Settle = 10 * time.Millisecond
 	err := osc.Open(port)
 	if err != nil {
 		return nil, fmt.Errorf("error opening port, %s", err)
 	}
-	osc.Connection.Name, err = osc.QueryIdn()
-	alog.Info("Connected to oscilloscope %s", osc.Connection.Name)
-	if !strings.HasPrefix(osc.Connection.Name, "TEKTRONIX,TPS 20") {
+	id, err := osc.Identify()
+	alog.Info("Connected to oscilloscope %s", id)
+	if err != nil || !driver.Match(id) {
+		osc.Connection.Close()
 		return nil, fmt.Errorf("port %s has not a Textronix osciloscope", port)
 	}
 	osc.sampleCount = 2500
@@ -94,9 +117,8 @@ func (s *Tps2000) CurveInfo() error {
 	return nil
 }
 
-func (s *Tps2000) opc() string {
-	_ = s.Write("*opc?")
-	return s.ReadString()
+func (s *Tps2000) opc() (string, error) {
+	return s.Ask("*opc?")
 }
 
 // DisableChannel turns the channel off (no longer visible)
@@ -104,30 +126,25 @@ func (s *Tps2000) DisableChannel(ch instr.Chan) {
 	s.enabled[ch] = false
 }
 
-var running int32
-
-func run(start bool) {
-	if start {
-		if atomic.SwapInt32(&running, 1) == 1 {
-			alog.Fatal("GetSamples() was running")
-		}
-	} else {
-		atomic.StoreInt32(&running, 0)
-	}
-}
-
 // GetSamples will return a dataset (points) of 2500 points scaled
 func (s *Tps2000) GetSamples() (data [][]float64, err error) {
-	run(true)
-	defer run(false)
+	return s.GetSamplesContext(context.Background())
+}
+
+// GetSamplesContext is GetSamples that can be cancelled by ctx.
+// The curve transfer is stopped when ctx is done. The connection is locked
+// while reading, so that commands from other goroutines wait until it is done.
+func (s *Tps2000) GetSamplesContext(ctx context.Context) (data [][]float64, err error) {
+	ctx = s.Lock(ctx)
+	defer s.Unlock(ctx)
 
 	// Set binary encoding with lsb first
-	err = s.Write("DATA:WIDTH 1;START 1;STOP %d;ENCDG SRI", s.sampleCount)
+	err = s.WriteContext(ctx, "DATA:WIDTH 1;START 1;STOP %d;ENCDG SRI", s.sampleCount)
 	if err != nil {
 		return nil, err
 	}
 	// Read time (horizontal) scaling
-	resp, err := s.Ask("WFMPRE:CH1:XINCR?")
+	resp, err := s.AskContext(ctx, "WFMPRE:CH1:XINCR?")
 	if err != nil {
 		return nil, err
 	}
@@ -145,38 +162,26 @@ func (s *Tps2000) GetSamples() (data [][]float64, err error) {
 	var yMin []float64
 	for channel := 0; channel < 4; channel++ {
 		if s.enabled[channel] {
-			_ = s.Write("DATA:SOURCE " + chanString[channel])
-			_ = s.Write("CURVE?")
-			s.Timeout = 5 * time.Second
-			b := s.Connection.ReadByte()
-			if b != 35 {
-				return nil, fmt.Errorf("data should start with #1, #2 or #3")
-			}
-			// Get number of digits in length field
-			nd := int(s.Connection.ReadByte())
-			if nd < 48 || nd > 52 {
-				return nil, fmt.Errorf("data should start with #1, #2 or #3")
-			}
-			n := 0
-			for i := 0; i < nd-48; i++ {
-				n = n*10 + int(s.Connection.ReadByte()) - 48
+			err = s.WriteContext(ctx, "DATA:SOURCE "+chanString[channel])
+			if err != nil {
+				return nil, err
 			}
-			if n != s.sampleCount {
-				return nil, fmt.Errorf("wrong length of data")
+			timeout := s.Timeout
+			s.Timeout = 5 * time.Second
+			values, err := s.AskBlockContext(ctx, "CURVE?")
+			s.Timeout = timeout
+			if err != nil {
+				return nil, fmt.Errorf("error reading curve, %w", err)
 			}
-			s.Timeout = time.Second
-			values := make([]byte, n)
-			time.Sleep(time.Second * time.Duration(s.sampleCount*10) / time.Duration(s.Baudrate))
-			actual := s.Connection.Read(values)
-			if actual != s.sampleCount {
+			if len(values) != s.sampleCount {
 				return nil, fmt.Errorf("wrong length of data")
 			}
 			// Read channel scaling
-			yScale, err := s.PollFloat("WFMPRE:YMULT?")
+			yScale, err := s.PollFloatContext(ctx, "WFMPRE:YMULT?")
 			if err != nil {
 				return nil, fmt.Errorf("error reading channel scaling YMULT")
 			}
-			yOffset, err := s.PollFloat("WFMPRE:YOFF?")
+			yOffset, err := s.PollFloatContext(ctx, "WFMPRE:YOFF?")
 			if err != nil {
 				return nil, fmt.Errorf("error reading channel scaling YOFF")
 			}
@@ -190,12 +195,12 @@ func (s *Tps2000) GetSamples() (data [][]float64, err error) {
 			data = append(data, chanData)
 		}
 	}
-	callNo++
+	s.callNo++
 	dataPoints := 0
 	if len(data) > 1 {
 		dataPoints = len(data[1])
 	}
-	alog.Info("GetSamplies() n=%d, %d %d", callNo, len(data), dataPoints)
+	alog.Info("GetSamplies() n=%d, %d %d", s.callNo, len(data), dataPoints)
 	data = append(data, yMax, yMin)
 	return data, nil
 }
@@ -205,21 +210,34 @@ func (s *Tps2000) GetSamples() (data [][]float64, err error) {
 // If Chan=TRIG (0) then the trigger frequency will be returned. This is much more accurate than the
 // frequency determined from a channels waveform
 func (s *Tps2000) Measure(ch instr.Chan, typ string) (float64, error) {
+	return s.MeasureContext(context.Background(), ch, typ)
+}
+
+// MeasureContext is Measure that can be cancelled by ctx
+func (s *Tps2000) MeasureContext(ctx context.Context, ch instr.Chan, typ string) (float64, error) {
 	if (ch < instr.Ch1 || ch > instr.Ch4) && ch != instr.TRIG {
 		return 0.0, fmt.Errorf("%d is illegal channel", ch)
 	}
 	var resp string
+	var err error
 	if ch == instr.TRIG {
-		resp, _ = s.Ask("TRIG:MAI:FREQ?")
+		resp, err = s.AskContext(ctx, "TRIG:MAI:FREQ?")
 	} else {
+		// The source and type must not be changed by others before the value is read
+		ctx = s.Lock(ctx)
+		defer s.Unlock(ctx)
 		s.currentChan = ch
 		s.measurementType = typ
-		time.Sleep(time.Millisecond * 10)
-		_ = s.Write("MEASU:IMM:SOU CH%d", ch)
-		time.Sleep(time.Millisecond * 10)
-		_ = s.Write("MEASU:IMMED:TYPE " + typ)
-		time.Sleep(time.Millisecond * 10)
-		resp, _ = s.Ask("MEASU:IMMED:VALUE?")
+		err = s.WriteContext(ctx, "MEASU:IMM:SOU CH%d", ch)
+		if err == nil {
+			err = s.WriteContext(ctx, "MEASU:IMMED:TYPE "+typ)
+		}
+		if err == nil {
+			resp, err = s.AskContext(ctx, "MEASU:IMMED:VALUE?")
+		}
+	}
+	if err != nil {
+		return 0.0, err
 	}
 	f, err := strconv.ParseFloat(resp, 64)
 	if err != nil {
@@ -231,6 +249,22 @@ func (s *Tps2000) Measure(ch instr.Chan, typ string) (float64, error) {
 	return f, nil
 }
 
+// MeasureReading is Measure returning the value with unit, time and status
+func (s *Tps2000) MeasureReading(ch instr.Chan, typ string) (instr.Reading, error) {
+	return s.MeasureReadingContext(context.Background(), ch, typ)
+}
+
+// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+func (s *Tps2000) MeasureReadingContext(ctx context.Context, ch instr.Chan, typ string) (instr.Reading, error) {
+	v, err := s.MeasureContext(ctx, ch, typ)
+	if err != nil {
+		return instr.Reading{}, err
+	}
+	r := instr.NewReading(v, instr.ScopeUnit(typ), 0)
+	r.Source, r.Chan = s.Name, ch
+	return r, nil
+}
+
 // SetupChannel where
 // rng is the voltage range, or 10xVolt/div. Dvs rng=10V gives +-5V or 1V/div
 // offset is the voltage added to the signal before scaling. 0V is center of screen
@@ -240,23 +274,30 @@ func (s *Tps2000) SetupChannel(ch instr.Chan, rng float64, offs float64, couplin
 	s.ranges[c] = rng
 	s.enabled[c] = true
 	// Offset is given in divisions
-	_ = s.Write("CH%d:POS %0.3g", ch, offs/rng*10.0)
+	cmds := []string{fmt.Sprintf("CH%d:POS %0.3g", ch, offs/rng*10.0)}
 	// scale is the volt pr division setting
-	_ = s.Write("CH%d:SCA %0.3g", ch, rng/10.0)
+	cmds = append(cmds, fmt.Sprintf("CH%d:SCA %0.3g", ch, rng/10.0))
 	// Enable channel
 	if coupling == instr.OFF {
-		err = s.Write("SEL:CH%d OFF", ch)
+		cmds = append(cmds, fmt.Sprintf("SEL:CH%d OFF", ch))
 	} else if coupling == instr.DC {
-		_ = s.Write("CH%d:COUP DC", ch)
-		err = s.Write("SEL:CH%d ON", ch)
+		cmds = append(cmds, fmt.Sprintf("CH%d:COUP DC", ch), fmt.Sprintf("SEL:CH%d ON", ch))
 	} else if coupling == instr.AC {
-		_ = s.Write("CH%d:COUP AC", ch)
-		err = s.Write("SEL:CH%d ON", ch)
+		cmds = append(cmds, fmt.Sprintf("CH%d:COUP AC", ch), fmt.Sprintf("SEL:CH%d ON", ch))
 	} else if coupling == instr.GND {
-		_ = s.Write("CH%d:COUP GND", ch)
-		err = s.Write("SEL:CH%d ON", ch)
+		cmds = append(cmds, fmt.Sprintf("CH%d:COUP GND", ch), fmt.Sprintf("SEL:CH%d ON", ch))
 	}
-	return
+	return s.write(cmds...)
+}
+
+// write sends the commands, stopping at the first error
+func (s *Tps2000) write(cmds ...string) error {
+	for _, cmd := range cmds {
+		if err := s.Write(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetChanInfo ...
@@ -283,20 +324,19 @@ func (s *Tps2000) SetupTime(sampleIntervalSec float64, xPosSec float64, mode ins
 	if nr[0:4] != "1.00" && nr[0:4] != "2.50" && nr[0:4] != "5.00" {
 		return fmt.Errorf("time pr div must be 1/2.5/5")
 	}
+	var err error
 	if mode == instr.MinMax {
 	} else if mode == instr.Average {
-		_ = s.Write("ACQ:MOD AVE")
+		err = s.Write("ACQ:MOD AVE")
 	} else if mode == instr.Sample {
-		_ = s.Write("ACQ:MOD SAM")
+		err = s.Write("ACQ:MOD SAM")
 	} else {
-		_ = s.Write("ACQ:MOD PEAK")
+		err = s.Write("ACQ:MOD PEAK")
 	}
-	err := s.Write("HOR:MAI:SCA " + nr)
 	if err != nil {
 		return err
 	}
-	_ = s.Write("HOR:MAI:POS %0.3g", xPosSec)
-	return nil
+	return s.write("HOR:MAI:SCA "+nr, fmt.Sprintf("HOR:MAI:POS %0.3g", xPosSec))
 }
 
 // GetTime will return horizontal settings
@@ -307,23 +347,39 @@ func (s *Tps2000) GetTime() (sampleIntervalSec float64, xPosSec float64) {
 }
 
 var couplingString = [...]string{"DC", "DC", "AC", "DC", "HFR", "LFR", "NOISE"}
-var slopeString = [...]string{"FALL", "RISE"}
+var slopeString = [...]string{"RISE", "FALL"}
 var chanString = [...]string{"CH1", "CH2", "CH3", "CH4", "EXT", "EXT5", "EXT10", "AC LINE"}
 
+// trigSourceString maps instr.Chan to the trigger source names
+var trigSourceString = map[instr.Chan]string{
+	instr.Ch1: "CH1", instr.Ch2: "CH2", instr.Ch3: "CH3", instr.Ch4: "CH4",
+	instr.EXT: "EXT", instr.EXT5: "EXT5", instr.EXT10: "EXT10", instr.MAINS: "AC LINE",
+}
+
 // SetupTrigger will define scope trigger settings
 func (s *Tps2000) SetupTrigger(sourceChan instr.Chan, coupling instr.Coupling, slope instr.Slope, trigLevel float64, auto bool, xPos float64) error {
-	_ = s.Write("TRIG:MAIN:EDGE:COUP " + couplingString[coupling])
-	_ = s.Write("TRIG:MAIN:EDGE:SLOPE " + slopeString[slope])
-	_ = s.Write("TRIG:MAIN:EDGE:SOURCE " + slopeString[sourceChan])
-	_ = s.Write("TRIG:MAIN:HOLDOFF:VALUE %0.3e", 0.02)
-	_ = s.Write("TRIG:MAIN:LEVEL %0.4e", trigLevel)
+	source, ok := trigSourceString[sourceChan]
+	if !ok {
+		return fmt.Errorf("%d is illegal trigger source", sourceChan)
+	}
+	if coupling < instr.OFF || int(coupling) >= len(couplingString) {
+		return fmt.Errorf("%d is illegal trigger coupling", coupling)
+	}
+	if slope != instr.Rising && slope != instr.Falling {
+		return fmt.Errorf("trigger slope must be rising or falling")
+	}
+	mode := "NORMAL"
 	if auto {
-		_ = s.Write("TRIG:MAIN:MODE AUTO", trigLevel)
-	} else {
-		_ = s.Write("TRIG:MAIN:MODE NORMAL", trigLevel)
+		mode = "AUTO"
 	}
-	err := s.Write("HOR:DELAY:POS %0.4e", xPos)
-	return err
+	return s.write(
+		"TRIG:MAIN:EDGE:COUP "+couplingString[coupling],
+		"TRIG:MAIN:EDGE:SLOPE "+slopeString[slope],
+		"TRIG:MAIN:EDGE:SOURCE "+source,
+		fmt.Sprintf("TRIG:MAIN:HOLDOFF:VALUE %0.3e", 0.02),
+		fmt.Sprintf("TRIG:MAIN:LEVEL %0.4e", trigLevel),
+		"TRIG:MAIN:MODE "+mode,
+		fmt.Sprintf("HOR:DELAY:POS %0.4e", xPos))
 }
 
 // ChannelCount is the maximum number of channels for this instrument
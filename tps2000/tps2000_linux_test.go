@@ -0,0 +1,59 @@
+package tps2000_test
+
+import (
+	"testing"
+
+	"github.com/jkvatne/go-measure/instr"
+	"github.com/jkvatne/go-measure/sim"
+	"github.com/jkvatne/go-measure/tps2000"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSim runs the driver against the simulated scope on a pseudo terminal,
+// with the probe compensation signal on channel 1 and a sine on channel 2
+func TestSim(t *testing.T) {
+	s := sim.NewTps2000()
+	s.SetSignal(2, sim.Signal{Shape: sim.Sine, Frequency: 500, Amplitude: 1.0})
+	port, err := sim.OpenSerial(s)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer port.Close()
+	o, err := tps2000.New(port.Port())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer o.Close()
+	assert.NoError(t, o.SetupChannel(instr.Ch1, 10, -4.0, instr.DC))
+	assert.NoError(t, o.SetupChannel(instr.Ch2, 4, 0.0, instr.DC))
+	assert.NoError(t, o.SetupTime(1e-3/250, 0.0, instr.Sample, 2500))
+	assert.NoError(t, o.SetupTrigger(instr.Ch1, instr.DC, instr.Rising, 2.5, false, 0.0))
+
+	f, err := o.Measure(instr.TRIG, "FREQ")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, f)
+	f, err = o.Measure(instr.Ch1, "MEAN")
+	assert.NoError(t, err)
+	assert.InDelta(t, 2.5, f, 0.01)
+	f, err = o.Measure(instr.Ch1, "CRMS")
+	assert.NoError(t, err)
+	assert.InDelta(t, 3.54, f, 0.01)
+	f, err = o.Measure(instr.Ch2, "PK2PK")
+	assert.NoError(t, err)
+	assert.InDelta(t, 2.0, f, 0.01)
+
+	data, err := o.GetSamples()
+	assert.NoError(t, err)
+	// Time, channel 1, channel 2, max and min
+	if !assert.Equal(t, 5, len(data)) {
+		return
+	}
+	assert.Equal(t, 2500, len(data[1]))
+	assert.InDelta(t, 4.0e-6, data[0][1], 1e-12)
+	// The trigger point is in the middle, where channel 1 goes high
+	assert.InDelta(t, 0.0, data[1][1249], 0.05)
+	assert.InDelta(t, 5.0, data[1][1250], 0.05)
+	// Channel 2 is at its maximum a quarter period (0.5ms) later
+	assert.InDelta(t, 1.0, data[2][1250+125], 0.02)
+}
@@ -122,3 +122,31 @@ func TestSetupTime(t *testing.T) {
 		o.Close()
 	}
 }
+
+// TestReplay runs the driver against a transcript recorded from the simulator, so no scope is needed
+func TestReplay(t *testing.T) {
+	o, err := tps2000.New("replay://testdata/tps2000.txt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, o.SetupChannel(instr.Ch1, 10, -4.0, instr.DC))
+	assert.NoError(t, o.SetupTime(1e-3/250, 0.0, instr.MinMax, 50))
+	assert.NoError(t, o.SetupTrigger(instr.Ch1, instr.DC, instr.Rising, 2.5, false, 0.0))
+	f, err := o.Measure(instr.TRIG, "FREQ")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, f)
+	f, err = o.Measure(instr.Ch1, "MEAN")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+	data, err := o.GetSamples()
+	assert.NoError(t, err)
+	// Time, channel 1, max and min
+	if assert.Equal(t, 4, len(data)) {
+		assert.Equal(t, 50, len(data[1]))
+		assert.InDelta(t, 4.0e-6, data[0][1], 1e-12)
+		// The first 200us of the probe compensation signal is high
+		assert.InDelta(t, 5.0, data[1][0], 1e-9)
+		assert.InDelta(t, 5.0, data[1][49], 1e-9)
+	}
+	o.Close()
+}
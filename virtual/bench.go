@@ -0,0 +1,201 @@
+// Package virtual is a virtual test bench, with a power supply, multimeters and an
+// oscilloscope connected to a simple circuit model. The instruments implement the
+// instr.Psu, instr.Dmm and instr.Scope interfaces, so that test sequences can be
+// developed and validated before the hardware is available.
+//
+// A bench is created with the number of supply channels, and a Network is connected
+// to each channel. Multimeters and scope channels are then connected to a Point on
+// a supply channel:
+//
+//	b := virtual.NewBench(2)
+//	b.Connect(instr.Ch1, virtual.RC(1000, 100e-6))
+//	dmm := b.Dmm(instr.Ch1, virtual.Load)
+//	psu := b.Psu()
+package virtual
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Point is where an instrument is connected in the circuit of a supply channel
+type Point int
+
+const (
+	// Supply is the supply output terminals
+	Supply Point = iota
+	// Load is the load resistance and capacitor, after the series resistance
+	Load
+)
+
+// historyLength is how long the settings are kept, so that the scope can show the past
+const historyLength = 10 * time.Second
+
+// checkpoint is the state when settings were changed
+type checkpoint struct {
+	state
+	set settings
+}
+
+// channel is the circuit on one supply channel
+type channel struct {
+	history []checkpoint // The last checkpoint has the current settings
+}
+
+// Bench is the circuit model shared by the virtual instruments
+type Bench struct {
+	mutex    sync.Mutex
+	clock    func() time.Time
+	start    time.Time
+	rand     *rand.Rand
+	channels []*channel
+	psu      *Psu
+}
+
+// NewBench returns a bench with a supply having the given number of channels.
+// All outputs are off and open.
+func NewBench(channels int) *Bench {
+	b := &Bench{clock: time.Now, rand: rand.New(rand.NewSource(1))}
+	b.start = b.clock()
+	for k := 0; k < channels; k++ {
+		b.channels = append(b.channels, &channel{history: []checkpoint{{}}})
+	}
+	b.psu = &Psu{bench: b, MaxVoltage: 30, MaxCurrent: 5}
+	return b
+}
+
+// SetClock replaces the time source, so that tests can control the time.
+// It should be called before the instruments are used.
+func (b *Bench) SetClock(now func() time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.clock = now
+	b.start = now()
+}
+
+// Seed sets the seed for the noise generator. The default seed is 1.
+func (b *Bench) Seed(seed int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.rand = rand.New(rand.NewSource(seed))
+}
+
+// Connect connects a network to the supply channel ch
+func (b *Bench) Connect(ch instr.Chan, network Network) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.change(ch, func(set *settings) { set.network = network })
+}
+
+// Psu returns the power supply
+func (b *Bench) Psu() *Psu {
+	return b.psu
+}
+
+// Dmm returns a new multimeter connected to point on supply channel ch
+func (b *Bench) Dmm(ch instr.Chan, point Point) *Dmm {
+	return &Dmm{bench: b, ch: ch, point: point}
+}
+
+// Scope returns a new oscilloscope with 4 unconnected channels
+func (b *Bench) Scope() *Scope {
+	return newScope(b)
+}
+
+// now returns the time since the bench was created
+func (b *Bench) now() time.Duration {
+	return b.clock().Sub(b.start)
+}
+
+// channel returns the circuit for supply channel ch
+func (b *Bench) channel(ch instr.Chan) (*channel, error) {
+	if ch < instr.Ch1 || int(ch) > len(b.channels) {
+		return nil, fmt.Errorf("channel %d illegal", ch)
+	}
+	return b.channels[ch-instr.Ch1], nil
+}
+
+// change modifies the settings of channel ch from now on
+func (b *Bench) change(ch instr.Chan, modify func(set *settings)) error {
+	c, err := b.channel(ch)
+	if err != nil {
+		return err
+	}
+	now := b.now()
+	last := c.history[len(c.history)-1]
+	last.advance(last.set, now)
+	modify(&last.set)
+	c.history = append(c.history, last)
+	// Remove checkpoints that are no longer needed to show the history
+	k := sort.Search(len(c.history), func(k int) bool { return c.history[k].t > now-historyLength })
+	if k > 1 {
+		c.history = c.history[k-1:]
+	}
+	return nil
+}
+
+// settings returns the current settings of channel ch
+func (b *Bench) settings(ch instr.Chan) (settings, error) {
+	c, err := b.channel(ch)
+	if err != nil {
+		return settings{}, err
+	}
+	return c.history[len(c.history)-1].set, nil
+}
+
+// sampler calculates the state of a channel at increasing times
+type sampler struct {
+	history []checkpoint
+	k       int // Index of the checkpoint in use
+	state
+	set settings
+}
+
+// sampler returns a sampler for channel ch, or nil if the channel does not exist
+func (b *Bench) sampler(ch instr.Chan) *sampler {
+	c, err := b.channel(ch)
+	if err != nil {
+		return nil
+	}
+	return &sampler{history: c.history, k: -1}
+}
+
+// at returns the state at time t, which must not be earlier than the previous call.
+// Times before the start of the history return the first state kept.
+func (s *sampler) at(t time.Duration) (state, settings) {
+	k := sort.Search(len(s.history), func(k int) bool { return s.history[k].t > t }) - 1
+	if k < 0 {
+		return s.history[0].state, s.history[0].set
+	}
+	if k != s.k {
+		s.k = k
+		s.state, s.set = s.history[k].state, s.history[k].set
+	}
+	s.advance(s.set, t)
+	return s.state, s.set
+}
+
+// value returns the voltage at point, or 0 if the sampler is nil
+func (s *sampler) value(t time.Duration, point Point) float64 {
+	if s == nil {
+		return 0
+	}
+	st, set := s.at(t)
+	if point == Supply {
+		return st.terminal(set)
+	}
+	return st.vc
+}
+
+// noise returns a normally distributed value with standard deviation sigma
+func (b *Bench) noise(sigma float64) float64 {
+	if sigma == 0 {
+		return 0
+	}
+	return b.rand.NormFloat64() * sigma
+}
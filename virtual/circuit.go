@@ -0,0 +1,188 @@
+package virtual
+
+// The circuit on each supply channel is a current limited voltage source with
+// a slew rate limit, feeding a load resistance and a capacitor in parallel
+// through a series resistance:
+//
+//	source --- Series ---+--------+
+//	                     |        |
+//	                 Resistance Capacitance
+//	                     |        |
+//	ground --------------+--------+
+//
+// The supply can not sink current, so a capacitor charged above the source
+// voltage is discharged through the load resistance only.
+
+import (
+	"math"
+	"time"
+)
+
+// Network is the circuit connected to a supply channel. The zero value is an open output.
+type Network struct {
+	Series      float64 // Ohm, 0 for a direct connection
+	Resistance  float64 // Load resistance in ohm, 0 for no load
+	Capacitance float64 // Farad, 0 for a resistive load
+}
+
+// Resistor returns a network with a resistive load
+func Resistor(ohm float64) Network {
+	return Network{Resistance: ohm}
+}
+
+// RC returns a network charging the capacitor c through the resistor r
+func RC(r, c float64) Network {
+	return Network{Series: r, Capacitance: c}
+}
+
+// load returns the load resistance, +Inf for no load
+func (n Network) load() float64 {
+	if n.Resistance <= 0 {
+		return math.Inf(1)
+	}
+	return n.Resistance
+}
+
+// settings are the supply settings and network for one channel. They are
+// constant between checkpoints.
+type settings struct {
+	voltage float64 // Voltage setpoint
+	current float64 // Current limit
+	on      bool
+	slew    float64 // Volt pr second, 0 for no limit
+	network Network
+}
+
+// state is the state of the circuit at a given time
+type state struct {
+	t      time.Duration // Time since the bench was created
+	source float64       // Voltage of the source, before current limiting
+	vc     float64       // Voltage over the load
+	i      float64       // Current from the supply
+}
+
+// minStep is the shortest time step used in the simulation
+const minStep = time.Microsecond
+
+// target is the voltage the source is moving towards
+func (set settings) target() float64 {
+	if set.on {
+		return set.voltage
+	}
+	return 0
+}
+
+// terminal returns the voltage on the supply terminals
+func (s state) terminal(set settings) float64 {
+	if !set.on {
+		return s.vc
+	}
+	return s.vc + s.i*set.network.Series
+}
+
+// advance steps the simulation forward to time to
+func (s *state) advance(set settings, to time.Duration) {
+	// A step of zero length applies new settings at once
+	s.step(set, 0)
+	for s.t < to {
+		dt := to - s.t
+		if limit := s.maxStep(set); limit > 0 && dt > limit {
+			dt = limit
+		}
+		s.step(set, dt.Seconds())
+		s.t += dt
+	}
+}
+
+// maxStep returns the longest step giving a correct result, or 0 if there is no limit.
+// Steps are only limited while the source is slewing or the current is limited,
+// since the solution is exact otherwise.
+func (s *state) maxStep(set settings) time.Duration {
+	var limit time.Duration
+	if diff := math.Abs(set.target() - s.source); set.slew > 0 && diff > 0 {
+		limit = max(min(time.Duration(diff/set.slew*float64(time.Second)), time.Millisecond), minStep)
+	}
+	c := set.network.Capacitance
+	if set.on && c > 0 && set.current > 0 && s.i >= set.current {
+		// Time until the capacitor has charged to where the current limit is released
+		release := s.source - set.current*set.network.Series
+		step := max(time.Duration((release-s.vc)*c/set.current/2*float64(time.Second)), minStep)
+		if limit == 0 || step < limit {
+			limit = step
+		}
+	}
+	return limit
+}
+
+// step moves the circuit dt seconds forward
+func (s *state) step(set settings, dt float64) {
+	target := set.target()
+	if set.slew > 0 {
+		d := set.slew * dt
+		s.source = math.Max(math.Min(target, s.source+d), s.source-d)
+	} else {
+		s.source = target
+	}
+	n := set.network
+	rs, rl, c := n.Series, n.load(), n.Capacitance
+	vs, limit := s.source, set.current
+	if !set.on {
+		// The output is open, and the capacitor discharges through the load
+		if c > 0 {
+			s.vc *= math.Exp(-dt / (rl * c))
+		} else {
+			s.vc = 0
+		}
+		s.i = 0
+		return
+	}
+	if c <= 0 {
+		s.i = math.Min(vs/(rs+rl), limit)
+		if math.IsInf(rl, 1) {
+			s.vc = vs
+		} else {
+			s.vc = s.i * rl
+		}
+		return
+	}
+	// The current the supply would deliver without limiting
+	i0 := math.Inf(1)
+	if rs > 0 {
+		i0 = (vs - s.vc) / rs
+	} else if vs <= s.vc {
+		i0 = math.Inf(-1)
+	}
+	vc0 := s.vc
+	switch {
+	case i0 >= limit:
+		// Constant current, until the capacitor voltage reaches the release point
+		if math.IsInf(rl, 1) {
+			s.vc += limit * dt / c
+		} else {
+			vinf := limit * rl
+			s.vc = vinf + (s.vc-vinf)*math.Exp(-dt/(rl*c))
+		}
+		s.vc = math.Min(s.vc, vs-limit*rs)
+	case i0 < 0:
+		// The supply can not sink current
+		s.vc = math.Max(s.vc*math.Exp(-dt/(rl*c)), vs)
+	case rs == 0:
+		s.vc = vs
+	default:
+		rp, vinf := rs, vs
+		if !math.IsInf(rl, 1) {
+			rp = rs * rl / (rs + rl)
+			vinf = vs * rl / (rs + rl)
+		}
+		s.vc = vinf + (s.vc-vinf)*math.Exp(-dt/(rp*c))
+	}
+	if rs > 0 {
+		s.i = math.Max(0, math.Min((vs-s.vc)/rs, limit))
+	} else if s.vc < vs {
+		s.i = limit
+	} else if dt > 0 {
+		s.i = math.Max(0, s.vc/rl+c*(s.vc-vc0)/dt)
+	} else {
+		s.i = s.vc / rl
+	}
+}
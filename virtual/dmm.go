@@ -0,0 +1,135 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Check if Dmm satisfies the Dmm interface
+var _ instr.Dmm = &Dmm{}
+
+// Dmm is a virtual multimeter. It measures the voltage at its point, the current
+// from the supply channel, or the resistance of the network seen from the point.
+type Dmm struct {
+	bench  *Bench
+	ch     instr.Chan
+	point  Point
+	setup  instr.Setup
+	rng    float64
+	Noise  float64 // Standard deviation of the measurements
+	Offset float64 // Error added to the measurements
+}
+
+// Names returned by QueryIdn, used as the source of readings
+const (
+	dmmName   = "GO-MEASURE,VIRTUAL DMM,0,1.0"
+	psuName   = "GO-MEASURE,VIRTUAL PSU,0,1.0"
+	scopeName = "GO-MEASURE,VIRTUAL SCOPE,0,1.0"
+)
+
+// overload is returned when the value is outside the range, like on the Fluke
+const overload = instr.Overload
+
+// QueryIdn returns the name of the virtual multimeter
+func (d *Dmm) QueryIdn() (string, error) {
+	return dmmName, nil
+}
+
+// Configure will select unit to measure and range. VoltDc, CurrentDc and Ohm are supported.
+// A fixed range is used as given by Max or Range, without a range table.
+func (d *Dmm) Configure(s instr.Setup) error {
+	if s.Chan == 0 {
+		s.Chan = 1
+	}
+	if s.Chan != 1 {
+		return fmt.Errorf("%d is illegal channel", s.Chan)
+	}
+	if s.Unit != instr.VoltDc && s.Unit != instr.CurrentDc && s.Unit != instr.Ohm {
+		return fmt.Errorf("%s is not supported", s.Unit)
+	}
+	if s.Sensor != instr.DefaultSensor {
+		return fmt.Errorf("%s is only used for temperature", s.Sensor)
+	}
+	rng := s.Max
+	if rng < 0 {
+		return fmt.Errorf("illegal range %g", rng)
+	}
+	if r := strings.ToUpper(s.Range); r != "" && r != "AUTO" && r != "DEF" {
+		v, err := strconv.ParseFloat(s.Range, 64)
+		if err != nil || v <= 0 || rng > 0 {
+			return fmt.Errorf("illegal range %s", s.Range)
+		}
+		rng = v
+	}
+	if s.Autorange && rng > 0 {
+		return fmt.Errorf("autorange and a fixed range both given")
+	}
+	d.rng = rng
+	d.setup = s
+	return nil
+}
+
+// Measure will do a measurement according to Configure(setup)
+func (d *Dmm) Measure() (float64, error) {
+	return d.MeasureContext(context.Background())
+}
+
+// MeasureContext is Measure, but returns at once if ctx is done
+func (d *Dmm) MeasureContext(ctx context.Context) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if d.setup.Unit == instr.Illegal {
+		return 0.0, fmt.Errorf("undefined setup")
+	}
+	b := d.bench
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := b.sampler(d.ch)
+	if s == nil {
+		return 0, fmt.Errorf("channel %d illegal", d.ch)
+	}
+	st, set := s.at(b.now())
+	var v float64
+	switch d.setup.Unit {
+	case instr.VoltDc:
+		v = s.value(st.t, d.point)
+	case instr.CurrentDc:
+		v = st.i
+	case instr.Ohm:
+		v = set.network.load()
+		if d.point == Supply {
+			v += set.network.Series
+		}
+	}
+	v += d.Offset + b.noise(d.Noise)
+	if math.IsInf(v, 0) || (d.rng > 0 && math.Abs(v) > d.rng*1.2) {
+		return overload, nil
+	}
+	return v, nil
+}
+
+// MeasureReading will do a measurement, returning the value with unit, range and time
+func (d *Dmm) MeasureReading() (instr.Reading, error) {
+	return d.MeasureReadingContext(context.Background())
+}
+
+// MeasureReadingContext is MeasureReading, but returns at once if ctx is done
+func (d *Dmm) MeasureReadingContext(ctx context.Context) (instr.Reading, error) {
+	v, err := d.MeasureContext(ctx)
+	if err != nil {
+		return instr.Reading{}, err
+	}
+	r := instr.NewReading(v, d.setup.Unit, d.rng)
+	r.Source, r.Chan = dmmName, d.setup.Chan
+	return r, nil
+}
+
+// Close does nothing
+func (d *Dmm) Close() {
+}
@@ -0,0 +1,112 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Check if Psu satisfies the Psu interface
+var _ instr.Psu = &Psu{}
+
+// Psu is the virtual power supply. The settings should be changed before use.
+type Psu struct {
+	bench      *Bench
+	Slew       float64 // Maximum rate of change of the output voltage in V/s, 0 for no limit
+	Noise      float64 // Standard deviation of the read back voltage and current
+	Offset     float64 // Error in the read back voltage
+	MaxVoltage float64 // Highest voltage setpoint accepted
+	MaxCurrent float64 // Highest current limit accepted
+}
+
+// QueryIdn returns the name of the virtual supply
+func (p *Psu) QueryIdn() (string, error) {
+	return psuName, nil
+}
+
+// ChannelCount returns the number of channels
+func (p *Psu) ChannelCount() int {
+	return len(p.bench.channels)
+}
+
+// SetOutput will set output voltage and current limit, and turn the channel on
+func (p *Psu) SetOutput(ch instr.Chan, voltage float64, current float64) error {
+	return p.SetOutputContext(context.Background(), ch, voltage, current)
+}
+
+// SetOutputContext is SetOutput, but returns at once if ctx is done
+func (p *Psu) SetOutputContext(ctx context.Context, ch instr.Chan, voltage float64, current float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if voltage < 0 || voltage > p.MaxVoltage {
+		return fmt.Errorf("voltage %0.3f is outside 0 to %0.3fV", voltage, p.MaxVoltage)
+	}
+	if current < 0 || current > p.MaxCurrent {
+		return fmt.Errorf("current %0.3f is outside 0 to %0.3fA", current, p.MaxCurrent)
+	}
+	p.bench.mutex.Lock()
+	defer p.bench.mutex.Unlock()
+	return p.bench.change(ch, func(set *settings) {
+		set.voltage, set.current, set.on, set.slew = voltage, current, true, p.Slew
+	})
+}
+
+// Disable will turn off the given output channel
+func (p *Psu) Disable(ch instr.Chan) {
+	p.bench.mutex.Lock()
+	defer p.bench.mutex.Unlock()
+	_ = p.bench.change(ch, func(set *settings) { set.on = false })
+}
+
+// GetOutput will return the actual output voltage and current from the channel
+func (p *Psu) GetOutput(ch instr.Chan) (float64, float64, error) {
+	return p.GetOutputContext(context.Background(), ch)
+}
+
+// GetOutputContext is GetOutput, but returns at once if ctx is done
+func (p *Psu) GetOutputContext(ctx context.Context, ch instr.Chan) (float64, float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	b := p.bench
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := b.sampler(ch)
+	if s == nil {
+		return 0, 0, fmt.Errorf("channel %d illegal", ch)
+	}
+	st, set := s.at(b.now())
+	return st.terminal(set) + p.Offset + b.noise(p.Noise), st.i + b.noise(p.Noise), nil
+}
+
+// GetOutputReading will return the output voltage and current as readings
+func (p *Psu) GetOutputReading(ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	return p.GetOutputReadingContext(context.Background(), ch)
+}
+
+// GetOutputReadingContext is GetOutputReading that can be cancelled by ctx
+func (p *Psu) GetOutputReadingContext(ctx context.Context, ch instr.Chan) (instr.Reading, instr.Reading, error) {
+	voltage, current, err := p.GetOutputContext(ctx, ch)
+	if err != nil {
+		return instr.Reading{}, instr.Reading{}, err
+	}
+	v, i := instr.OutputReadings(psuName, ch, voltage, current)
+	return v, i, nil
+}
+
+// GetSetpoint will return the setpoint voltage and current from the channel
+func (p *Psu) GetSetpoint(ch instr.Chan) (float64, float64, error) {
+	p.bench.mutex.Lock()
+	defer p.bench.mutex.Unlock()
+	set, err := p.bench.settings(ch)
+	return set.voltage, set.current, err
+}
+
+// Close will turn off all outputs
+func (p *Psu) Close() {
+	for ch := instr.Ch1; int(ch) <= p.ChannelCount(); ch++ {
+		p.Disable(ch)
+	}
+}
@@ -0,0 +1,330 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jkvatne/go-measure/instr"
+)
+
+// Check if Scope satisfies the Scope interface
+var _ instr.Scope = &Scope{}
+
+// probe is the connection of a scope channel to the circuit
+type probe struct {
+	connected bool
+	ch        instr.Chan
+	point     Point
+}
+
+// Scope is a virtual 4 channel oscilloscope. The record is calculated from the circuit
+// model when GetSamples is called. It is centered on the first trigger found from half
+// a record before the call, and may include the time after the call, as if the
+// settings are not changed. In auto mode, the record ends at the call if there is no trigger.
+type Scope struct {
+	bench          *Bench
+	probes         [4]probe
+	enabled        [4]bool
+	ranges         [4]float64
+	offsets        [4]float64
+	coupling       [4]instr.Coupling
+	sampleInterval float64
+	xPos           float64
+	sampleCount    int
+	trigSource     instr.Chan
+	trigSlope      instr.Slope
+	trigLevel      float64
+	trigAuto       bool
+	trigPos        float64
+	Noise          float64 // Standard deviation of the samples
+}
+
+// maxTriggerWait is how far after the call a trigger is searched for
+const maxTriggerWait = time.Second
+
+func newScope(b *Bench) *Scope {
+	s := &Scope{bench: b, sampleInterval: 1e-3 / 250, sampleCount: 2500, trigSource: instr.Ch1, trigAuto: true}
+	for k := range s.ranges {
+		s.ranges[k] = 10
+	}
+	return s
+}
+
+// Connect connects scope channel ch to point on the supply channel psuCh
+func (s *Scope) Connect(ch instr.Chan, psuCh instr.Chan, point Point) error {
+	if ch < instr.Ch1 || ch > instr.Ch4 {
+		return fmt.Errorf("%d is illegal channel", ch)
+	}
+	if _, err := s.bench.channel(psuCh); err != nil {
+		return err
+	}
+	s.probes[ch-instr.Ch1] = probe{connected: true, ch: psuCh, point: point}
+	return nil
+}
+
+// QueryIdn returns the name of the virtual scope
+func (s *Scope) QueryIdn() (string, error) {
+	return scopeName, nil
+}
+
+// ChannelCount is the number of channels
+func (s *Scope) ChannelCount() int {
+	return len(s.probes)
+}
+
+// Close does nothing
+func (s *Scope) Close() {
+}
+
+// DisableChannel turns the channel off
+func (s *Scope) DisableChannel(ch instr.Chan) {
+	if ch >= instr.Ch1 && ch <= instr.Ch4 {
+		s.enabled[ch-instr.Ch1] = false
+	}
+}
+
+// SetupChannel where rng is the voltage range, or 10xVolt/div, and offset
+// is added to the signal before scaling. 0V is center of screen.
+func (s *Scope) SetupChannel(ch instr.Chan, rng float64, offset float64, coupling instr.Coupling) error {
+	if ch < instr.Ch1 || ch > instr.Ch4 {
+		return fmt.Errorf("%d is illegal channel", ch)
+	}
+	c := ch - instr.Ch1
+	if coupling == instr.OFF {
+		s.enabled[c] = false
+		return nil
+	}
+	if rng <= 0 {
+		return fmt.Errorf("range must be positive")
+	}
+	s.enabled[c], s.ranges[c], s.offsets[c], s.coupling[c] = true, rng, offset, coupling
+	return nil
+}
+
+// GetChanInfo returns the volt/div of the enabled channels
+func (s *Scope) GetChanInfo() (info []string) {
+	for ch := 0; ch < len(s.enabled); ch++ {
+		if s.enabled[ch] {
+			info = append(info, fmt.Sprintf("Ch%d %s/div ", ch+1, instr.VoltToStr(s.ranges[ch]/10)))
+		}
+	}
+	return info
+}
+
+// SetupTime will set the sample interval, horizontal position and number of samples
+func (s *Scope) SetupTime(sampleInterval float64, xPos float64, mode instr.SampleMode, sampleCount int) error {
+	if sampleInterval <= 0 {
+		return fmt.Errorf("sample interval must be positive")
+	}
+	if sampleCount < 2 {
+		return fmt.Errorf("sample count must be at least 2")
+	}
+	s.sampleInterval, s.xPos, s.sampleCount = sampleInterval, xPos, sampleCount
+	return nil
+}
+
+// GetTime will return horizontal settings
+func (s *Scope) GetTime() (sampleIntervalSec float64, xPosSec float64) {
+	return s.sampleInterval, s.xPos
+}
+
+// SetupTrigger will define the trigger. The source must be a scope channel.
+func (s *Scope) SetupTrigger(source instr.Chan, coupling instr.Coupling, slope instr.Slope, level float64, auto bool, xPos float64) error {
+	if source < instr.Ch1 || source > instr.Ch4 {
+		return fmt.Errorf("%d is illegal trigger source", source)
+	}
+	if slope != instr.Rising && slope != instr.Falling && slope != instr.Either {
+		return fmt.Errorf("illegal trigger slope")
+	}
+	s.trigSource, s.trigSlope, s.trigLevel, s.trigAuto, s.trigPos = source, slope, level, auto, xPos
+	return nil
+}
+
+// duration converts seconds to a time.Duration
+func duration(sec float64) time.Duration {
+	return time.Duration(sec * float64(time.Second))
+}
+
+// sampler returns a sampler for scope channel ch, or nil if it is not connected
+func (s *Scope) sampler(ch int) *sampler {
+	if !s.probes[ch].connected {
+		return nil
+	}
+	return s.bench.sampler(s.probes[ch].ch)
+}
+
+// start returns the time of the first sample in the record
+func (s *Scope) start(ctx context.Context) (time.Duration, error) {
+	now := s.bench.now()
+	dt := duration(s.sampleInterval)
+	length := dt * time.Duration(s.sampleCount)
+	src := s.trigSource - instr.Ch1
+	if trig := s.sampler(int(src)); trig != nil {
+		from := max(now-length/2, 0)
+		point := s.probes[src].point
+		prev := trig.value(from, point)
+		for t, k := from+dt, 1; t < now+max(maxTriggerWait, length); t, k = t+dt, k+1 {
+			if k%1000 == 0 {
+				if err := ctx.Err(); err != nil {
+					return 0, err
+				}
+			}
+			v := trig.value(t, point)
+			rising := prev < s.trigLevel && v >= s.trigLevel
+			falling := prev > s.trigLevel && v <= s.trigLevel
+			if (rising && s.trigSlope != instr.Falling) || (falling && s.trigSlope != instr.Rising) {
+				return t - length/2 + duration(s.xPos+s.trigPos), nil
+			}
+			prev = v
+		}
+	}
+	if !s.trigAuto {
+		return 0, fmt.Errorf("no trigger")
+	}
+	return max(now-length, 0), nil
+}
+
+// record returns the samples for scope channel ch, starting at start
+func (s *Scope) record(ch int, start time.Duration) []float64 {
+	data := make([]float64, s.sampleCount)
+	smp := s.sampler(ch)
+	dt := duration(s.sampleInterval)
+	sum := 0.0
+	for k := range data {
+		data[k] = smp.value(start+time.Duration(k)*dt, s.probes[ch].point) + s.bench.noise(s.Noise)
+		sum += data[k]
+	}
+	mean := sum / float64(len(data))
+	yMax := s.ranges[ch]/2 - s.offsets[ch]
+	yMin := -s.ranges[ch]/2 - s.offsets[ch]
+	for k := range data {
+		switch s.coupling[ch] {
+		case instr.AC:
+			data[k] -= mean
+		case instr.GND:
+			data[k] = 0
+		}
+		data[k] = math.Max(yMin, math.Min(yMax, data[k]))
+	}
+	return data
+}
+
+// GetSamples will return the time, the enabled channels, and the max and min of each channel
+func (s *Scope) GetSamples() ([][]float64, error) {
+	return s.GetSamplesContext(context.Background())
+}
+
+// GetSamplesContext is GetSamples that can be cancelled by ctx
+func (s *Scope) GetSamplesContext(ctx context.Context) (data [][]float64, err error) {
+	s.bench.mutex.Lock()
+	defer s.bench.mutex.Unlock()
+	start, err := s.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	timeData := make([]float64, s.sampleCount)
+	for k := range timeData {
+		timeData[k] = float64(k) * s.sampleInterval
+	}
+	data = append(data, timeData)
+	var yMax, yMin []float64
+	for ch := range s.enabled {
+		if s.enabled[ch] {
+			data = append(data, s.record(ch, start))
+			yMax = append(yMax, s.ranges[ch]/2-s.offsets[ch])
+			yMin = append(yMin, -s.ranges[ch]/2-s.offsets[ch])
+		}
+	}
+	return append(data, yMax, yMin), nil
+}
+
+// Measure and return value as float64. typ is one of FREQuency, PERIod, MEAN, PK2pk,
+// CRMs, MINImum or MAXImum. If ch is TRIG, the frequency of the trigger source is returned.
+func (s *Scope) Measure(ch instr.Chan, typ string) (float64, error) {
+	return s.MeasureContext(context.Background(), ch, typ)
+}
+
+// MeasureContext is Measure that can be cancelled by ctx
+func (s *Scope) MeasureContext(ctx context.Context, ch instr.Chan, typ string) (float64, error) {
+	if ch == instr.TRIG {
+		ch, typ = s.trigSource, "FREQ"
+	}
+	if ch < instr.Ch1 || ch > instr.Ch4 {
+		return 0.0, fmt.Errorf("%d is illegal channel", ch)
+	}
+	s.bench.mutex.Lock()
+	defer s.bench.mutex.Unlock()
+	start, err := s.start(ctx)
+	if err != nil {
+		return 0.0, err
+	}
+	data := s.record(int(ch-instr.Ch1), start)
+	lo, hi, sum, sumSquare := math.Inf(1), math.Inf(-1), 0.0, 0.0
+	for _, v := range data {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+		sum += v
+		sumSquare += v * v
+	}
+	n := float64(len(data))
+	typ = strings.ToUpper(typ)
+	switch {
+	case strings.HasPrefix(typ, "FREQ"), strings.HasPrefix(typ, "PERI"):
+		period := s.period(data, (lo+hi)/2)
+		if period == 0 {
+			return overload, nil
+		}
+		if strings.HasPrefix(typ, "FREQ") {
+			return 1 / period, nil
+		}
+		return period, nil
+	case strings.HasPrefix(typ, "MEAN"):
+		return sum / n, nil
+	case strings.HasPrefix(typ, "PK2"):
+		return hi - lo, nil
+	case strings.HasPrefix(typ, "CRM"):
+		return math.Sqrt(sumSquare / n), nil
+	case strings.HasPrefix(typ, "MINI"):
+		return lo, nil
+	case strings.HasPrefix(typ, "MAXI"):
+		return hi, nil
+	}
+	return 0.0, fmt.Errorf("unknown measurement %s", typ)
+}
+
+// MeasureReading is Measure returning the value with unit, time and status
+func (s *Scope) MeasureReading(ch instr.Chan, typ string) (instr.Reading, error) {
+	return s.MeasureReadingContext(context.Background(), ch, typ)
+}
+
+// MeasureReadingContext is MeasureReading that can be cancelled by ctx
+func (s *Scope) MeasureReadingContext(ctx context.Context, ch instr.Chan, typ string) (instr.Reading, error) {
+	v, err := s.MeasureContext(ctx, ch, typ)
+	if err != nil {
+		return instr.Reading{}, err
+	}
+	r := instr.NewReading(v, instr.ScopeUnit(typ), 0)
+	r.Source, r.Chan = scopeName, ch
+	return r, nil
+}
+
+// period returns the average time between rising crossings of level, or 0 if
+// there are less than two crossings
+func (s *Scope) period(data []float64, level float64) float64 {
+	first, last, count := 0, 0, 0
+	for k := 1; k < len(data); k++ {
+		if data[k-1] < level && data[k] >= level {
+			if count == 0 {
+				first = k
+			}
+			last = k
+			count++
+		}
+	}
+	if count < 2 {
+		return 0
+	}
+	return float64(last-first) * s.sampleInterval / float64(count-1)
+}
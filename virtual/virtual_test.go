@@ -0,0 +1,217 @@
+package virtual
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jkvatne/go-measure/instr"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a time source controlled by the test
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) sleep(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newBench(channels int) (*Bench, *clock) {
+	c := &clock{t: time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)}
+	b := NewBench(channels)
+	b.SetClock(c.now)
+	return b, c
+}
+
+func TestCurrentLimit(t *testing.T) {
+	b, _ := newBench(2)
+	assert.NoError(t, b.Connect(instr.Ch1, Resistor(100)))
+	var psu instr.Psu = b.Psu()
+	var dmm instr.Dmm = b.Dmm(instr.Ch1, Load)
+	assert.NoError(t, psu.SetOutput(instr.Ch1, 3.0, 0.05))
+	volt, current, err := psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 3.0, volt, 1e-9)
+	assert.InDelta(t, 0.03, current, 1e-9)
+	// 10V into 100 ohm is limited to 0.05A
+	assert.NoError(t, psu.SetOutput(instr.Ch1, 10.0, 0.05))
+	volt, current, err = psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 5.0, volt, 1e-9)
+	assert.InDelta(t, 0.05, current, 1e-9)
+	assert.NoError(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc}))
+	v, err := dmm.Measure()
+	assert.NoError(t, err)
+	assert.InDelta(t, 5.0, v, 1e-9)
+	assert.NoError(t, dmm.Configure(instr.Setup{Unit: instr.Ohm}))
+	v, err = dmm.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, v)
+	// Channel 2 is open
+	assert.NoError(t, psu.SetOutput(instr.Ch2, 10.0, 0.05))
+	volt, current, err = psu.GetOutput(instr.Ch2)
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, volt)
+	assert.Equal(t, 0.0, current)
+	psu.Disable(instr.Ch1)
+	volt, _, err = psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, volt)
+	assert.Error(t, psu.SetOutput(instr.Ch1, 31.0, 0.05))
+	assert.Error(t, psu.SetOutput(instr.Ch3, 1.0, 0.05))
+}
+
+func TestRC(t *testing.T) {
+	b, c := newBench(1)
+	// Time constant is 1 second
+	assert.NoError(t, b.Connect(instr.Ch1, RC(1000, 1e-3)))
+	dmm := b.Dmm(instr.Ch1, Load)
+	assert.NoError(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc}))
+	assert.NoError(t, b.Psu().SetOutput(instr.Ch1, 5.0, 1.0))
+	c.sleep(time.Second)
+	v, err := dmm.Measure()
+	assert.NoError(t, err)
+	assert.InDelta(t, 5.0*(1-math.Exp(-1)), v, 1e-6)
+	// Discharge through the dmm is not modelled, so the voltage stays when turned off
+	b.Psu().Disable(instr.Ch1)
+	c.sleep(time.Second)
+	v, err = dmm.Measure()
+	assert.NoError(t, err)
+	assert.InDelta(t, 5.0*(1-math.Exp(-1)), v, 1e-6)
+}
+
+func TestCapacitorCurrentLimit(t *testing.T) {
+	b, c := newBench(1)
+	// 1mF charged with 10mA rises 10V/s, until it reaches 5V after 0.5s
+	assert.NoError(t, b.Connect(instr.Ch1, Network{Capacitance: 1e-3}))
+	psu := b.Psu()
+	assert.NoError(t, psu.SetOutput(instr.Ch1, 5.0, 0.01))
+	c.sleep(250 * time.Millisecond)
+	volt, current, err := psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 2.5, volt, 1e-3)
+	assert.InDelta(t, 0.01, current, 1e-9)
+	c.sleep(time.Second)
+	volt, current, err = psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 5.0, volt, 1e-9)
+	assert.InDelta(t, 0.0, current, 1e-9)
+}
+
+func TestSlew(t *testing.T) {
+	b, c := newBench(1)
+	psu := b.Psu()
+	psu.Slew = 10
+	assert.NoError(t, psu.SetOutput(instr.Ch1, 10.0, 1.0))
+	c.sleep(500 * time.Millisecond)
+	volt, _, err := psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 5.0, volt, 1e-9)
+	c.sleep(time.Second)
+	volt, _, err = psu.GetOutput(instr.Ch1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 10.0, volt, 1e-9)
+	vset, iset, err := psu.GetSetpoint(instr.Ch1)
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, vset)
+	assert.Equal(t, 1.0, iset)
+}
+
+func TestNoise(t *testing.T) {
+	b, _ := newBench(1)
+	assert.NoError(t, b.Connect(instr.Ch1, Resistor(1000)))
+	assert.NoError(t, b.Psu().SetOutput(instr.Ch1, 2.0, 1.0))
+	dmm := b.Dmm(instr.Ch1, Supply)
+	dmm.Noise = 0.01
+	dmm.Offset = 0.1
+	assert.NoError(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc}))
+	sum, sumSquare := 0.0, 0.0
+	const n = 1000
+	for k := 0; k < n; k++ {
+		v, err := dmm.Measure()
+		assert.NoError(t, err)
+		sum += v
+		sumSquare += v * v
+	}
+	mean := sum / n
+	assert.InDelta(t, 2.1, mean, 0.002)
+	assert.InDelta(t, 0.01, math.Sqrt(sumSquare/n-mean*mean), 0.002)
+	// Overload when outside the range
+	assert.NoError(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc, Range: "1"}))
+	v, err := dmm.Measure()
+	assert.NoError(t, err)
+	assert.Equal(t, overload, v)
+	r, err := dmm.MeasureReading()
+	assert.NoError(t, err)
+	assert.True(t, r.Overload)
+	assert.Equal(t, instr.VoltDc, r.Unit)
+	assert.Equal(t, 1.0, r.Range)
+	assert.Equal(t, instr.Ch1, r.Chan)
+	assert.Equal(t, dmmName, r.Source)
+	assert.NoError(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc, Max: 10}))
+	v, err = dmm.Measure()
+	assert.NoError(t, err)
+	assert.InDelta(t, 2.1, v, 0.1)
+	assert.Error(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc, Max: 10, Autorange: true}))
+	assert.Error(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc, Max: 10, Range: "10"}))
+	assert.Error(t, dmm.Configure(instr.Setup{Unit: instr.Celcius}))
+	assert.Error(t, dmm.Configure(instr.Setup{Unit: instr.VoltDc, Sensor: instr.Pt100}))
+}
+
+func TestScope(t *testing.T) {
+	b, c := newBench(1)
+	// Time constant is 1ms
+	assert.NoError(t, b.Connect(instr.Ch1, RC(1000, 1e-6)))
+	s := b.Scope()
+	assert.NoError(t, s.Connect(instr.Ch1, instr.Ch1, Supply))
+	assert.NoError(t, s.Connect(instr.Ch2, instr.Ch1, Load))
+	var scope instr.Scope = s
+	assert.NoError(t, scope.SetupChannel(instr.Ch1, 10, 0, instr.DC))
+	assert.NoError(t, scope.SetupChannel(instr.Ch2, 10, 0, instr.DC))
+	assert.NoError(t, scope.SetupTime(1e-3/250, 0, instr.Sample, 2500))
+	assert.NoError(t, scope.SetupTrigger(instr.Ch2, instr.DC, instr.Rising, 2.5, false, 0))
+
+	// No trigger before the output is turned on
+	_, err := scope.GetSamples()
+	assert.Error(t, err)
+
+	c.sleep(time.Millisecond)
+	assert.NoError(t, b.Psu().SetOutput(instr.Ch1, 5.0, 1.0))
+	c.sleep(time.Millisecond)
+	data, err := scope.GetSamples()
+	assert.NoError(t, err)
+	// Time, channel 1 and 2, max and min
+	if !assert.Equal(t, 5, len(data)) {
+		return
+	}
+	assert.Equal(t, 2500, len(data[2]))
+	// The trigger is in the middle of the record, after ln(2) time constants
+	assert.InDelta(t, 2.5, data[2][1250], 0.01)
+	assert.InDelta(t, 0.0, data[2][1250-200], 1e-9)
+	assert.InDelta(t, 5.0*(1-math.Exp(-(5e-3+math.Ln2*1e-3)/1e-3)), data[2][2499], 0.01)
+	assert.Equal(t, 5.0, data[1][2499])
+	assert.Equal(t, []float64{5, 5}, data[3])
+
+	f, err := scope.Measure(instr.Ch2, "MAXIMUM")
+	assert.NoError(t, err)
+	assert.InDelta(t, data[2][2499], f, 1e-9)
+	f, err = scope.Measure(instr.Ch1, "FREQ")
+	assert.NoError(t, err)
+	assert.Equal(t, overload, f)
+	r, err := scope.MeasureReading(instr.Ch2, "MAXIMUM")
+	assert.NoError(t, err)
+	assert.InDelta(t, data[2][2499], r.Value, 1e-9)
+	assert.Equal(t, instr.VoltDc, r.Unit)
+	assert.Equal(t, instr.Ch2, r.Chan)
+	r, err = scope.MeasureReading(instr.Ch1, "FREQ")
+	assert.NoError(t, err)
+	assert.Equal(t, instr.Hz, r.Unit)
+	assert.True(t, r.Overload)
+}